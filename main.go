@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/aman/nft-tracker/pkg/config"
+	nftcontroller "github.com/aman/nft-tracker/pkg/controllers"
+	nftModel "github.com/aman/nft-tracker/pkg/models"
 	nftroutes "github.com/aman/nft-tracker/pkg/routes"
 	trackingService "github.com/aman/nft-tracker/pkg/services"
 	"github.com/gorilla/mux"
@@ -18,22 +28,171 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	config.ConnectDB()
+	var store nftModel.Store = nftModel.NewMongoStore()
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "mongo":
+		config.ConnectDB()
+	case "memory":
+		log.Println("Using in-memory storage; nothing is persisted")
+		store = nftModel.NewMemoryStore()
+	default:
+		log.Fatalf("Unsupported STORAGE_BACKEND %q, expected mongo or memory", backend)
+	}
+	nftModel.UseStore(store)
+
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		// The in-memory store starts out empty in every process, so there
+		// is never anything for a query to find.
+		mongoStore, ok := store.(nftModel.MongoStore)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "query: needs STORAGE_BACKEND=mongo; the in-memory store isn't shared between processes")
+			os.Exit(1)
+		}
+		// Lookups only need the collection handles, not the index setup
+		// and migrations the tracker runs.
+		mongoStore.Open()
+		os.Exit(runQuery(os.Args[2:]))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	tracker, err := trackingService.NewTransferEventTracker()
+	tracker, err := trackingService.NewTransferEventTracker(nil)
 	if err != nil {
 		log.Fatalf("Failed to initialize transfer event tracker: %v", err)
 	}
 
+	trackerDone := make(chan struct{})
 	go func() {
-		err := tracker.TrackTransferEvents(context.Background())
-		if err != nil {
+		defer close(trackerDone)
+		err := tracker.TrackTransferEvents(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
 			log.Fatalf("Failed to track events: %v", err)
 		}
 	}()
 
 	r := mux.NewRouter()
-	nftroutes.NftDetails(r)
+	nftroutes.NftDetails(r, nftcontroller.New(store, tracker))
 	http.Handle("/", r)
-	log.Fatal(http.ListenAndServe("localhost:3000", r))
+
+	network, addr := os.Getenv("LISTEN_NETWORK"), os.Getenv("LISTEN_ADDR")
+	if network == "" {
+		network = "tcp"
+	}
+	if addr == "" {
+		addr = "localhost:3000"
+	}
+	listener, err := listen(network, addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clientIP, err := nftcontroller.ClientIP(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Addr: addr, Handler: nftcontroller.RequestID(clientIP(nftcontroller.Gzip(r)))}
+
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		server.TLSConfig, err = tlsConfig(os.Getenv("TLS_MIN_VERSION"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	go func() {
+		var err error
+		if certFile != "" {
+			log.Printf("Serving HTTPS on %s %s", network, addr)
+			err = server.ServeTLS(listener, certFile, keyFile)
+		} else {
+			log.Printf("Serving HTTP on %s %s", network, addr)
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Failed to shut down HTTP server: %v", err)
+	}
+	if network == "unix" {
+		// Closing the listener normally unlinks the socket already.
+		err = os.Remove(addr)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove socket %s: %v", addr, err)
+		}
+	}
+
+	<-trackerDone
+}
+
+// listen opens LISTEN_ADDR on LISTEN_NETWORK, tcp or unix. A socket file
+// left behind by a process that didn't shut down cleanly is removed first,
+// unless something still answers on it.
+func listen(network, addr string) (net.Listener, error) {
+	switch network {
+	case "tcp":
+	case "unix":
+		info, err := os.Stat(addr)
+		if err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("LISTEN_ADDR %s exists and is not a socket", addr)
+			}
+			conn, err := net.Dial("unix", addr)
+			if err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("socket %s is already in use", addr)
+			}
+			log.Printf("Removing stale socket %s", addr)
+			err = os.Remove(addr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %v", addr, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported LISTEN_NETWORK %q, expected tcp or unix", network)
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s %s: %v", network, addr, err)
+	}
+	return listener, nil
+}
+
+// tlsConfig defaults to TLS 1.2 with forward-secret AEAD suites only. The
+// suite list applies to TLS 1.2; Go always picks TLS 1.3 suites itself.
+func tlsConfig(minVersion string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+
+	switch minVersion {
+	case "", "1.2":
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS_MIN_VERSION %q, expected 1.2 or 1.3", minVersion)
+	}
+	return config, nil
 }
@@ -2,24 +2,42 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 var DB *mongo.Client
 
+// readPreference is applied to the collection handles GetReadCollection
+// returns. Everything else reads and writes through the primary.
+var readPreference = readpref.Primary()
+
 func ConnectDB() {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
+	if mode := os.Getenv("MONGO_READ_PREFERENCE"); mode != "" {
+		parsed, err := readpref.ModeFromString(mode)
+		if err != nil {
+			log.Fatalf("Invalid MONGO_READ_PREFERENCE %q", mode)
+		}
+		readPreference, err = readpref.New(parsed)
+		if err != nil {
+			log.Fatalf("Invalid MONGO_READ_PREFERENCE %q: %v", mode, err)
+		}
+	}
+
 	clientOptions := options.Client().ApplyURI(os.Getenv("MONGODB_URI")).SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -29,7 +47,7 @@ func ConnectDB() {
 		log.Fatal(err)
 	}
 
-	err = client.Ping(ctx, nil)
+	err = pingWithRetry(client)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -41,3 +59,53 @@ func ConnectDB() {
 func GetCollection(databaseName, collectionName string) *mongo.Collection {
 	return DB.Database(databaseName).Collection(collectionName)
 }
+
+// GetReadCollection returns a handle for read-only queries that may be
+// served by a secondary, per MONGO_READ_PREFERENCE.
+func GetReadCollection(databaseName, collectionName string) *mongo.Collection {
+	return DB.Database(databaseName).Collection(collectionName, options.Collection().SetReadPreference(readPreference))
+}
+
+// pingWithRetry waits for MongoDB to come up, which it often hasn't yet when
+// everything starts together under docker-compose. It gives up after
+// MONGO_CONNECT_RETRIES failed pings or once MONGO_CONNECT_TIMEOUT has
+// passed, backing off between attempts.
+func pingWithRetry(client *mongo.Client) error {
+	retries := 5
+	if value := os.Getenv("MONGO_CONNECT_RETRIES"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid MONGO_CONNECT_RETRIES %q, defaulting to %d", value, retries)
+		} else {
+			retries = parsed
+		}
+	}
+
+	timeout := time.Minute
+	if value := os.Getenv("MONGO_CONNECT_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid MONGO_CONNECT_TIMEOUT %q, defaulting to %s", value, timeout)
+		} else {
+			timeout = parsed
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		err := client.Ping(ctx, nil)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if attempt > retries || time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("MongoDB unreachable after %d attempts: %v", attempt, err)
+		}
+		log.Printf("Warning: MongoDB ping attempt %d failed: %v, retrying in %s", attempt, err, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 15*time.Second)
+	}
+}
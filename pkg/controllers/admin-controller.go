@@ -0,0 +1,177 @@
+package nftcontroller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	trackingService "github.com/aman/nft-tracker/pkg/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (c *Controller) PostBackfill(w http.ResponseWriter, r *http.Request) {
+	var req trackingService.BackfillRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = c.tracker.StartBackfill(req)
+	switch {
+	case errors.Is(err, trackingService.ErrInvalidBackfill):
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, trackingService.ErrBackfillBusy):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, "Error starting backfill", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, req)
+}
+
+func (c *Controller) PostRescan(w http.ResponseWriter, r *http.Request) {
+	fromBlock, err := strconv.ParseInt(r.URL.Query().Get("fromBlock"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid fromBlock", http.StatusBadRequest)
+		return
+	}
+
+	err = c.tracker.StartRescan(fromBlock)
+	switch {
+	case errors.Is(err, trackingService.ErrInvalidRescan):
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, trackingService.ErrRescanBusy):
+		writeError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, r, "Error starting rescan", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]int64{"fromBlock": fromBlock})
+}
+
+func (c *Controller) PostPauseContract(w http.ResponseWriter, r *http.Request) {
+	c.setContractPaused(w, r, true)
+}
+
+func (c *Controller) PostResumeContract(w http.ResponseWriter, r *http.Request) {
+	c.setContractPaused(w, r, false)
+}
+
+func (c *Controller) setContractPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	contractAddress := mux.Vars(r)["address"]
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+	contract := common.HexToAddress(contractAddress)
+
+	err := c.tracker.SetPaused(r.Context(), contract, paused)
+	switch {
+	case errors.Is(err, trackingService.ErrUnknownContract):
+		writeError(w, r, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		logf(r, "Error in setting paused flag: %v", err)
+		writeError(w, r, "Error updating contract", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PausedContract{Address: contract.Hex(), Paused: paused})
+}
+
+// GetConfig shows the configuration the tracker is running with, secrets
+// redacted.
+func (c *Controller) GetConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := c.tracker.Config(r.Context())
+	if err != nil {
+		logf(r, "Error in fetching tracker config: %v", err)
+		writeError(w, r, "Error fetching tracker config", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, config)
+}
+
+func (c *Controller) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, clamped := nftModel.ClampLimit(limit)
+
+	letters, err := c.store.GetDeadLetters(r.Context(), nftModel.ListOptions{Limit: limit, Offset: offset})
+	if err != nil {
+		logf(r, "Error in fetching dead letters: %v", err)
+		writeError(w, r, "Error fetching dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	writeList(w, r, letters, ListMeta{Count: len(letters), Limit: limit, Offset: offset, LimitClamped: clamped})
+}
+
+// PostReplayDeadLetter reprocesses a dead letter's log, deleting the entry
+// on success. A log that fails again stays listed with the new error.
+func (c *Controller) PostReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, "Invalid dead letter ID", http.StatusBadRequest)
+		return
+	}
+
+	err = c.tracker.ReplayDeadLetter(r.Context(), id)
+	switch {
+	case errors.Is(err, nftModel.ErrNotFound):
+		writeError(w, r, "Dead letter not found", http.StatusNotFound)
+		return
+	case errors.Is(err, trackingService.ErrReplayFailed):
+		writeError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		logf(r, "Error in replaying dead letter: %v", err)
+		writeError(w, r, "Error replaying dead letter", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ReplayedDeadLetter{ID: id.Hex(), Replayed: true})
+}
+
+type ReplayedDeadLetter struct {
+	ID       string `json:"id"`
+	Replayed bool   `json:"replayed"`
+}
+
+type PausedContract struct {
+	Address string `json:"address"`
+	Paused  bool   `json:"paused"`
+}
+
+// RequireAPIKey guards the admin routes with the ADMIN_API_KEY shared
+// secret, passed in the X-API-Key header. With no key configured the admin
+// routes are disabled.
+func RequireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey := os.Getenv("ADMIN_API_KEY")
+		if apiKey == "" {
+			writeError(w, r, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(apiKey)) != 1 {
+			writeError(w, r, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,329 @@
+package nftcontroller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+)
+
+func (c *Controller) GetContractStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	contractAddress := vars["address"]
+
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := c.tracker.CheckCompleteness(r.Context(), common.HexToAddress(contractAddress))
+	if err != nil {
+		logf(r, "Error in checking contract stats: %v", err)
+		writeError(w, r, "Error checking contract stats", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		logf(r, "Error encoding contract stats: %v", err)
+		writeError(w, r, "Error encoding contract stats", http.StatusInternalServerError)
+	}
+}
+
+// SearchContractNfts filters a contract's tokens by one or more
+// ?trait=type:value constraints, all of which must match.
+func (c *Controller) SearchContractNfts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	contractAddress := vars["address"]
+
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	var traits []nftModel.Attribute
+	for _, trait := range r.URL.Query()["trait"] {
+		traitType, value, found := strings.Cut(trait, ":")
+		if !found || traitType == "" || value == "" {
+			writeError(w, r, "Invalid trait filter, expected trait=type:value", http.StatusBadRequest)
+			return
+		}
+		traits = append(traits, nftModel.Attribute{TraitType: traitType, Value: value})
+	}
+
+	// Without a trait the search would be a scan of the whole contract.
+	if len(traits) == 0 {
+		writeError(w, r, "At least one trait filter is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chainID, err := parseChainID(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, clamped := nftModel.ClampLimit(limit)
+
+	opts := nftModel.ListOptions{
+		Limit:              limit,
+		Offset:             offset,
+		IncludeUnconfirmed: queryBool(r, "includeUnconfirmed"),
+		IncludeBurned:      queryBool(r, "includeBurned"),
+		ChainID:            chainID,
+	}
+	nfts, err := c.store.SearchNftsByTraits(r.Context(), common.HexToAddress(contractAddress).Hex(), traits, opts)
+	if err != nil {
+		logf(r, "Error in searching nfts: %v", err)
+		writeError(w, r, "Error searching NFTs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Page-Limit", strconv.FormatInt(limit, 10))
+	if clamped {
+		w.Header().Set("X-Page-Limit-Clamped", "true")
+	}
+	c.setIndexedBlockHeader(w, r)
+	writeList(w, r, newNFTResponses(nfts, c.responseOptions(r)), ListMeta{Count: len(nfts), Limit: limit, Offset: offset, LimitClamped: clamped})
+}
+
+func (c *Controller) GetContractCounts(w http.ResponseWriter, r *http.Request) {
+	var limit int64
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || parsed <= 0 {
+			writeError(w, r, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	counts, err := c.store.GetContractCounts(r.Context(), limit)
+	if err != nil {
+		logf(r, "Error in fetching contract counts: %v", err)
+		writeError(w, r, "Error fetching contract counts", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+const maxActivityBuckets = 1000
+
+// GetContractActivity serves transfer counts per ?interval=day|hour between
+// ?from and ?to (RFC 3339 or YYYY-MM-DD). The range defaults to the last 30
+// days, or the last 48 hours for hourly buckets.
+func (c *Controller) GetContractActivity(w http.ResponseWriter, r *http.Request) {
+	contractAddress := mux.Vars(r)["address"]
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	step := 24 * time.Hour
+	switch interval {
+	case "", nftModel.ActivityDay:
+		interval = nftModel.ActivityDay
+	case nftModel.ActivityHour:
+		step = time.Hour
+	default:
+		writeError(w, r, "Invalid interval, expected day or hour", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		parsed, err := parseTime(toStr)
+		if err != nil {
+			writeError(w, r, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	defaultSpan := 30 * 24 * time.Hour
+	if interval == nftModel.ActivityHour {
+		defaultSpan = 48 * time.Hour
+	}
+	from := to.Add(-defaultSpan)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		parsed, err := parseTime(fromStr)
+		if err != nil {
+			writeError(w, r, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		writeError(w, r, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/step > maxActivityBuckets {
+		writeError(w, r, "Range too large for the interval", http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := c.store.GetContractActivity(r.Context(), common.HexToAddress(contractAddress).Hex(), interval, from, to)
+	if err != nil {
+		logf(r, "Error in fetching contract activity: %v", err)
+		writeError(w, r, "Error fetching contract activity", http.StatusInternalServerError)
+		return
+	}
+
+	c.setIndexedBlockHeader(w, r)
+	writeJSON(w, http.StatusOK, buckets)
+}
+
+// maxMarketWindow bounds ?window on /market, as every sale in the window
+// is read.
+const maxMarketWindow = 30 * 24 * time.Hour
+
+// ContractMarket is a contract's sale summary. Currency, FloorPrice and
+// Volume are for its most traded currency and are null without sales;
+// Currencies breaks every currency down.
+type ContractMarket struct {
+	ContractAddress string                    `json:"contractAddress"`
+	Window          string                    `json:"window"`
+	Since           time.Time                 `json:"since"`
+	SalesTracked    bool                      `json:"salesTracked"`
+	Currency        *string                   `json:"currency"`
+	FloorPrice      *string                   `json:"floorPrice"`
+	Volume          *string                   `json:"volume"`
+	SaleCount       int64                     `json:"saleCount"`
+	Currencies      []nftModel.CurrencyMarket `json:"currencies"`
+}
+
+// GetContractMarket serves floor price, volume and sale count over the
+// last ?window (a Go duration, default 24h), from the sales attached to
+// the contract's transfers.
+func (c *Controller) GetContractMarket(w http.ResponseWriter, r *http.Request) {
+	contractAddress := mux.Vars(r)["address"]
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	window := 24 * time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed <= 0 || parsed > maxMarketWindow {
+			writeError(w, r, "Invalid window, expected a duration up to 720h", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	since := time.Now().UTC().Add(-window)
+	market := ContractMarket{
+		ContractAddress: common.HexToAddress(contractAddress).Hex(),
+		Window:          window.String(),
+		Since:           since,
+		SalesTracked:    c.tracker.SalesTracked(),
+		Currencies:      []nftModel.CurrencyMarket{},
+	}
+
+	if market.SalesTracked {
+		currencies, err := c.store.GetContractMarket(r.Context(), market.ContractAddress, since)
+		if err != nil {
+			logf(r, "Error in fetching contract sales: %v", err)
+			writeError(w, r, "Error fetching contract sales", http.StatusInternalServerError)
+			return
+		}
+		if len(currencies) > 0 {
+			top := currencies[0]
+			market.Currency, market.FloorPrice, market.Volume = &top.Currency, &top.FloorPrice, &top.Volume
+			market.SaleCount = top.SaleCount
+			market.Currencies = currencies
+		}
+	}
+
+	c.setIndexedBlockHeader(w, r)
+	writeJSON(w, http.StatusOK, market)
+}
+
+func parseTime(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.Parse("2006-01-02", value)
+	}
+	return parsed.UTC(), err
+}
+
+func (c *Controller) GetContractSnapshot(w http.ResponseWriter, r *http.Request) {
+	contractAddress := mux.Vars(r)["address"]
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	block, err := strconv.ParseUint(r.URL.Query().Get("block"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid block", http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := c.store.GetContractSnapshot(r.Context(), common.HexToAddress(contractAddress).Hex(), block)
+	if err != nil {
+		logf(r, "Error in building snapshot: %v", err)
+		writeError(w, r, "Error building snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	c.setIndexedBlockHeader(w, r)
+	writeList(w, r, newTokenSnapshotResponses(snapshot, c.responseOptions(r)), ListMeta{Count: len(snapshot)})
+}
+
+func (c *Controller) GetMints(w http.ResponseWriter, r *http.Request) {
+	contractAddress := mux.Vars(r)["address"]
+	if !common.IsHexAddress(contractAddress) {
+		writeError(w, r, "Invalid contract address", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	fromBlock, err := strconv.ParseUint(query.Get("from"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid from block", http.StatusBadRequest)
+		return
+	}
+	toBlock, err := strconv.ParseUint(query.Get("to"), 10, 64)
+	if err != nil || toBlock < fromBlock {
+		writeError(w, r, "Invalid to block", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, clamped := nftModel.ClampLimit(limit)
+
+	mints, err := c.store.GetMints(r.Context(), common.HexToAddress(contractAddress).Hex(), fromBlock, toBlock, nftModel.ListOptions{Limit: limit, Offset: offset})
+	if err != nil {
+		logf(r, "Error in fetching mints: %v", err)
+		writeError(w, r, "Error fetching mints", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Page-Limit", strconv.FormatInt(limit, 10))
+	if clamped {
+		w.Header().Set("X-Page-Limit-Clamped", "true")
+	}
+	c.setIndexedBlockHeader(w, r)
+	writeList(w, r, newTransferResponses(mints, c.responseOptions(r)), ListMeta{Count: len(mints), Limit: limit, Offset: offset, LimitClamped: clamped})
+}
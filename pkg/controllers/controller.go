@@ -0,0 +1,18 @@
+package nftcontroller
+
+import (
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	trackingService "github.com/aman/nft-tracker/pkg/services"
+)
+
+// Controller holds what the handlers read from: the index through store
+// and live chain state through tracker. Handlers reach neither through
+// package state, so they can be exercised against a MemoryStore.
+type Controller struct {
+	store   nftModel.Store
+	tracker *trackingService.TransferEventTracker
+}
+
+func New(store nftModel.Store, tracker *trackingService.TransferEventTracker) *Controller {
+	return &Controller{store: store, tracker: tracker}
+}
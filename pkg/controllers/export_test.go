@@ -0,0 +1,18 @@
+package nftcontroller
+
+import "github.com/gorilla/mux"
+
+// The router lives in nftroutes, which imports this package, so the tests
+// that need it are in nftcontroller_test and reach the spec through these.
+
+func DocumentedOperations() map[string]bool {
+	operations := make(map[string]bool, len(apiDocs))
+	for operation := range apiDocs {
+		operations[operation] = true
+	}
+	return operations
+}
+
+func WalkOperations(router *mux.Router, basePath string, each func(method, path string)) error {
+	return walkOperations(router, basePath, each)
+}
@@ -0,0 +1,240 @@
+package nftcontroller
+
+import (
+	"net/http"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	trackingService "github.com/aman/nft-tracker/pkg/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MetadataPending is the metadataStatus of tokens whose metadata document
+// hasn't been fetched, whether for lack of a first attempt yet or because
+// only the tokenURI is stored.
+const MetadataPending = "pending"
+
+// responseOptions are the per-request choices the response types are built
+// with.
+type responseOptions struct {
+	// scrub drops the URIs of tokens blocked by METADATA_DENYLIST.
+	scrub bool
+	// numericIDs renders token IDs as JSON numbers.
+	numericIDs bool
+}
+
+func (c *Controller) responseOptions(r *http.Request) responseOptions {
+	return responseOptions{scrub: c.tracker.ScrubBlockedURIs(), numericIDs: wantsNumericIDs(r)}
+}
+
+func (o responseOptions) tokenID(value string) TokenID {
+	return TokenID{value: value, numeric: o.numericIDs}
+}
+
+// NFTResponse is an NFT as the API returns it. It lists the model's fields
+// rather than embedding it, so MetadataStatus is only written once: derived
+// from the stored status, and together with HasMetadata enough for clients
+// rendering a token to choose between its image and a placeholder.
+type NFTResponse struct {
+	ID              primitive.ObjectID
+	NftID           TokenID
+	OwnerAddress    string
+	FromAddress     string
+	ContractAddress string
+	TokenUri        string
+	Image           string
+	TxHash          string
+	TimeStamp       time.Time
+	BlockNumber     uint64
+	LogIndex        uint
+	Confirmed       bool
+	Attributes      []nftModel.Attribute
+	HasMetadata     bool `json:"hasMetadata"`
+	// MetadataStatus is ok, invalid, unreachable, blocked or pending.
+	MetadataStatus    string `json:"metadataStatus"`
+	MetadataFetchedAt time.Time
+	LastSale          *nftModel.Sale
+	Burned            bool
+	BurnedAt          *time.Time
+	RawTokenID        string
+	ChainID           int64
+	FirstSeenAt       time.Time
+	LastTransferAt    time.Time
+	WrappedOf         *TokenRefResponse
+}
+
+// WalletNftResponse is a wallet's token with its contract's flags.
+type WalletNftResponse struct {
+	NFTResponse
+	Verified bool
+	Spam     bool
+}
+
+// newNFTResponse derives the metadata fields from the stored status. With
+// opts.scrub set, tokens blocked by METADATA_DENYLIST lose their token and
+// image URIs; the status still says they were blocked.
+func newNFTResponse(nft nftModel.NFT, opts responseOptions) NFTResponse {
+	state := nft.MetadataStatus
+	switch state {
+	case nftModel.MetadataOK, nftModel.MetadataInvalid, nftModel.MetadataUnreachable:
+	case nftModel.MetadataBlocked:
+		if opts.scrub {
+			nft.TokenUri = ""
+			nft.Image = ""
+		}
+	default:
+		state = MetadataPending
+	}
+	var wrappedOf *TokenRefResponse
+	if nft.WrappedOf != nil {
+		ref := newTokenRefResponse(*nft.WrappedOf, opts)
+		wrappedOf = &ref
+	}
+	return NFTResponse{
+		ID:                nft.ID,
+		NftID:             opts.tokenID(nft.NftID.String()),
+		OwnerAddress:      nft.OwnerAddress,
+		FromAddress:       nft.FromAddress,
+		ContractAddress:   nft.ContractAddress,
+		TokenUri:          nft.TokenUri,
+		Image:             nft.Image,
+		TxHash:            nft.TxHash,
+		TimeStamp:         nft.TimeStamp,
+		BlockNumber:       nft.BlockNumber,
+		LogIndex:          nft.LogIndex,
+		Confirmed:         nft.Confirmed,
+		Attributes:        nft.Attributes,
+		HasMetadata:       state == nftModel.MetadataOK,
+		MetadataStatus:    state,
+		MetadataFetchedAt: nft.MetadataFetchedAt,
+		LastSale:          nft.LastSale,
+		Burned:            nft.Burned,
+		BurnedAt:          nft.BurnedAt,
+		RawTokenID:        nft.RawTokenID,
+		ChainID:           nft.ChainID,
+		FirstSeenAt:       nft.FirstSeenAt,
+		LastTransferAt:    nft.LastTransferAt,
+		WrappedOf:         wrappedOf,
+	}
+}
+
+func newNFTResponses(nfts []nftModel.NFT, opts responseOptions) []NFTResponse {
+	responses := make([]NFTResponse, len(nfts))
+	for i, nft := range nfts {
+		responses[i] = newNFTResponse(nft, opts)
+	}
+	return responses
+}
+
+func newWalletNftResponses(nfts []nftModel.WalletNft, opts responseOptions) []WalletNftResponse {
+	responses := make([]WalletNftResponse, len(nfts))
+	for i, nft := range nfts {
+		responses[i] = WalletNftResponse{NFTResponse: newNFTResponse(nft.NFT, opts), Verified: nft.Verified, Spam: nft.Spam}
+	}
+	return responses
+}
+
+// TokenRefResponse is a nftModel.TokenRef as the API returns it.
+type TokenRefResponse struct {
+	ChainID         int64   `json:"chainId,omitempty"`
+	ContractAddress string  `json:"contractAddress"`
+	TokenID         TokenID `json:"tokenId"`
+}
+
+func newTokenRefResponse(ref nftModel.TokenRef, opts responseOptions) TokenRefResponse {
+	return TokenRefResponse{ChainID: ref.ChainID, ContractAddress: ref.ContractAddress, TokenID: opts.tokenID(ref.TokenID)}
+}
+
+// WrappedCounterpartResponse is a token WRAPPED_TOKENS links to another.
+type WrappedCounterpartResponse struct {
+	TokenRefResponse
+	Relation string `json:"relation"`
+}
+
+func newWrappedCounterpartResponses(counterparts []trackingService.WrappedCounterpart, opts responseOptions) []WrappedCounterpartResponse {
+	responses := make([]WrappedCounterpartResponse, len(counterparts))
+	for i, counterpart := range counterparts {
+		responses[i] = WrappedCounterpartResponse{TokenRefResponse: newTokenRefResponse(counterpart.TokenRef, opts), Relation: counterpart.Relation}
+	}
+	return responses
+}
+
+// TransferResponse is a Transfer as the API returns it.
+type TransferResponse struct {
+	ID              primitive.ObjectID
+	ContractAddress string
+	NftID           TokenID
+	FromAddress     string
+	ToAddress       string
+	TxHash          string
+	LogIndex        uint
+	BlockNumber     uint64
+	BlockHash       string
+	TimeStamp       time.Time
+	Sale            *nftModel.Sale
+	RawTokenID      string
+	ChainID         int64
+	Mint            bool
+}
+
+func newTransferResponse(transfer nftModel.Transfer, opts responseOptions) TransferResponse {
+	return TransferResponse{
+		ID:              transfer.ID,
+		ContractAddress: transfer.ContractAddress,
+		NftID:           opts.tokenID(transfer.NftID.String()),
+		FromAddress:     transfer.FromAddress,
+		ToAddress:       transfer.ToAddress,
+		TxHash:          transfer.TxHash,
+		LogIndex:        transfer.LogIndex,
+		BlockNumber:     transfer.BlockNumber,
+		BlockHash:       transfer.BlockHash,
+		TimeStamp:       transfer.TimeStamp,
+		Sale:            transfer.Sale,
+		RawTokenID:      transfer.RawTokenID,
+		ChainID:         transfer.ChainID,
+		Mint:            transfer.Mint,
+	}
+}
+
+func newTransferResponses(transfers []nftModel.Transfer, opts responseOptions) []TransferResponse {
+	responses := make([]TransferResponse, len(transfers))
+	for i, transfer := range transfers {
+		responses[i] = newTransferResponse(transfer, opts)
+	}
+	return responses
+}
+
+// WalletTransferResponse is a transfer with its direction for the wallet.
+type WalletTransferResponse struct {
+	TransferResponse
+	Direction string
+}
+
+func newWalletTransferResponses(transfers []nftModel.WalletTransfer, opts responseOptions) []WalletTransferResponse {
+	responses := make([]WalletTransferResponse, len(transfers))
+	for i, transfer := range transfers {
+		responses[i] = WalletTransferResponse{TransferResponse: newTransferResponse(transfer.Transfer, opts), Direction: transfer.Direction}
+	}
+	return responses
+}
+
+// TokenSnapshotResponse is one token's owner as of a snapshot block.
+type TokenSnapshotResponse struct {
+	TokenID      TokenID `json:"tokenId"`
+	RawTokenID   string  `json:"rawTokenId,omitempty"`
+	OwnerAddress string  `json:"ownerAddress"`
+	BlockNumber  uint64  `json:"blockNumber"`
+}
+
+func newTokenSnapshotResponses(snapshot []nftModel.TokenSnapshot, opts responseOptions) []TokenSnapshotResponse {
+	responses := make([]TokenSnapshotResponse, len(snapshot))
+	for i, token := range snapshot {
+		responses[i] = TokenSnapshotResponse{
+			TokenID:      opts.tokenID(token.NftID.String()),
+			RawTokenID:   token.RawTokenID,
+			OwnerAddress: token.OwnerAddress,
+			BlockNumber:  token.BlockNumber,
+		}
+	}
+	return responses
+}
@@ -0,0 +1,95 @@
+package nftcontroller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testContract = "0x00000000000000000000000000000000000000C0"
+
+func TestNFTResponseMetadataStatus(t *testing.T) {
+	tests := []struct {
+		stored      string
+		status      string
+		hasMetadata bool
+	}{
+		{nftModel.MetadataOK, "ok", true},
+		{nftModel.MetadataInvalid, "invalid", false},
+		{nftModel.MetadataUnreachable, "unreachable", false},
+		{nftModel.MetadataBlocked, "blocked", false},
+		{nftModel.MetadataURIOnly, "pending", false},
+		{"", "pending", false},
+	}
+	for _, tt := range tests {
+		body, err := json.Marshal(newNFTResponse(nftModel.NFT{MetadataStatus: tt.stored}, responseOptions{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(strings.ToLower(string(body)), `"metadatastatus"`); n != 1 {
+			t.Errorf("stored %q: metadataStatus written %d times in %s", tt.stored, n, body)
+		}
+
+		var decoded struct {
+			HasMetadata    bool   `json:"hasMetadata"`
+			MetadataStatus string `json:"metadataStatus"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.MetadataStatus != tt.status || decoded.HasMetadata != tt.hasMetadata {
+			t.Errorf("stored %q: got %q, hasMetadata %v; want %q, %v", tt.stored, decoded.MetadataStatus, decoded.HasMetadata, tt.status, tt.hasMetadata)
+		}
+	}
+}
+
+func TestNFTResponseScrubsBlockedURIs(t *testing.T) {
+	nft := nftModel.NFT{MetadataStatus: nftModel.MetadataBlocked, TokenUri: "https://spam.example/1", Image: "https://spam.example/1.png"}
+
+	kept := newNFTResponse(nft, responseOptions{})
+	if kept.TokenUri == "" || kept.Image == "" {
+		t.Errorf("URIs dropped without scrubbing: %+v", kept)
+	}
+	scrubbed := newNFTResponse(nft, responseOptions{scrub: true})
+	if scrubbed.TokenUri != "" || scrubbed.Image != "" || scrubbed.MetadataStatus != nftModel.MetadataBlocked {
+		t.Errorf("scrubbed response = %+v, want no URIs and status blocked", scrubbed)
+	}
+}
+
+func TestNFTResponseNumericIDs(t *testing.T) {
+	nftId, err := primitive.ParseDecimal128("18446744073709551616")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nft := nftModel.NFT{
+		NftID:     nftId,
+		WrappedOf: &nftModel.TokenRef{ContractAddress: testContract, TokenID: "7"},
+		// Only the token ID fields change, not other numeric-looking strings.
+		TokenUri: "42",
+	}
+	raw := nftModel.NFT{NftID: nftModel.RawTokenNftID, RawTokenID: "0x" + strings.Repeat("ff", 32)}
+
+	tests := []struct {
+		nft     nftModel.NFT
+		numeric bool
+		want    []string
+	}{
+		{nft, false, []string{`"NftID":"18446744073709551616"`, `"tokenId":"7"`, `"TokenUri":"42"`}},
+		{nft, true, []string{`"NftID":18446744073709551616`, `"tokenId":7`, `"TokenUri":"42"`}},
+		{raw, true, []string{`"NftID":"NaN"`}},
+	}
+	for _, tt := range tests {
+		body, err := json.Marshal(newNFTResponse(tt.nft, responseOptions{numericIDs: tt.numeric}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("numeric %v: %s lacks %s", tt.numeric, body, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,483 @@
+package nftcontroller
+
+import (
+	"encoding"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	trackingService "github.com/aman/nft-tracker/pkg/services"
+	"github.com/gorilla/mux"
+)
+
+type openAPISpec struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*jsonSchema           `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+type openAPIOperation struct {
+	Summary    string                     `json:"summary,omitempty"`
+	Parameters []openAPIParameter         `json:"parameters,omitempty"`
+	Responses  map[string]openAPIResponse `json:"responses"`
+	Security   []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Required    bool        `json:"required,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]openAPIMedia `json:"content,omitempty"`
+}
+
+type openAPIMedia struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+}
+
+// apiDoc describes what the router can't: the query parameters a handler
+// reads and the Go value it responds with. Path parameters come from the
+// route template.
+type apiDoc struct {
+	summary string
+	query   []openAPIParameter
+	// response is a value of the type written on success. List endpoints
+	// respond with a slice and also accept the envelope option.
+	response interface{}
+	list     bool
+	// mediaType is set for endpoints that respond with something other
+	// than JSON, in place of response.
+	mediaType string
+	// accepted marks operations that start work in the background and
+	// answer 202.
+	accepted bool
+}
+
+func queryParam(name, typ, description string) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: &jsonSchema{Type: typ}}
+}
+
+var pageParams = []openAPIParameter{
+	queryParam("limit", "integer", "Page size, capped at MAX_PAGE_SIZE"),
+	queryParam("offset", "integer", "Number of records to skip"),
+}
+
+var chainIdParam = queryParam("chainId", "integer", "Only return records from this chain")
+
+var numericIdsParam = queryParam("numericIds", "boolean", "Render token IDs as JSON numbers instead of strings; IDs above 2^53 lose precision in JavaScript")
+
+var envelopeParam = queryParam("envelope", "boolean", "Wrap the list in {data, meta}; the "+envelopeMediaType+" Accept type does the same")
+
+var apiDocs = map[string]apiDoc{
+	"GET /nft": {
+		summary: "List NFTs by token ID, newest first",
+		query: append(pageParams,
+			queryParam("cursor", "string", "Continue after a previous page; can't be combined with offset"),
+			queryParam("includeUnconfirmed", "boolean", "Include records below the confirmation depth"),
+			queryParam("includeBurned", "boolean", "Include burned tokens"),
+			chainIdParam,
+		),
+		response: []NFTResponse{},
+		list:     true,
+	},
+	"GET /nft/{walletAddress}": {
+		summary: "List the NFTs a wallet or ENS name owns",
+		query: append(pageParams,
+			queryParam("includeUnconfirmed", "boolean", "Include records below the confirmation depth"),
+			queryParam("includeBurned", "boolean", "Include burned tokens"),
+			queryParam("excludeSpam", "boolean", "Drop tokens from contracts flagged as spam"),
+			chainIdParam,
+		),
+		response: []WalletNftResponse{},
+		list:     true,
+	},
+	"GET /nft/{walletAddress}/summary": {
+		summary:  "Count a wallet's NFTs per contract",
+		response: []nftModel.WalletContractSummary{},
+	},
+	"GET /nft/{walletAddress}/transfers": {
+		summary:  "List a wallet's transfers, newest first",
+		query:    append(pageParams, chainIdParam),
+		response: []WalletTransferResponse{},
+		list:     true,
+	},
+	"GET /nft/tx/{txHash}": {
+		summary:  "List the NFTs a transaction moved",
+		response: []NFTResponse{},
+		list:     true,
+	},
+	"GET /nft/changes": {
+		summary: "List NFTs whose latest transfer was at or after since, oldest first, burned ones included",
+		query: append([]openAPIParameter{
+			queryParam("since", "string", "RFC 3339 timestamp, usually the last lastTransferAt seen"),
+			queryParam("includeUnconfirmed", "boolean", "Include records below the confirmation depth"),
+			chainIdParam,
+		}, pageParams...),
+		response: []NFTResponse{},
+		list:     true,
+	},
+	"GET /nft/token/{contract}/{tokenId}/owner": {
+		summary: "Look up a token's owner, reading it from chain when it isn't indexed and OWNER_OF_FALLBACK is set",
+		query: []openAPIParameter{
+			queryParam("live", "boolean", "Ask the chain instead of the index"),
+			queryParam("block", "integer", "Owner as of this block, from the transfer history"),
+			numericIdsParam,
+		},
+		response: TokenOwner{},
+	},
+	"GET /nft/token/{contract}/{tokenId}/image": {
+		summary:   "Fetch a token's metadata image through the IMAGE_PROXY cache",
+		mediaType: "image/*",
+	},
+	"GET /nft/token/{contract}/{tokenId}/wrapped": {
+		summary:  "List a token's wrapped or bridged counterparts",
+		query:    []openAPIParameter{queryParam("chainId", "integer", "Chain of the given token; defaults to the tracked chain")},
+		response: []WrappedCounterpartResponse{},
+		list:     true,
+	},
+	"GET /nft/contract/{address}/search": {
+		summary: "Search a contract's NFTs by trait",
+		query: append(pageParams,
+			queryParam("trait", "string", "type:value, repeatable; all must match and at least one is required"),
+			queryParam("includeUnconfirmed", "boolean", "Include records below the confirmation depth"),
+			queryParam("includeBurned", "boolean", "Include burned tokens"),
+			chainIdParam,
+			numericIdsParam,
+		),
+		response: []NFTResponse{},
+		list:     true,
+	},
+	"GET /nft/contract/{address}/activity": {
+		summary: "Count a contract's transfers per time bucket",
+		query: []openAPIParameter{
+			queryParam("interval", "string", "hour or day"),
+			queryParam("from", "string", "RFC 3339 start time"),
+			queryParam("to", "string", "RFC 3339 end time"),
+		},
+		response: []nftModel.ActivityBucket{},
+	},
+	"GET /nft/contract/{address}/market": {
+		summary:  "Summarise a contract's sales: floor price, volume and sale count",
+		query:    []openAPIParameter{queryParam("window", "string", "Duration to summarise, such as 24h or 168h; defaults to 24h")},
+		response: ContractMarket{},
+	},
+	"GET /nft/contract/{address}/snapshot": {
+		summary:  "List every token's owner as of a block",
+		query:    []openAPIParameter{queryParam("block", "integer", "Snapshot block")},
+		response: []TokenSnapshotResponse{},
+		list:     true,
+	},
+	"GET /nft/contract/{address}/mints": {
+		summary: "List a contract's mints in a block range, oldest first",
+		query: append(pageParams,
+			queryParam("from", "integer", "First block"),
+			queryParam("to", "integer", "Last block"),
+		),
+		response: []TransferResponse{},
+		list:     true,
+	},
+	"GET /contracts/{address}/stats": {
+		summary:  "Compare indexed and on-chain token counts for a contract",
+		response: trackingService.ContractStats{},
+	},
+	"GET /stats/contracts": {
+		summary:  "Count NFTs per contract",
+		query:    []openAPIParameter{queryParam("limit", "integer", "Number of contracts to return")},
+		response: []nftModel.ContractCount{},
+	},
+	"GET /status": {
+		summary:  "Report tracker progress",
+		response: Status{},
+	},
+	"GET /ready": {
+		summary:  "Readiness probe",
+		response: trackingService.Readiness{},
+	},
+	"POST /admin/backfill": {
+		summary:  "Start a backfill",
+		response: trackingService.BackfillRequest{},
+		accepted: true,
+	},
+	"POST /admin/rescan": {
+		summary:  "Rescan every contract from a block",
+		query:    []openAPIParameter{queryParam("fromBlock", "integer", "Block to rescan from")},
+		response: map[string]int64{},
+		accepted: true,
+	},
+	"POST /admin/contracts/{address}/pause": {
+		summary:  "Stop tracking a contract until it is resumed",
+		response: PausedContract{},
+	},
+	"POST /admin/contracts/{address}/resume": {
+		summary:  "Resume tracking a paused contract",
+		response: PausedContract{},
+	},
+	"GET /admin/deadletters": {
+		summary:  "List logs that failed processing",
+		query:    pageParams,
+		response: []nftModel.DeadLetter{},
+		list:     true,
+	},
+	"POST /admin/deadletters/{id}/replay": {
+		summary:  "Reprocess a failed log",
+		response: ReplayedDeadLetter{},
+	},
+	"GET /openapi.json": {
+		summary:  "This OpenAPI description",
+		response: map[string]interface{}{},
+	},
+	"GET /admin/config": {
+		summary:  "Show the tracker's configuration",
+		response: trackingService.TrackerConfig{},
+	},
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)[^}]*\}`)
+
+// OpenAPI serves an OpenAPI 3 description of every route on router. The
+// spec is built on first request, once all routes are registered; routes
+// without an apiDocs entry still appear, with their path parameters. Paths
+// are listed relative to basePath, which becomes the server URL.
+func OpenAPI(router *mux.Router, basePath string) http.HandlerFunc {
+	var once sync.Once
+	var spec *openAPISpec
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			spec = buildOpenAPI(router, basePath)
+		})
+		writeJSON(w, http.StatusOK, spec)
+	}
+}
+
+func buildOpenAPI(router *mux.Router, basePath string) *openAPISpec {
+	server := basePath
+	if server == "" {
+		server = "/"
+	}
+
+	schemas := &schemaBuilder{schemas: make(map[string]*jsonSchema)}
+	spec := &openAPISpec{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "nft-tracker", Version: "1"},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Servers: []openAPIServer{{URL: server}},
+		Components: openAPIComponents{
+			Schemas: schemas.schemas,
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+
+	err := walkOperations(router, basePath, func(method, path string) {
+		op := &openAPIOperation{Responses: make(map[string]openAPIResponse)}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name: match[1], In: "path", Required: true, Schema: &jsonSchema{Type: "string"},
+			})
+		}
+		if strings.HasPrefix(path, "/admin/") {
+			op.Security = []map[string][]string{{"apiKey": {}}}
+		}
+
+		doc, ok := apiDocs[method+" "+path]
+		if !ok {
+			op.Responses["200"] = openAPIResponse{Description: "OK"}
+		} else {
+			op.Summary = doc.summary
+			op.Parameters = append(op.Parameters, doc.query...)
+			body := &jsonSchema{Type: "string", Format: "binary"}
+			mediaType := "application/json"
+			if doc.mediaType != "" {
+				mediaType = doc.mediaType
+			} else {
+				body = schemas.schemaFor(reflect.TypeOf(doc.response))
+			}
+			if doc.list {
+				op.Parameters = append(op.Parameters, envelopeParam, numericIdsParam)
+				body = &jsonSchema{OneOf: []*jsonSchema{body, {
+					Type: "object",
+					Properties: map[string]*jsonSchema{
+						"data": body,
+						"meta": schemas.schemaFor(reflect.TypeOf(ListMeta{})),
+					},
+				}}}
+			}
+			status := "200"
+			if doc.accepted {
+				status = "202"
+			}
+			op.Responses[status] = openAPIResponse{
+				Description: "OK",
+				Content:     map[string]openAPIMedia{mediaType: {Schema: body}},
+			}
+		}
+
+		if spec.Paths[path] == nil {
+			spec.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		spec.Paths[path][strings.ToLower(method)] = op
+	})
+	if err != nil {
+		log.Printf("Error walking routes for OpenAPI spec: %v", err)
+	}
+	return spec
+}
+
+// walkOperations calls each with every method and path template the
+// router serves, paths relative to basePath. Routes that don't restrict
+// their methods are listed as GET.
+func walkOperations(router *mux.Router, basePath string, each func(method, path string)) error {
+	return router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path = strings.TrimPrefix(path, basePath)
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			each(method, path)
+		}
+		return nil
+	})
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	bigIntType        = reflect.TypeOf(big.Int{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaBuilder derives JSON schemas from Go types the way encoding/json
+// would render them. Named structs become components referenced by $ref.
+type schemaBuilder struct {
+	schemas map[string]*jsonSchema
+}
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) *jsonSchema {
+	switch {
+	case t == timeType:
+		return &jsonSchema{Type: "string", Format: "date-time"}
+	case t == bigIntType:
+		return &jsonSchema{Type: "integer"}
+	case t.Kind() != reflect.Pointer && (t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)):
+		// Decimal128, ObjectID and common.Address all render as strings.
+		return &jsonSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaFor(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate.
+			b.schemas[t.Name()] = &jsonSchema{}
+			*b.schemas[t.Name()] = *b.object(t)
+		}
+		return &jsonSchema{Ref: "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &jsonSchema{Type: "string", Format: "byte"}
+		}
+		return &jsonSchema{Type: "array", Items: b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: b.schemaFor(t.Elem())}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &jsonSchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	}
+	return &jsonSchema{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) *jsonSchema {
+	schema := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+	b.addFields(schema, t)
+	return schema
+}
+
+// addFields follows encoding/json: embedded structs without a JSON name are
+// flattened into the parent.
+func (b *schemaBuilder) addFields(schema *jsonSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.addFields(schema, fieldType)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = b.schemaFor(field.Type)
+	}
+}
@@ -0,0 +1,37 @@
+package nftcontroller_test
+
+import (
+	"testing"
+
+	nftcontroller "github.com/aman/nft-tracker/pkg/controllers"
+	nftroutes "github.com/aman/nft-tracker/pkg/routes"
+	"github.com/gorilla/mux"
+)
+
+// TestAPIDocsMatchRoutes keeps apiDocs in step with the router: every route
+// needs an entry, and every entry a route.
+func TestAPIDocsMatchRoutes(t *testing.T) {
+	for _, basePath := range []string{"", "/api/v1"} {
+		t.Setenv("API_BASE_PATH", basePath)
+		router := mux.NewRouter()
+		nftroutes.NftDetails(router, &nftcontroller.Controller{})
+
+		documented := nftcontroller.DocumentedOperations()
+		routed := make(map[string]bool)
+		err := nftcontroller.WalkOperations(router, basePath, func(method, path string) {
+			operation := method + " " + path
+			routed[operation] = true
+			if !documented[operation] {
+				t.Errorf("base path %q: route %s has no apiDocs entry", basePath, operation)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for operation := range documented {
+			if !routed[operation] {
+				t.Errorf("base path %q: apiDocs entry %s has no route", basePath, operation)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package nftcontroller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+type requestIDKey struct{}
+
+// requestIDPattern limits client-supplied IDs to something safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags each request with an ID, taken from X-Request-ID when the
+// client or a proxy sent a usable one and generated otherwise. The ID is
+// echoed in the X-Request-ID response header, prefixed to the handler's log
+// lines and included in error bodies, so a client report can be matched to
+// the server logs.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Printf("Error generating request ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf logs with the request's ID so the line can be found from an error
+// response, and the client's address.
+func logf(r *http.Request, format string, args ...interface{}) {
+	prefix := clientIP(r)
+	if id := requestID(r); id != "" {
+		prefix = id + " " + prefix
+	}
+	log.Printf("["+prefix+"] "+format, args...)
+}
@@ -0,0 +1,237 @@
+package nftcontroller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeError is the JSON counterpart of http.Error, carrying the request ID
+// for support.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	writeJSON(w, status, errorResponse{Error: message, RequestID: requestID(r)})
+}
+
+// envelopeMediaType selects the enveloped list shape through Accept, as an
+// alternative to ?envelope=true.
+const envelopeMediaType = "application/vnd.nft-tracker.envelope+json"
+
+type ListMeta struct {
+	Count        int    `json:"count"`
+	Limit        int64  `json:"limit,omitempty"`
+	Offset       int64  `json:"offset,omitempty"`
+	LimitClamped bool   `json:"limitClamped,omitempty"`
+	NextCursor   string `json:"nextCursor,omitempty"`
+	// Total, Page, PageSize and HasMore are only set by endpoints that
+	// count the full result set.
+	Total    *int64 `json:"total,omitempty"`
+	Page     int64  `json:"page,omitempty"`
+	PageSize int64  `json:"pageSize,omitempty"`
+	HasMore  *bool  `json:"hasMore,omitempty"`
+}
+
+type listEnvelope struct {
+	Data interface{} `json:"data"`
+	Meta ListMeta    `json:"meta"`
+}
+
+// writeList writes a list response as the bare array by default, or as a
+// {data, meta} envelope when the client asks for one.
+func writeList(w http.ResponseWriter, r *http.Request, data interface{}, meta ListMeta) {
+	if queryBool(r, "envelope") || strings.Contains(r.Header.Get("Accept"), envelopeMediaType) {
+		writeCached(w, r, listEnvelope{Data: data, Meta: meta})
+		return
+	}
+	writeCached(w, r, data)
+}
+
+// writeCached writes v with an ETag over its encoding and answers a
+// matching If-None-Match with 304, so clients polling an unchanged list
+// don't download it again. Together with X-Indexed-Block this lets them
+// tell cheaply whether anything moved since the last poll.
+func writeCached(w http.ResponseWriter, r *http.Request, v interface{}) {
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(v)
+	if err != nil {
+		logf(r, "Error encoding response: %v", err)
+		writeError(w, r, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	// Weak, as the gzip middleware may change the bytes on the wire.
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body.Bytes())
+	if err != nil {
+		logf(r, "Error writing response: %v", err)
+	}
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listStream writes a list response one element at a time, in the same
+// shapes as writeList, so a large result never sits in memory whole.
+// Nothing is written before the first element, so an error up to then can
+// still get a proper status. The bare array has nowhere to put the next
+// cursor once the body has started, so it goes in an X-Next-Cursor
+// trailer instead.
+type listStream struct {
+	w        http.ResponseWriter
+	enc      *json.Encoder
+	envelope bool
+	started  bool
+	count    int
+}
+
+func newListStream(w http.ResponseWriter, r *http.Request) *listStream {
+	return &listStream{
+		w:        w,
+		enc:      json.NewEncoder(w),
+		envelope: queryBool(r, "envelope") || strings.Contains(r.Header.Get("Accept"), envelopeMediaType),
+	}
+}
+
+func (s *listStream) start() error {
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/json")
+	if !s.envelope {
+		s.w.Header().Set("Trailer", "X-Next-Cursor")
+	}
+	s.w.WriteHeader(http.StatusOK)
+
+	open := "["
+	if s.envelope {
+		open = `{"data":[`
+	}
+	_, err := io.WriteString(s.w, open)
+	return err
+}
+
+func (s *listStream) add(v interface{}) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if s.count > 0 {
+		if _, err := io.WriteString(s.w, ","); err != nil {
+			return err
+		}
+	}
+	s.count++
+	return s.enc.Encode(v)
+}
+
+// close ends the array; meta is only written in the envelope shape.
+func (s *listStream) close(meta ListMeta) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if !s.envelope {
+		if meta.NextCursor != "" {
+			s.w.Header().Set("X-Next-Cursor", meta.NextCursor)
+		}
+		_, err := io.WriteString(s.w, "]\n")
+		return err
+	}
+	if _, err := io.WriteString(s.w, `],"meta":`); err != nil {
+		return err
+	}
+	if err := s.enc.Encode(meta); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.w, "}\n")
+	return err
+}
+
+// setIndexedBlockHeader tells clients how fresh a list response is by
+// reporting the last block the tracker has fully processed.
+func (c *Controller) setIndexedBlockHeader(w http.ResponseWriter, r *http.Request) {
+	block, err := c.store.GetIndexedBlock(r.Context())
+	if err != nil || block < 0 {
+		return
+	}
+	w.Header().Set("X-Indexed-Block", strconv.FormatInt(block, 10))
+}
+
+func parsePagination(r *http.Request) (int64, int64, error) {
+	var limit, offset int64
+	var err error
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("Invalid limit")
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+func queryBool(r *http.Request, name string) bool {
+	value, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return value
+}
+
+// parseChainID reads the optional chainId filter.
+func parseChainID(r *http.Request) (*int64, error) {
+	value := r.URL.Query().Get("chainId")
+	if value == "" {
+		return nil, nil
+	}
+	chainID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || chainID <= 0 {
+		return nil, errors.New("Invalid chainId")
+	}
+	return &chainID, nil
+}
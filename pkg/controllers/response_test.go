@@ -0,0 +1,34 @@
+package nftcontroller
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListStreamSendsNextCursorAsTrailer(t *testing.T) {
+	r := httptest.NewRequest("GET", "/nft", nil)
+	w := httptest.NewRecorder()
+
+	stream := newListStream(w, r)
+	for _, v := range []int{1, 2} {
+		if err := stream.add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.close(ListMeta{Count: 2, NextCursor: "next"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := w.Result()
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "[1\n,2\n]\n" {
+		t.Errorf("body = %q, want the bare array", body)
+	}
+	if got := res.Header.Get("X-Next-Cursor"); got != "" {
+		t.Errorf("X-Next-Cursor header = %q, want it only in the trailer", got)
+	}
+	if got := res.Trailer.Get("X-Next-Cursor"); got != "next" {
+		t.Errorf("X-Next-Cursor trailer = %q, want %q", got, "next")
+	}
+}
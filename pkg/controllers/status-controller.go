@@ -0,0 +1,56 @@
+package nftcontroller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	trackingService "github.com/aman/nft-tracker/pkg/services"
+)
+
+type Status struct {
+	trackingService.TrackerStatus
+	IndexedBlock int64 `json:"indexedBlock"`
+}
+
+func (c *Controller) GetStatus(w http.ResponseWriter, r *http.Request) {
+	indexedBlock, err := c.store.GetIndexedBlock(r.Context())
+	if err != nil {
+		logf(r, "Error in fetching indexed block: %v", err)
+		writeError(w, r, "Error fetching status", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Status{
+		TrackerStatus: c.tracker.Status(),
+		IndexedBlock:  indexedBlock,
+	})
+}
+
+// GetReady answers readiness probes with 503 while MongoDB doesn't answer a
+// ping, the RPC circuit breaker is open, indexing lags too far behind or no
+// logs have arrived for too long.
+func (c *Controller) GetReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	err := c.store.Ping(ctx)
+	if err != nil {
+		logf(r, "Readiness ping to MongoDB failed: %v", err)
+		writeJSON(w, http.StatusServiceUnavailable, trackingService.Readiness{Reason: "MongoDB unavailable"})
+		return
+	}
+
+	indexedBlock, err := c.store.GetIndexedBlock(r.Context())
+	if err != nil {
+		logf(r, "Error in fetching indexed block: %v", err)
+		writeJSON(w, http.StatusServiceUnavailable, trackingService.Readiness{Reason: "scan progress unavailable"})
+		return
+	}
+
+	readiness := c.tracker.Readiness(indexedBlock)
+	if !readiness.Ready {
+		writeJSON(w, http.StatusServiceUnavailable, readiness)
+		return
+	}
+	writeJSON(w, http.StatusOK, readiness)
+}
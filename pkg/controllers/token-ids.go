@@ -0,0 +1,48 @@
+package nftcontroller
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var integerPattern = regexp.MustCompile(`^-?[0-9]+$`)
+
+// wantsNumericIDs reports whether the client asked for token IDs as JSON
+// numbers with ?numericIds=true. They are strings by default, since IDs
+// above 2^53 lose precision as JavaScript numbers.
+func wantsNumericIDs(r *http.Request) bool {
+	return queryBool(r, "numericIds")
+}
+
+// parseTokenID reads a {tokenId} path segment: a decimal ID, or the
+// 0x-prefixed hex that responses carry as RawTokenID for IDs too large to
+// store as numbers.
+func parseTokenID(raw string) (*big.Int, bool) {
+	base := 10
+	if strings.HasPrefix(raw, "0x") || strings.HasPrefix(raw, "0X") {
+		raw, base = raw[2:], 16
+	}
+	tokenId, ok := new(big.Int).SetString(raw, base)
+	if !ok || tokenId.Sign() < 0 || tokenId.BitLen() > 256 {
+		return nil, false
+	}
+	return tokenId, true
+}
+
+// TokenID is a token ID as responses write it: a JSON string, or with
+// ?numericIds=true a JSON number. IDs that aren't integers, such as the
+// raw token marker, stay strings either way.
+type TokenID struct {
+	value   string
+	numeric bool
+}
+
+func (id TokenID) MarshalJSON() ([]byte, error) {
+	if id.numeric && integerPattern.MatchString(id.value) {
+		return []byte(id.value), nil
+	}
+	return json.Marshal(id.value)
+}
@@ -0,0 +1,133 @@
+package nftModel
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var contractCollection *mongo.Collection
+
+type Contract struct {
+	Address   string    `bson:"address" json:"address"`
+	Name      string    `bson:"name,omitempty" json:"name,omitempty"`
+	Symbol    string    `bson:"symbol,omitempty" json:"symbol,omitempty"`
+	Verified  bool      `bson:"verified" json:"verified"`
+	Spam      bool      `bson:"spam" json:"spam"`
+	Paused    bool      `bson:"paused" json:"paused"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+func GetContractCollection() *mongo.Collection {
+	contractCollection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("CONTRACT_COLLECTION", "contracts"))
+	return contractCollection
+}
+
+func CreateContractIndexes() {
+	indexModel := mongo.IndexModel{
+		Keys:    bson.M{"address": 1},
+		Options: options.Index().SetUnique(true),
+	}
+
+	buildIndexes(contractCollection, []mongo.IndexModel{indexModel}, nil)
+}
+
+func (MongoStore) UpsertContractInfo(ctx context.Context, address, name, symbol string) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"address": address}
+	update := bson.M{
+		"$set": bson.M{
+			"name":      name,
+			"symbol":    symbol,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err := contractCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		log.Printf("Failed to upsert contract info: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SetContractFlags records whether a contract is on the verified or spam
+// list, creating its record if needed.
+func (MongoStore) SetContractFlags(ctx context.Context, address string, verified, spam bool) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"address": address}
+	update := bson.M{
+		"$set": bson.M{
+			"verified":  verified,
+			"spam":      spam,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err := contractCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		log.Printf("Failed to set contract flags: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SetContractPaused records whether tracking of a contract is paused, so the
+// pause survives a restart.
+func (MongoStore) SetContractPaused(ctx context.Context, address string, paused bool) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"address": address}
+	update := bson.M{
+		"$set": bson.M{
+			"paused":    paused,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err := contractCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		log.Printf("Failed to set contract paused flag: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (MongoStore) GetPausedContracts(ctx context.Context) ([]string, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	cursor, err := contractCollection.Find(ctx, bson.M{"paused": true})
+	if err != nil {
+		log.Printf("Failed to find paused contracts: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var contracts []Contract
+	err = cursor.All(ctx, &contracts)
+	if err != nil {
+		log.Printf("Failed to decode paused contracts: %v", err)
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		addresses = append(addresses, contract.Address)
+	}
+	return addresses, nil
+}
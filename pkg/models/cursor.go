@@ -0,0 +1,57 @@
+package nftModel
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageCursor marks the last record of a page in the (nftId, _id) sort
+// order, so the next page can start with a range filter instead of a skip.
+type PageCursor struct {
+	NftID primitive.Decimal128
+	ID    primitive.ObjectID
+}
+
+func CursorAfter(nft NFT) *PageCursor {
+	return &PageCursor{NftID: nft.NftID, ID: nft.ID}
+}
+
+// Encode returns the opaque token handed to clients.
+func (c *PageCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.NftID.String() + ":" + c.ID.Hex()))
+}
+
+func DecodeCursor(token string) (*PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nftIdStr, idStr, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	nftId, err := primitive.ParseDecimal128(nftIdStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &PageCursor{NftID: nftId, ID: id}, nil
+}
+
+// filter matches records after the cursor in descending (nftId, _id) order.
+func (c *PageCursor) filter() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"nftId": bson.M{"$lt": c.NftID}},
+		bson.M{"nftId": c.NftID, "_id": bson.M{"$lt": c.ID}},
+	}}
+}
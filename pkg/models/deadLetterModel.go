@@ -0,0 +1,122 @@
+package nftModel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var deadLetterCollection *mongo.Collection
+
+// DeadLetter is a log that failed processing, kept with the error so it can
+// be replayed once the cause is fixed. A log that fails again updates its
+// existing entry.
+type DeadLetter struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ChainID  int64              `bson:"chainId" json:"chainId"`
+	Log      RawLog             `bson:"log" json:"log"`
+	Error    string             `bson:"error" json:"error"`
+	Attempts int                `bson:"attempts" json:"attempts"`
+	FailedAt time.Time          `bson:"failedAt" json:"failedAt"`
+}
+
+func GetDeadLetterCollection() *mongo.Collection {
+	deadLetterCollection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("DEADLETTER_COLLECTION", "deadletter"))
+	return deadLetterCollection
+}
+
+func CreateDeadLetterIndexes() {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "chainId", Value: 1}, {Key: "log.txHash", Value: 1}, {Key: "log.logIndex", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "failedAt", Value: -1}}},
+	}
+
+	buildIndexes(deadLetterCollection, indexModels, nil)
+}
+
+func (MongoStore) SaveDeadLetter(ctx context.Context, rawLog RawLog, cause string) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"chainId": chainID, "log.txHash": rawLog.TxHash, "log.logIndex": rawLog.LogIndex}
+	update := bson.M{
+		"$set": bson.M{"log": rawLog, "error": cause, "failedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := deadLetterCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		log.Printf("Failed to save dead letter: %v", err)
+		return fmt.Errorf("save dead letter for %s:%d: %w", rawLog.TxHash, rawLog.LogIndex, err)
+	}
+	return nil
+}
+
+// GetDeadLetters lists dead letters for the indexed chain, most recent
+// failure first.
+func (MongoStore) GetDeadLetters(ctx context.Context, opts ListOptions) ([]DeadLetter, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "failedAt", Value: -1}, {Key: "_id", Value: -1}})
+	findOptions.SetLimit(limit)
+	if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
+
+	cursor, err := deadLetterCollection.Find(ctx, bson.M{"chainId": chainID}, findOptions)
+	if err != nil {
+		log.Printf("Failed to find dead letters: %v", err)
+		return nil, fmt.Errorf("list dead letters: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	letters := []DeadLetter{}
+	err = cursor.All(ctx, &letters)
+	if err != nil {
+		log.Printf("Failed to decode dead letters: %v", err)
+		return nil, fmt.Errorf("list dead letters: decode: %w", err)
+	}
+	return letters, nil
+}
+
+func (MongoStore) GetDeadLetter(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	var letter DeadLetter
+	err := deadLetterCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&letter)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Printf("Failed to find dead letter: %v", err)
+		return nil, fmt.Errorf("get dead letter %s: %w", id.Hex(), err)
+	}
+	return &letter, nil
+}
+
+func (MongoStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	_, err := deadLetterCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Failed to delete dead letter: %v", err)
+		return fmt.Errorf("delete dead letter %s: %w", id.Hex(), err)
+	}
+	return nil
+}
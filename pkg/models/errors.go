@@ -0,0 +1,7 @@
+package nftModel
+
+import "errors"
+
+// ErrNotFound is returned (wrapped) when a lookup matches no document, so
+// callers can tell a missing record from a failed query with errors.Is.
+var ErrNotFound = errors.New("not found")
@@ -0,0 +1,60 @@
+package nftModel
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexBuildTimeout is the INDEX_BUILD_TIMEOUT of the store being set up,
+// set by Init.
+var indexBuildTimeout = 10 * time.Second
+
+// indexContext bounds the index setup of one collection by
+// INDEX_BUILD_TIMEOUT: the migrations run before its indexes, and then the
+// index build itself. Building indexes on a large existing collection can
+// take much longer than the default.
+func indexContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), indexBuildTimeout)
+}
+
+// buildIndexes starts building models on coll and returns without waiting
+// for it, so startup carries on while a large collection is indexed. The
+// indexes are requested as background builds, which servers before MongoDB
+// 4.2 need to keep the collection readable and writable meanwhile; newer
+// servers ignore the option as every build works that way. after, if set,
+// runs once the indexes exist, to drop the ones they supersede.
+//
+// A failed build is fatal, as it was when startup waited for it: a missing
+// unique index lets duplicates in. A build still running at the deadline
+// carries on on the server, so it is only logged.
+func buildIndexes(coll *mongo.Collection, models []mongo.IndexModel, after func(ctx context.Context)) {
+	for i := range models {
+		if models[i].Options == nil {
+			models[i].Options = options.Index()
+		}
+		models[i].Options.SetBackground(true)
+	}
+
+	go func() {
+		ctx, cancel := indexContext()
+		defer cancel()
+
+		names, err := coll.Indexes().CreateMany(ctx, models)
+		if mongo.IsTimeout(err) {
+			log.Printf("Index build on %s still running after INDEX_BUILD_TIMEOUT; it continues on the server", coll.Name())
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to create %s indexes: %v", coll.Name(), err)
+		}
+		log.Printf("Indexes ready on %s: %v", coll.Name(), names)
+
+		if after != nil {
+			after(ctx)
+		}
+	}()
+}
@@ -0,0 +1,807 @@
+package nftModel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps the index in process memory, selected with
+// STORAGE_BACKEND=memory. It mirrors the Mongo queries closely enough for
+// tests and demos; nothing survives a restart.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	chainID      int64
+	nfts         map[string]*NFT
+	transfers    []Transfer
+	transferKeys map[string]bool
+	progress     map[string]ScanProgress
+	contracts    map[string]*Contract
+	rawLogs      map[string]RawLog
+	deadLetters  map[string]*DeadLetter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nfts:         make(map[string]*NFT),
+		transferKeys: make(map[string]bool),
+		progress:     make(map[string]ScanProgress),
+		contracts:    make(map[string]*Contract),
+		rawLogs:      make(map[string]RawLog),
+		deadLetters:  make(map[string]*DeadLetter),
+	}
+}
+
+func nftKey(chainId int64, contractAddress string, nftId primitive.Decimal128, rawTokenId string) string {
+	return strconv.FormatInt(chainId, 10) + ":" + contractAddress + ":" + nftId.String() + ":" + rawTokenId
+}
+
+func logKey(chainId int64, txHash string, logIndex uint) string {
+	return strconv.FormatInt(chainId, 10) + ":" + txHash + ":" + strconv.FormatUint(uint64(logIndex), 10)
+}
+
+// compareNftIds orders token IDs numerically. IDs that aren't integers,
+// such as RawTokenNftID, sort first as NaN does in MongoDB.
+func compareNftIds(a, b primitive.Decimal128) int {
+	x, errX := Decimal128ToBigInt(a)
+	y, errY := Decimal128ToBigInt(b)
+	switch {
+	case errX != nil && errY != nil:
+		return 0
+	case errX != nil:
+		return -1
+	case errY != nil:
+		return 1
+	}
+	return x.Cmp(y)
+}
+
+// sortStable applies the stableSort order.
+func sortStable(nfts []NFT) {
+	sort.Slice(nfts, func(i, j int) bool {
+		if c := compareNftIds(nfts[i].NftID, nfts[j].NftID); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(nfts[i].ID[:], nfts[j].ID[:]) > 0
+	})
+}
+
+// visible applies the ListOptions filter.
+func (opts ListOptions) visible(nft *NFT) bool {
+	if !opts.IncludeUnconfirmed && !nft.Confirmed {
+		return false
+	}
+	if !opts.IncludeBurned && nft.Burned {
+		return false
+	}
+	if opts.ChainID != nil && nft.ChainID != *opts.ChainID {
+		return false
+	}
+	return true
+}
+
+func (c *PageCursor) before(nft *NFT) bool {
+	cmp := compareNftIds(nft.NftID, c.NftID)
+	return cmp < 0 || cmp == 0 && bytes.Compare(nft.ID[:], c.ID[:]) < 0
+}
+
+// page applies an offset and limit, where a limit of 0 means no limit.
+func page[T any](items []T, offset, limit int64) []T {
+	if offset >= int64(len(items)) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < int64(len(items)) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (m *MemoryStore) Init(chain int64, rawLogs bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.chainID = chain
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) BulkUpsertNFTs(ctx context.Context, nfts []NFT) (BulkResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, nft := range nfts {
+		key := nftKey(nft.ChainID, nft.ContractAddress, nft.NftID, nft.RawTokenID)
+		existing, ok := m.nfts[key]
+		if !ok {
+			existing = &NFT{
+				ID:              primitive.NewObjectID(),
+				ChainID:         nft.ChainID,
+				ContractAddress: nft.ContractAddress,
+				NftID:           nft.NftID,
+				RawTokenID:      nft.RawTokenID,
+			}
+			m.nfts[key] = existing
+		}
+		if existing.FirstSeenAt.IsZero() {
+			existing.FirstSeenAt = nft.FirstSeenAt
+		}
+		if nft.BlockNumber < existing.BlockNumber ||
+			nft.BlockNumber == existing.BlockNumber && nft.LogIndex < existing.LogIndex {
+			continue
+		}
+
+		existing.OwnerAddress = nft.OwnerAddress
+		existing.FromAddress = nft.FromAddress
+		existing.TxHash = nft.TxHash
+		existing.TimeStamp = nft.TimeStamp
+		existing.BlockNumber = nft.BlockNumber
+		existing.LogIndex = nft.LogIndex
+		existing.Confirmed = nft.Confirmed
+		existing.Burned = nft.Burned
+		existing.BurnedAt = nft.BurnedAt
+		existing.LastTransferAt = nft.LastTransferAt
+		existing.WrappedOf = nft.WrappedOf
+	}
+	return BulkResult{Succeeded: len(nfts)}, nil
+}
+
+// matchNfts returns copies of the NFTs keep accepts in stableSort order.
+func (m *MemoryStore) matchNfts(keep func(*NFT) bool) []NFT {
+	var nfts []NFT
+	for _, nft := range m.nfts {
+		if keep(nft) {
+			nfts = append(nfts, *nft)
+		}
+	}
+	sortStable(nfts)
+	return nfts
+}
+
+func (m *MemoryStore) GetAllNfts(ctx context.Context, opts ListOptions) ([]NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+	nfts := m.matchNfts(func(nft *NFT) bool {
+		return opts.visible(nft) && (opts.After == nil || opts.After.before(nft))
+	})
+	if opts.After != nil {
+		return page(nfts, 0, limit), nil
+	}
+	return page(nfts, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) StreamAllNfts(ctx context.Context, opts ListOptions, each func(NFT) error) error {
+	nfts, _ := m.GetAllNfts(ctx, opts)
+	for _, nft := range nfts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := each(nft); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) walletNfts(walletAddress string, opts ListOptions) []WalletNft {
+	nfts := m.matchNfts(func(nft *NFT) bool {
+		return nft.OwnerAddress == walletAddress && opts.visible(nft)
+	})
+
+	var walletNfts []WalletNft
+	for _, nft := range nfts {
+		walletNft := WalletNft{NFT: nft}
+		if contract, ok := m.contracts[nft.ContractAddress]; ok {
+			walletNft.Verified = contract.Verified
+			walletNft.Spam = contract.Spam
+		}
+		if opts.ExcludeSpam && walletNft.Spam {
+			continue
+		}
+		walletNfts = append(walletNfts, walletNft)
+	}
+	return walletNfts
+}
+
+func (m *MemoryStore) GetWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletNft, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+	return page(m.walletNfts(walletAddress, opts), opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) CountWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return int64(len(m.walletNfts(walletAddress, opts))), nil
+}
+
+func (m *MemoryStore) ConfirmNfts(ctx context.Context, confirmedBlock int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var confirmed int64
+	for _, nft := range m.nfts {
+		if !nft.Confirmed && int64(nft.BlockNumber) <= confirmedBlock {
+			nft.Confirmed = true
+			confirmed++
+		}
+	}
+	return confirmed, nil
+}
+
+func (m *MemoryStore) GetNftByToken(ctx context.Context, contractAddress string, key TokenKey) (*NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nft, ok := m.nfts[nftKey(m.chainID, contractAddress, key.NftID, key.RawTokenID)]
+	if !ok {
+		return nil, fmt.Errorf("nft %s #%s: %w", contractAddress, key, ErrNotFound)
+	}
+	found := *nft
+	return &found, nil
+}
+
+func (m *MemoryStore) GetNftsByTxHash(ctx context.Context, txHash string) ([]NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nfts := m.matchNfts(func(nft *NFT) bool { return nft.TxHash == txHash })
+	sort.SliceStable(nfts, func(i, j int) bool { return nfts[i].LogIndex < nfts[j].LogIndex })
+	return nfts, nil
+}
+
+func (m *MemoryStore) UpdateNftOwner(ctx context.Context, contractAddress string, key TokenKey, ownerAddress string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if nft, ok := m.nfts[nftKey(m.chainID, contractAddress, key.NftID, key.RawTokenID)]; ok {
+		nft.OwnerAddress = ownerAddress
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128, tokenUri, image string, attributes []Attribute, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nft, ok := m.nfts[nftKey(m.chainID, contractAddress, nftId, "")]
+	if !ok {
+		return nil
+	}
+	nft.TokenUri = tokenUri
+	nft.Image = image
+	nft.Attributes = attributes
+	nft.MetadataStatus = status
+	nft.MetadataFetchedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) TouchNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if nft, ok := m.nfts[nftKey(m.chainID, contractAddress, nftId, "")]; ok {
+		nft.MetadataFetchedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) MarkMetadataStale(ctx context.Context, contractAddress string, fromId primitive.Decimal128, toId *primitive.Decimal128) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, err := Decimal128ToBigInt(fromId)
+	if err != nil {
+		return 0, err
+	}
+	var to *big.Int
+	if toId != nil {
+		to, err = Decimal128ToBigInt(*toId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var marked int64
+	for _, nft := range m.nfts {
+		if nft.ChainID != m.chainID || nft.ContractAddress != contractAddress || nft.MetadataStatus == "" || nft.RawTokenID != "" {
+			continue
+		}
+		id, err := Decimal128ToBigInt(nft.NftID)
+		if err != nil || id.Cmp(from) < 0 || (to != nil && id.Cmp(to) > 0) {
+			continue
+		}
+		nft.MetadataFetchedAt = time.Time{}
+		marked++
+	}
+	return marked, nil
+}
+
+func (m *MemoryStore) GetStaleMetadata(ctx context.Context, before time.Time, limit int64) ([]NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nfts := m.matchNfts(func(nft *NFT) bool {
+		if nft.MetadataFetchedAt.IsZero() {
+			return nft.MetadataStatus != ""
+		}
+		return nft.MetadataFetchedAt.Before(before)
+	})
+	sort.SliceStable(nfts, func(i, j int) bool { return nfts[i].BlockNumber > nfts[j].BlockNumber })
+	return page(nfts, 0, limit), nil
+}
+
+func (m *MemoryStore) GetNftsUpdatedSince(ctx context.Context, since time.Time, opts ListOptions) ([]NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+	nfts := m.matchNfts(func(nft *NFT) bool {
+		return opts.visible(nft) && !nft.LastTransferAt.Before(since)
+	})
+	sort.Slice(nfts, func(i, j int) bool {
+		if !nfts[i].LastTransferAt.Equal(nfts[j].LastTransferAt) {
+			return nfts[i].LastTransferAt.Before(nfts[j].LastTransferAt)
+		}
+		return bytes.Compare(nfts[i].ID[:], nfts[j].ID[:]) < 0
+	})
+	return page(nfts, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) SearchNftsByTraits(ctx context.Context, contractAddress string, traits []Attribute, opts ListOptions) ([]NFT, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+	nfts := m.matchNfts(func(nft *NFT) bool {
+		if nft.ContractAddress != contractAddress || !opts.visible(nft) {
+			return false
+		}
+		for _, trait := range traits {
+			found := false
+			for _, attribute := range nft.Attributes {
+				if attribute == trait {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	})
+	return page(nfts, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) CountContractNfts(ctx context.Context, contractAddress string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, nft := range m.nfts {
+		if nft.ContractAddress == contractAddress && nft.OwnerAddress != ZeroAddress {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// sortCounts orders per-contract counts largest first, then by address.
+func sortCounts[T any](items []T, count func(T) int64, address func(T) string) {
+	sort.Slice(items, func(i, j int) bool {
+		if count(items[i]) != count(items[j]) {
+			return count(items[i]) > count(items[j])
+		}
+		return address(items[i]) < address(items[j])
+	})
+}
+
+func (m *MemoryStore) GetContractCounts(ctx context.Context, limit int64) ([]ContractCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totals := make(map[string]int64)
+	for _, nft := range m.nfts {
+		totals[nft.ContractAddress]++
+	}
+
+	counts := make([]ContractCount, 0, len(totals))
+	for address, count := range totals {
+		counts = append(counts, ContractCount{ContractAddress: address, Count: count})
+	}
+	sortCounts(counts,
+		func(c ContractCount) int64 { return c.Count },
+		func(c ContractCount) string { return c.ContractAddress })
+	return page(counts, 0, limit), nil
+}
+
+func (m *MemoryStore) GetWalletSummary(ctx context.Context, walletAddress string) ([]WalletContractSummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	totals := make(map[string]int64)
+	if walletAddress != ZeroAddress {
+		for _, nft := range m.nfts {
+			if nft.OwnerAddress == walletAddress {
+				totals[nft.ContractAddress]++
+			}
+		}
+	}
+
+	summary := make([]WalletContractSummary, 0, len(totals))
+	for address, count := range totals {
+		entry := WalletContractSummary{ContractAddress: address, Count: count}
+		if contract, ok := m.contracts[address]; ok {
+			entry.Name = contract.Name
+			entry.Symbol = contract.Symbol
+		}
+		summary = append(summary, entry)
+	}
+	sortCounts(summary,
+		func(s WalletContractSummary) int64 { return s.Count },
+		func(s WalletContractSummary) string { return s.ContractAddress })
+	return summary, nil
+}
+
+// WatchNftChanges has nothing to report: only this process can write to
+// its memory, and it invalidates its own caches.
+func (m *MemoryStore) WatchNftChanges(ctx context.Context, onChange func(NftChange)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (m *MemoryStore) InsertTransfers(ctx context.Context, transfers []Transfer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, transfer := range transfers {
+		key := logKey(transfer.ChainID, transfer.TxHash, transfer.LogIndex)
+		if m.transferKeys[key] {
+			continue
+		}
+		m.transferKeys[key] = true
+		if transfer.ID.IsZero() {
+			transfer.ID = primitive.NewObjectID()
+		}
+		m.transfers = append(m.transfers, transfer)
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetContractActivity(ctx context.Context, contractAddress, interval string, from, to time.Time) ([]ActivityBucket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	step := 24 * time.Hour
+	if interval == ActivityHour {
+		step = time.Hour
+	}
+
+	counts := make(map[int64]int64)
+	for _, transfer := range m.transfers {
+		if transfer.ContractAddress != contractAddress || transfer.TimeStamp.Before(from) || !transfer.TimeStamp.Before(to) {
+			continue
+		}
+		counts[transfer.TimeStamp.UTC().Truncate(step).Unix()]++
+	}
+
+	var buckets []ActivityBucket
+	for bucket := from.UTC().Truncate(step); bucket.Before(to); bucket = bucket.Add(step) {
+		buckets = append(buckets, ActivityBucket{Bucket: bucket, Count: counts[bucket.Unix()]})
+	}
+	return buckets, nil
+}
+
+// laterTransfer reports whether a comes after b in the chain.
+func laterTransfer(a, b Transfer) bool {
+	if a.BlockNumber != b.BlockNumber {
+		return a.BlockNumber > b.BlockNumber
+	}
+	return a.LogIndex > b.LogIndex
+}
+
+func (m *MemoryStore) GetWalletTransfers(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletTransfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	var transfers []WalletTransfer
+	for _, transfer := range m.transfers {
+		if opts.ChainID != nil && transfer.ChainID != *opts.ChainID {
+			continue
+		}
+		if transfer.FromAddress == walletAddress || transfer.ToAddress == walletAddress {
+			transfers = append(transfers, WalletTransfer{Transfer: transfer, Direction: transferDirection(transfer, walletAddress)})
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := transfers[i].Transfer, transfers[j].Transfer
+		if a.BlockNumber != b.BlockNumber || a.LogIndex != b.LogIndex {
+			return laterTransfer(a, b)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) > 0
+	})
+	return page(transfers, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) GetOwnerAtBlock(ctx context.Context, contractAddress string, key TokenKey, block uint64) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest *Transfer
+	for i, transfer := range m.transfers {
+		if transfer.ContractAddress != contractAddress || compareNftIds(transfer.NftID, key.NftID) != 0 || transfer.RawTokenID != key.RawTokenID || transfer.BlockNumber > block {
+			continue
+		}
+		if latest == nil || laterTransfer(transfer, *latest) {
+			latest = &m.transfers[i]
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("nft %s #%s at block %d: %w", contractAddress, key, block, ErrNotFound)
+	}
+	return latest.ToAddress, nil
+}
+
+func (m *MemoryStore) GetContractSnapshot(ctx context.Context, contractAddress string, block uint64) ([]TokenSnapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest := make(map[string]Transfer)
+	for _, transfer := range m.transfers {
+		if transfer.ContractAddress != contractAddress || transfer.BlockNumber > block {
+			continue
+		}
+		key := transfer.NftID.String() + ":" + transfer.RawTokenID
+		if current, ok := latest[key]; !ok || laterTransfer(transfer, current) {
+			latest[key] = transfer
+		}
+	}
+
+	snapshot := make([]TokenSnapshot, 0, len(latest))
+	for _, transfer := range latest {
+		if transfer.ToAddress == ZeroAddress {
+			continue
+		}
+		snapshot = append(snapshot, TokenSnapshot{NftID: transfer.NftID, RawTokenID: transfer.RawTokenID, OwnerAddress: transfer.ToAddress, BlockNumber: transfer.BlockNumber})
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if c := compareNftIds(snapshot[i].NftID, snapshot[j].NftID); c != 0 {
+			return c < 0
+		}
+		return snapshot[i].RawTokenID < snapshot[j].RawTokenID
+	})
+	return snapshot, nil
+}
+
+func (m *MemoryStore) GetMints(ctx context.Context, contractAddress string, fromBlock, toBlock uint64, opts ListOptions) ([]Transfer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	var mints []Transfer
+	for _, transfer := range m.transfers {
+		if transfer.ContractAddress == contractAddress && transfer.Mint &&
+			transfer.BlockNumber >= fromBlock && transfer.BlockNumber <= toBlock {
+			mints = append(mints, transfer)
+		}
+	}
+	sort.Slice(mints, func(i, j int) bool { return laterTransfer(mints[j], mints[i]) })
+	return page(mints, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) ApplySale(ctx context.Context, contractAddress string, nftId *primitive.Decimal128, sale Sale) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := func(txHash, address string, id primitive.Decimal128) bool {
+		if txHash != sale.TxHash {
+			return false
+		}
+		return nftId == nil || address == contractAddress && compareNftIds(id, *nftId) == 0
+	}
+
+	for i := range m.transfers {
+		if matches(m.transfers[i].TxHash, m.transfers[i].ContractAddress, m.transfers[i].NftID) {
+			transferSale := sale
+			m.transfers[i].Sale = &transferSale
+		}
+	}
+	for _, nft := range m.nfts {
+		if matches(nft.TxHash, nft.ContractAddress, nft.NftID) {
+			lastSale := sale
+			nft.LastSale = &lastSale
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetContractMarket(ctx context.Context, contractAddress string, since time.Time) ([]CurrencyMarket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var sold []Transfer
+	for _, transfer := range m.transfers {
+		if transfer.ChainID == m.chainID && transfer.ContractAddress == contractAddress && transfer.Sale != nil && !transfer.TimeStamp.Before(since) {
+			sold = append(sold, transfer)
+		}
+	}
+	return summariseSales(sold), nil
+}
+
+func (m *MemoryStore) GetScanProgress(ctx context.Context, contractAddress string) (*ScanProgress, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	progress, ok := m.progress[contractAddress]
+	if !ok {
+		return nil, nil
+	}
+	return &progress, nil
+}
+
+func (m *MemoryStore) SaveScanProgress(ctx context.Context, contractAddress string, nextBlock int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.progress[contractAddress] = ScanProgress{ContractAddress: contractAddress, NextBlock: nextBlock, UpdatedAt: time.Now()}
+	return nil
+}
+
+func (m *MemoryStore) GetIndexedBlock(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.progress) == 0 {
+		return -1, nil
+	}
+	lowest := int64(math.MaxInt64)
+	for _, progress := range m.progress {
+		lowest = min(lowest, progress.NextBlock)
+	}
+	return lowest - 1, nil
+}
+
+// contract returns the record for address, creating it as the Mongo
+// upserts do.
+func (m *MemoryStore) contract(address string) *Contract {
+	contract, ok := m.contracts[address]
+	if !ok {
+		contract = &Contract{Address: address}
+		m.contracts[address] = contract
+	}
+	contract.UpdatedAt = time.Now()
+	return contract
+}
+
+func (m *MemoryStore) UpsertContractInfo(ctx context.Context, address, name, symbol string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	contract := m.contract(address)
+	contract.Name = name
+	contract.Symbol = symbol
+	return nil
+}
+
+func (m *MemoryStore) SetContractFlags(ctx context.Context, address string, verified, spam bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	contract := m.contract(address)
+	contract.Verified = verified
+	contract.Spam = spam
+	return nil
+}
+
+func (m *MemoryStore) SetContractPaused(ctx context.Context, address string, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.contract(address).Paused = paused
+	return nil
+}
+
+func (m *MemoryStore) GetPausedContracts(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var addresses []string
+	for address, contract := range m.contracts {
+		if contract.Paused {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+func (m *MemoryStore) InsertRawLog(ctx context.Context, rawLog RawLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := logKey(m.chainID, rawLog.TxHash, rawLog.LogIndex)
+	if _, ok := m.rawLogs[key]; !ok {
+		m.rawLogs[key] = rawLog
+	}
+	return nil
+}
+
+func (m *MemoryStore) SaveDeadLetter(ctx context.Context, rawLog RawLog, cause string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := logKey(m.chainID, rawLog.TxHash, rawLog.LogIndex)
+	letter, ok := m.deadLetters[key]
+	if !ok {
+		letter = &DeadLetter{ID: primitive.NewObjectID(), ChainID: m.chainID}
+		m.deadLetters[key] = letter
+	}
+	letter.Log = rawLog
+	letter.Error = cause
+	letter.Attempts++
+	letter.FailedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) GetDeadLetters(ctx context.Context, opts ListOptions) ([]DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	letters := []DeadLetter{}
+	for _, letter := range m.deadLetters {
+		letters = append(letters, *letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.After(letters[j].FailedAt)
+		}
+		return letters[i].ID.Hex() > letters[j].ID.Hex()
+	})
+	return page(letters, opts.Offset, limit), nil
+}
+
+func (m *MemoryStore) GetDeadLetter(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, letter := range m.deadLetters {
+		if letter.ID == id {
+			found := *letter
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, letter := range m.deadLetters {
+		if letter.ID == id {
+			delete(m.deadLetters, key)
+		}
+	}
+	return nil
+}
@@ -3,9 +3,11 @@ package nftModel
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"math/big"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/aman/nft-tracker/pkg/config"
@@ -17,115 +19,524 @@ import (
 
 var collection *mongo.Collection
 
+// chainID is the chain this instance indexes, set by Init. Single-token
+// writes that don't carry a full record are scoped to it.
+var chainID int64
+
+// readCollection serves the heavy list queries and may read from a
+// secondary.
+var readCollection *mongo.Collection
+
+const ZeroAddress = "0x0000000000000000000000000000000000000000"
+
+const defaultMaxPageSize = 1000
+
 type NFT struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty"`
-	NftID           int                `bson:"nftId,unique"`
-	OwnerAddress    string             `bson:"ownerAddress"`
-	ContractAddress string             `bson:"contractAddress"`
-	TokenUri        string             `bson:"tokenUri"`
-	TxHash          string             `bson:"txHash,unique"`
-	TimeStamp       time.Time          `bson:"timestamp"`
+	ID           primitive.ObjectID   `bson:"_id,omitempty"`
+	NftID        primitive.Decimal128 `bson:"nftId,unique"`
+	OwnerAddress string               `bson:"ownerAddress"`
+	// FromAddress is the previous owner, from the transfer the record
+	// reflects; kept unless STORE_FIELDS leaves out fromAddress.
+	FromAddress     string `bson:"fromAddress,omitempty"`
+	ContractAddress string `bson:"contractAddress"`
+	TokenUri        string `bson:"tokenUri"`
+	// Image is the image URI from the token's metadata document.
+	Image       string    `bson:"image,omitempty"`
+	TxHash      string    `bson:"txHash,unique"`
+	TimeStamp   time.Time `bson:"timestamp"`
+	BlockNumber uint64    `bson:"blockNumber"`
+	LogIndex    uint      `bson:"logIndex"`
+	// BlockHash is the hash of the block the update was read from. It is
+	// only used to check unconfirmed updates against reorgs and isn't
+	// stored.
+	BlockHash      string      `bson:"-" json:"-"`
+	Confirmed      bool        `bson:"confirmed"`
+	Attributes     []Attribute `bson:"attributes,omitempty"`
+	MetadataStatus string      `bson:"metadataStatus,omitempty"`
+	// MetadataFetchedAt is when metadata was last attempted.
+	MetadataFetchedAt time.Time `bson:"metadataFetchedAt,omitempty"`
+	LastSale          *Sale     `bson:"lastSale,omitempty"`
+	// Burned is set once the token's latest transfer went to the zero
+	// address. The record and its history are kept; list queries hide it.
+	Burned   bool       `bson:"burned"`
+	BurnedAt *time.Time `bson:"burnedAt,omitempty"`
+	// RawTokenID holds the topic hex for tokens whose identifier isn't a
+	// usable integer; their NftID is RawTokenNftID.
+	RawTokenID string `bson:"rawTokenId,omitempty"`
+	ChainID    int64  `bson:"chainId"`
+	// FirstSeenAt is when the tracker first indexed the token and is never
+	// overwritten. LastTransferAt is the block time of the transfer the
+	// record currently reflects.
+	FirstSeenAt    time.Time `bson:"firstSeenAt,omitempty"`
+	LastTransferAt time.Time `bson:"lastTransferAt,omitempty"`
+	// WrappedOf is the original token when WRAPPED_TOKENS lists this one
+	// as a wrapped or bridged copy.
+	WrappedOf *TokenRef `bson:"wrappedOf,omitempty"`
+}
+
+// RawTokenNftID is the nftId stored for tokens identified by RawTokenID
+// instead, such as contracts that emit a hash as the token ID.
+var RawTokenNftID = primitive.NewDecimal128(0x7c00000000000000, 0)
+
+const (
+	MetadataOK          = "ok"
+	MetadataInvalid     = "invalid"
+	MetadataUnreachable = "unreachable"
+	// MetadataURIOnly marks tokens whose tokenURI was stored without
+	// fetching the document, as STORE_FIELDS asked.
+	MetadataURIOnly = "uriOnly"
+	// MetadataBlocked marks tokens whose tokenURI or image is on a host
+	// METADATA_DENYLIST names; nothing was fetched from it.
+	MetadataBlocked = "blocked"
+)
+
+// TokenRef names a token, possibly on another chain.
+type TokenRef struct {
+	ChainID         int64  `bson:"chainId,omitempty" json:"chainId,omitempty"`
+	ContractAddress string `bson:"contractAddress" json:"contractAddress"`
+	TokenID         string `bson:"tokenId" json:"tokenId"`
+}
+
+type Attribute struct {
+	TraitType string `bson:"trait_type" json:"trait_type"`
+	Value     string `bson:"value" json:"value"`
 }
 
 func GetNftCollection() *mongo.Collection {
-	collection = config.GetCollection(os.Getenv("DB_NAME"), "NFT")
+	collection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("NFT_COLLECTION", "NFT"))
+	readCollection = config.GetReadCollection(os.Getenv("DB_NAME"), collectionName("NFT_COLLECTION", "NFT"))
 	return collection
 }
 
 func CreateIndexes() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := indexContext()
 	defer cancel()
 
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"nftId": 1},
-		Options: options.Index().SetUnique(true),
+	// Token IDs are only unique within a contract, so drop the old
+	// nftId-only index left over from earlier deployments.
+	if _, err := collection.Indexes().DropOne(ctx, "nftId_1"); err == nil {
+		log.Println("Dropped legacy unique index on nftId")
 	}
 
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+	convertLegacyNftIds(ctx, collection)
+	stampLegacyChainID(ctx, collection)
+
+	indexModels := []mongo.IndexModel{
+		// rawTokenId is missing, and so indexed as null, on ordinary tokens,
+		// so they stay unique per chain, contract and nftId.
+		{
+			Keys:    bson.D{{Key: "chainId", Value: 1}, {Key: "contractAddress", Value: 1}, {Key: "nftId", Value: 1}, {Key: "rawTokenId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "confirmed", Value: 1}, {Key: "blockNumber", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"confirmed": false}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "contractAddress", Value: 1},
+				{Key: "attributes.trait_type", Value: 1},
+				{Key: "attributes.value", Value: 1},
+			},
+		},
+		{Keys: bson.M{"metadataFetchedAt": 1}},
+		// Serves GetNftsUpdatedSince in its sort order.
+		{Keys: bson.D{{Key: "lastTransferAt", Value: 1}, {Key: "_id", Value: 1}}},
+		// Sales are correlated with their NFTs by transaction, and lookups by
+		// transaction return every token it moved, so this must not be unique.
+		{Keys: bson.M{"txHash": 1}},
+	}
+
+	buildIndexes(collection, indexModels, func(ctx context.Context) {
+		for _, name := range []string{"contractAddress_1_nftId_1", "contractAddress_1_nftId_1_rawTokenId_1"} {
+			if _, err := collection.Indexes().DropOne(ctx, name); err == nil {
+				log.Printf("Dropped superseded unique index %s", name)
+			}
+		}
+	})
+}
+
+// stampLegacyChainID assigns records written before chain IDs were stored
+// to the chain this instance indexes.
+func stampLegacyChainID(ctx context.Context, coll *mongo.Collection) {
+	result, err := coll.UpdateMany(ctx, bson.M{"chainId": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"chainId": chainID}})
 	if err != nil {
-		log.Fatalf("Failed to create index: %v", err)
+		log.Fatalf("Failed to stamp chain ID on %s: %v", coll.Name(), err)
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Stamped chain ID %d on %d legacy records in %s", chainID, result.ModifiedCount, coll.Name())
 	}
+}
+
+// convertLegacyNftIds rewrites token IDs stored as plain integers by older
+// versions so every record decodes into Decimal128.
+func convertLegacyNftIds(ctx context.Context, coll *mongo.Collection) {
+	legacyIds := bson.M{"nftId": bson.M{"$type": bson.A{"int", "long"}}}
+	toDecimal := mongo.Pipeline{{{Key: "$set", Value: bson.M{"nftId": bson.M{"$toDecimal": "$nftId"}}}}}
 
-	log.Println("Unique index created on nftId")
+	result, err := coll.UpdateMany(ctx, legacyIds, toDecimal)
+	if err != nil {
+		log.Fatalf("Failed to convert legacy nftIds in %s: %v", coll.Name(), err)
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Converted %d legacy nftIds in %s to Decimal128", result.ModifiedCount, coll.Name())
+	}
 }
 
-func (nft *NFT) CreateUpdateNFT() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (nft *NFT) upsertFilter() bson.M {
+	filter := bson.M{"chainId": nft.ChainID, "contractAddress": nft.ContractAddress, "nftId": nft.NftID}
+	if nft.RawTokenID != "" {
+		filter["rawTokenId"] = nft.RawTokenID
+	}
+	return filter
+}
 
-	filter := bson.M{"nftId": nft.NftID}
-	update := bson.M{
-		"$set": bson.M{
-			"ownerAddress":    nft.OwnerAddress,
-			"contractAddress": nft.ContractAddress,
-			"txHash":          nft.TxHash,
-			"timeStamp":       nft.TimeStamp,
-		},
-		"$setOnInsert": bson.M{
-			"nftId": nft.NftID,
-		},
+// upsertUpdate only applies the transfer when it is at or after the last
+// event applied to the record, so replaying an old block range can never
+// roll ownership back.
+func (nft *NFT) upsertUpdate() mongo.Pipeline {
+	lastBlock := bson.M{"$ifNull": bson.A{"$blockNumber", -1}}
+	lastLogIndex := bson.M{"$ifNull": bson.A{"$logIndex", -1}}
+	isNewer := bson.M{"$or": bson.A{
+		bson.M{"$gt": bson.A{nft.BlockNumber, lastBlock}},
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{nft.BlockNumber, lastBlock}},
+			bson.M{"$gte": bson.A{nft.LogIndex, lastLogIndex}},
+		}},
+	}}
+
+	fields := bson.D{
+		{Key: "ownerAddress", Value: nft.OwnerAddress},
+		{Key: "txHash", Value: nft.TxHash},
+		{Key: "timeStamp", Value: nft.TimeStamp},
+		{Key: "blockNumber", Value: nft.BlockNumber},
+		{Key: "logIndex", Value: nft.LogIndex},
+		{Key: "confirmed", Value: nft.Confirmed},
+		{Key: "burned", Value: nft.Burned},
+		{Key: "burnedAt", Value: nft.BurnedAt},
+		{Key: "lastTransferAt", Value: nft.LastTransferAt},
+		{Key: "wrappedOf", Value: nft.WrappedOf},
+	}
+
+	set := make(bson.D, 0, len(fields)+2)
+	for _, field := range fields {
+		set = append(set, bson.E{Key: field.Key, Value: bson.M{
+			"$cond": bson.A{isNewer, bson.M{"$literal": field.Value}, "$" + field.Key},
+		}})
 	}
+	// Without fromAddress in STORE_FIELDS the field is removed rather than
+	// written empty; a value from before would name the wrong previous
+	// owner once the token moves on.
+	var from interface{} = "$$REMOVE"
+	if nft.FromAddress != "" {
+		from = bson.M{"$literal": nft.FromAddress}
+	}
+	set = append(set, bson.E{Key: "fromAddress", Value: bson.M{
+		"$cond": bson.A{isNewer, from, "$fromAddress"},
+	}})
+	// Pipeline updates can't use $setOnInsert; keeping any existing value
+	// does the same job, and also fills it in on records created by an
+	// early metadata write.
+	set = append(set, bson.E{Key: "firstSeenAt", Value: bson.M{
+		"$ifNull": bson.A{"$firstSeenAt", bson.M{"$literal": nft.FirstSeenAt}},
+	}})
+
+	return mongo.Pipeline{{{Key: "$set", Value: set}}}
+}
 
-	opts := options.Update().SetUpsert(true)
-	_, err := collection.UpdateOne(ctx, filter, update, opts)
+func (nft *NFT) CreateUpdateNFT(ctx context.Context) error {
+	result, err := store.BulkUpsertNFTs(ctx, []NFT{*nft})
 	if err != nil {
-		log.Printf("Failed to insert NFT data into MongoDB: %v", err)
 		return err
 	}
+	if len(result.Failed) > 0 {
+		return result.Failed[0].Err
+	}
 	return nil
 }
 
-func GetAllNfts() ([]NFT, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// FailedUpsert is an NFT whose upsert kept failing after its retries. Index
+// is its position in the batch passed to BulkUpsertNFTs.
+type FailedUpsert struct {
+	Index int
+	NFT   NFT
+	Err   error
+}
+
+// BulkResult summarises a BulkUpsertNFTs call.
+type BulkResult struct {
+	Succeeded int
+	Failed    []FailedUpsert
+}
+
+const bulkRetryBackoff = 200 * time.Millisecond
+
+// BulkUpsertNFTs writes a batch of NFTs in a single ordered BulkWrite, so
+// repeated transfers of the same token within a batch apply in sequence.
+//
+// An ordered write stops at its first failing upsert. Everything before it
+// is kept, and the write resumes from the failing upsert after a backoff;
+// once that upsert has used up BULK_WRITE_RETRIES it is reported in the
+// result's Failed list and skipped. An error is only returned when the
+// outcome of the batch is unknown, such as a lost connection or a write
+// concern error, and the whole batch should be retried.
+func (m MongoStore) BulkUpsertNFTs(ctx context.Context, nfts []NFT) (BulkResult, error) {
+	var result BulkResult
+	if len(nfts) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	retries := m.bulkWriteRetries
+	opts := options.BulkWrite().SetOrdered(true)
+	lastFailed, attempts := -1, 0
+	for start := 0; start < len(nfts); {
+		models := make([]mongo.WriteModel, 0, len(nfts)-start)
+		for i := start; i < len(nfts); i++ {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(nfts[i].upsertFilter()).
+				SetUpdate(nfts[i].upsertUpdate()).
+				SetUpsert(true))
+		}
+
+		_, err := collection.BulkWrite(ctx, models, opts)
+		if err == nil {
+			result.Succeeded += len(models)
+			break
+		}
+
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			log.Printf("Failed to bulk upsert NFT data into MongoDB: %v", err)
+			return result, err
+		}
+
+		writeErr := bulkErr.WriteErrors[0]
+		failed := start + writeErr.Index
+		result.Succeeded += writeErr.Index
+		start = failed
+		if failed != lastFailed {
+			lastFailed, attempts = failed, 0
+		}
+		attempts++
+
+		if attempts > retries {
+			log.Printf("Giving up on NFT upsert for %s/%s after %d attempts: %v", nfts[failed].ContractAddress, nfts[failed].NftID, attempts, writeErr)
+			result.Failed = append(result.Failed, FailedUpsert{Index: failed, NFT: nfts[failed], Err: writeErr})
+			start++
+			continue
+		}
+
+		backoff := bulkRetryBackoff << (attempts - 1)
+		log.Printf("NFT upsert %d of %d failed, retrying in %s: %v", failed+1, len(nfts), backoff, writeErr)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, fmt.Errorf("bulk upsert NFTs: %w", ctx.Err())
+		}
+	}
+	return result, nil
+}
+
+// MaxPageSize is the most documents a single list query may return,
+// configured with MAX_PAGE_SIZE.
+func MaxPageSize() int64 {
+	max, err := strconv.ParseInt(os.Getenv("MAX_PAGE_SIZE"), 10, 64)
+	if err != nil || max <= 0 {
+		return defaultMaxPageSize
+	}
+	return max
+}
+
+// ClampLimit applies the MaxPageSize cap to a requested limit. A limit of 0
+// means "as many as allowed". The second result reports whether the
+// request was reduced.
+func ClampLimit(limit int64) (int64, bool) {
+	max := MaxPageSize()
+	if limit <= 0 {
+		return max, false
+	}
+	if limit > max {
+		return max, true
+	}
+	return limit, false
+}
+
+// stableSort orders the NFT lists. Token IDs repeat across contracts, so _id
+// breaks ties; without it, records sharing an nftId can come back in a
+// different order per query and be skipped or repeated across pages.
+var stableSort = bson.D{{Key: "nftId", Value: -1}, {Key: "_id", Value: -1}}
+
+// ListOptions controls paging and the default visibility filters applied
+// by the list queries.
+type ListOptions struct {
+	Limit              int64
+	Offset             int64
+	IncludeUnconfirmed bool
+	// ExcludeSpam drops NFTs from contracts flagged as spam. Only the
+	// wallet query supports it.
+	ExcludeSpam bool
+	// After continues from a previous page and takes the place of Offset.
+	After *PageCursor
+	// IncludeBurned brings back tokens whose latest transfer burned them.
+	IncludeBurned bool
+	// ChainID restricts the results to one chain when set.
+	ChainID *int64
+}
+
+func (opts ListOptions) filter(base bson.M) bson.M {
+	if !opts.IncludeUnconfirmed {
+		// Records written before confirmations were tracked have no
+		// confirmed field and count as confirmed.
+		base["confirmed"] = bson.M{"$ne": false}
+	}
+	if !opts.IncludeBurned {
+		base["burned"] = bson.M{"$ne": true}
+	}
+	if opts.ChainID != nil {
+		base["chainId"] = *opts.ChainID
+	}
+	return base
+}
+
+func (m MongoStore) GetAllNfts(ctx context.Context, opts ListOptions) ([]NFT, error) {
+	var Nfts []NFT
+	err := m.StreamAllNfts(ctx, opts, func(nft NFT) error {
+		Nfts = append(Nfts, nft)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Nfts, nil
+}
+
+// StreamAllNfts runs the GetAllNfts query and hands each record to each as
+// it is decoded, stopping at the first error each returns. The query
+// timeout applies to each batch rather than the whole stream, as a slow
+// client holds the cursor open for as long as it takes to read the page.
+func (MongoStore) StreamAllNfts(ctx context.Context, opts ListOptions, each func(NFT) error) error {
+	limit, _ := ClampLimit(opts.Limit)
+
+	filter := bson.M{}
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{"nftId", -1}})
+	findOptions.SetSort(stableSort)
+	findOptions.SetLimit(limit)
+	if opts.After != nil {
+		filter = opts.After.filter()
+	} else if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
 
-	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	findCtx, cancel := queryContext(ctx)
+	cursor, err := readCollection.Find(findCtx, opts.filter(filter), findOptions)
+	cancel()
 	if err != nil {
 		log.Printf("Failed to find documents: %v", err)
-		return nil, err
+		return fmt.Errorf("list nfts: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var Nfts []NFT
-	for cursor.Next(ctx) {
+	next := func() bool {
+		batchCtx, cancel := queryContext(ctx)
+		defer cancel()
+		return cursor.Next(batchCtx)
+	}
+	for next() {
 		var nft NFT
 		if err := cursor.Decode(&nft); err != nil {
 			log.Printf("Failed to decode document: %v", err)
-			return nil, err
+			return fmt.Errorf("list nfts: decode: %w", err)
+		}
+		if err := each(nft); err != nil {
+			return err
 		}
-		Nfts = append(Nfts, nft)
 	}
 	if err := cursor.Err(); err != nil {
 		log.Printf("Cursor error: %v", err)
-		return nil, err
+		return fmt.Errorf("list nfts: cursor: %w", err)
 	}
 
-	return Nfts, nil
+	return nil
+}
+
+// WalletNft is an NFT with the verified/spam flags of its contract joined
+// in from the contracts collection.
+type WalletNft struct {
+	NFT      `bson:",inline"`
+	Verified bool `bson:"verified"`
+	Spam     bool `bson:"spam"`
+}
+
+// walletPipeline matches a wallet's tokens and joins in their contract
+// flags. With paged set it also applies the page's skip and limit, as early
+// as possible: straight after the sort, so only one page is joined, unless
+// the spam filter needs the join first.
+func walletPipeline(walletAddress string, opts ListOptions, paged bool) mongo.Pipeline {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: opts.filter(bson.M{"ownerAddress": walletAddress})}},
+		{{Key: "$sort", Value: stableSort}},
+	}
+	if paged && !opts.ExcludeSpam {
+		pipeline = append(pipeline, opts.page()...)
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         contractCollection.Name(),
+			"localField":   "contractAddress",
+			"foreignField": "address",
+			"as":           "contract",
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.M{
+			"verified": bson.M{"$ifNull": bson.A{bson.M{"$first": "$contract.verified"}, false}},
+			"spam":     bson.M{"$ifNull": bson.A{bson.M{"$first": "$contract.spam"}, false}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{"contract": 0}}},
+	)
+	if opts.ExcludeSpam {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"spam": false}}})
+		if paged {
+			pipeline = append(pipeline, opts.page()...)
+		}
+	}
+	return pipeline
 }
 
-func GetWalletNfts(walletAddress string) ([]NFT, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// page is the $skip and $limit stages for opts. The limit is clamped to
+// MAX_PAGE_SIZE, so a page is bounded even when no limit was given.
+func (opts ListOptions) page() mongo.Pipeline {
+	limit, _ := ClampLimit(opts.Limit)
+
+	var stages mongo.Pipeline
+	if opts.Offset > 0 {
+		stages = append(stages, bson.D{{Key: "$skip", Value: opts.Offset}})
+	}
+	return append(stages, bson.D{{Key: "$limit", Value: limit}})
+}
+
+// GetWalletNfts returns one page of a wallet's tokens; CountWalletNfts has
+// the total.
+func (MongoStore) GetWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletNft, error) {
+	ctx, cancel := queryContext(ctx)
 	defer cancel()
 
-	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{"nftId", -1}})
+	pipeline := walletPipeline(walletAddress, opts, true)
 
-	cursor, err := collection.Find(ctx, bson.M{"ownerAddress": walletAddress}, findOptions)
+	cursor, err := readCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		log.Printf("Failed to find documents: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("list wallet nfts: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	var Nfts []NFT
+	var Nfts []WalletNft
 	for cursor.Next(ctx) {
-		var nft NFT
+		var nft WalletNft
 		if err := cursor.Decode(&nft); err != nil {
 			log.Printf("Failed to decode document: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("list wallet nfts: decode: %w", err)
 		}
 
 		Nfts = append(Nfts, nft)
@@ -133,19 +544,526 @@ func GetWalletNfts(walletAddress string) ([]NFT, error) {
 
 	if err := cursor.Err(); err != nil {
 		log.Printf("Cursor error: %v", err)
+		return nil, fmt.Errorf("list wallet nfts: cursor: %w", err)
+	}
+
+	return Nfts, nil
+}
+
+// CountWalletNfts counts the tokens GetWalletNfts would page through with
+// the same visibility options. When spam isn't excluded this is a plain
+// CountDocuments on the match filter.
+func (MongoStore) CountWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	if !opts.ExcludeSpam {
+		count, err := readCollection.CountDocuments(ctx, opts.filter(bson.M{"ownerAddress": walletAddress}))
+		if err != nil {
+			log.Printf("Failed to count documents: %v", err)
+			return 0, fmt.Errorf("count wallet nfts: %w", err)
+		}
+		return count, nil
+	}
+
+	pipeline := append(walletPipeline(walletAddress, opts, false), bson.D{{Key: "$count", Value: "total"}})
+	cursor, err := readCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to count documents: %v", err)
+		return 0, fmt.Errorf("count wallet nfts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		log.Printf("Failed to decode count: %v", err)
+		return 0, fmt.Errorf("count wallet nfts: decode: %w", err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
+
+// ConfirmNfts promotes records whose block is at or below confirmedBlock.
+func (MongoStore) ConfirmNfts(ctx context.Context, confirmedBlock int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"confirmed": false, "blockNumber": bson.M{"$lte": confirmedBlock}}
+	update := bson.M{"$set": bson.M{"confirmed": true}}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to confirm NFTs: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (MongoStore) GetNftByToken(ctx context.Context, contractAddress string, key TokenKey) (*NFT, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	var nft NFT
+	err := collection.FindOne(ctx, key.filter(bson.M{"contractAddress": contractAddress})).Decode(&nft)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("nft %s #%s: %w", contractAddress, key, ErrNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to find document: %v", err)
+		return nil, fmt.Errorf("find nft %s #%s: %w", contractAddress, key, err)
+	}
+
+	return &nft, nil
+}
+
+// GetNftsByTxHash returns the tokens whose current record was written by
+// txHash. A single transaction can move several tokens.
+func (MongoStore) GetNftsByTxHash(ctx context.Context, txHash string) ([]NFT, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"txHash": txHash}, options.Find().SetSort(bson.D{{Key: "logIndex", Value: 1}}))
+	if err != nil {
+		log.Printf("Failed to find documents: %v", err)
+		return nil, fmt.Errorf("find nfts for tx %s: %w", txHash, err)
+	}
+	defer cursor.Close(ctx)
+
+	var nfts []NFT
+	err = cursor.All(ctx, &nfts)
+	if err != nil {
+		log.Printf("Failed to decode documents: %v", err)
+		return nil, fmt.Errorf("find nfts for tx %s: decode: %w", txHash, err)
+	}
+	return nfts, nil
+}
+
+func (MongoStore) UpdateNftOwner(ctx context.Context, contractAddress string, key TokenKey, ownerAddress string) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := key.filter(bson.M{"chainId": chainID, "contractAddress": contractAddress})
+	update := bson.M{"$set": bson.M{"ownerAddress": ownerAddress}}
+
+	_, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to update NFT owner: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateNftMetadata stores a token's fetched metadata. It only updates an
+// existing record: the tracker queues the fetch once the transfer batch is
+// written, so the record is already there.
+func (MongoStore) UpdateNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128, tokenUri, image string, attributes []Attribute, status string) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"chainId": chainID, "contractAddress": contractAddress, "nftId": nftId}
+	update := bson.M{
+		"$set": bson.M{
+			"tokenUri":          tokenUri,
+			"image":             image,
+			"attributes":        attributes,
+			"metadataStatus":    status,
+			"metadataFetchedAt": time.Now(),
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to update NFT metadata: %v", err)
+		return err
+	}
+	return nil
+}
+
+// TouchNftMetadata records a metadata attempt without changing the stored
+// metadata, so a failed refresh keeps the last good copy.
+func (MongoStore) TouchNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"chainId": chainID, "contractAddress": contractAddress, "nftId": nftId}
+	update := bson.M{"$set": bson.M{"metadataFetchedAt": time.Now()}}
+
+	_, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to update NFT metadata timestamp: %v", err)
+		return err
+	}
+	return nil
+}
+
+// MarkMetadataStale clears the fetch time of the fetched tokens from fromId
+// to toId inclusive, so the metadata refresher takes them next. A nil toId
+// has no upper bound.
+func (MongoStore) MarkMetadataStale(ctx context.Context, contractAddress string, fromId primitive.Decimal128, toId *primitive.Decimal128) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	idRange := bson.M{"$gte": fromId}
+	if toId != nil {
+		idRange["$lte"] = *toId
+	}
+	filter := bson.M{
+		"chainId":         chainID,
+		"contractAddress": contractAddress,
+		"nftId":           idRange,
+		"metadataStatus":  bson.M{"$exists": true},
+	}
+	update := bson.M{"$unset": bson.M{"metadataFetchedAt": ""}}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to mark NFT metadata stale: %v", err)
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+// GetStaleMetadata returns up to limit tokens whose metadata was last
+// fetched before the given time, most recently transferred first. Records
+// from before fetch times were tracked count as stale.
+func (MongoStore) GetStaleMetadata(ctx context.Context, before time.Time, limit int64) ([]NFT, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"metadataFetchedAt": bson.M{"$lt": before}},
+		bson.M{"metadataStatus": bson.M{"$exists": true}, "metadataFetchedAt": bson.M{"$exists": false}},
+	}}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "blockNumber", Value: -1}}).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find stale metadata: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var nfts []NFT
+	err = cursor.All(ctx, &nfts)
+	if err != nil {
+		log.Printf("Failed to decode stale metadata: %v", err)
+		return nil, err
+	}
+	return nfts, nil
+}
+
+// GetNftsUpdatedSince returns one page of the records whose latest
+// transfer happened at or after since, oldest first, so a client can mirror
+// the index by pulling from the last lastTransferAt it saw.
+func (MongoStore) GetNftsUpdatedSince(ctx context.Context, since time.Time, opts ListOptions) ([]NFT, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	filter := opts.filter(bson.M{"lastTransferAt": bson.M{"$gte": since}})
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "lastTransferAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+	if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find updated NFTs: %v", err)
+		return nil, fmt.Errorf("find nfts updated since %s: %w", since.Format(time.RFC3339), err)
+	}
+	defer cursor.Close(ctx)
+
+	nfts := []NFT{}
+	err = cursor.All(ctx, &nfts)
+	if err != nil {
+		log.Printf("Failed to decode updated NFTs: %v", err)
+		return nil, fmt.Errorf("find nfts updated since %s: decode: %w", since.Format(time.RFC3339), err)
+	}
+	return nfts, nil
+}
+
+// SearchNftsByTraits returns one page of a contract's tokens carrying every
+// given trait.
+func (MongoStore) SearchNftsByTraits(ctx context.Context, contractAddress string, traits []Attribute, opts ListOptions) ([]NFT, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	constraints := make(bson.A, 0, len(traits))
+	for _, trait := range traits {
+		constraints = append(constraints, bson.M{
+			"attributes": bson.M{"$elemMatch": bson.M{
+				"trait_type": trait.TraitType,
+				"value":      trait.Value,
+			}},
+		})
+	}
+
+	filter := opts.filter(bson.M{"contractAddress": contractAddress})
+	if len(constraints) > 0 {
+		filter["$and"] = constraints
+	}
+
+	findOptions := options.Find().SetSort(stableSort).SetLimit(limit)
+	if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find documents: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var Nfts []NFT
+	err = cursor.All(ctx, &Nfts)
+	if err != nil {
+		log.Printf("Failed to decode documents: %v", err)
 		return nil, err
 	}
 
 	return Nfts, nil
 }
 
-// Helper function to convert big.Int to int
+func (MongoStore) CountContractNfts(ctx context.Context, contractAddress string) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"contractAddress": contractAddress,
+		"ownerAddress":    bson.M{"$ne": ZeroAddress},
+	}
+
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Failed to count documents: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+type ContractCount struct {
+	ContractAddress string `bson:"_id" json:"contractAddress"`
+	Count           int64  `bson:"count" json:"count"`
+}
+
+// GetContractCounts lists every contract seen in the index with its token
+// count, largest first. A limit of 0 returns all contracts.
+func (MongoStore) GetContractCounts(ctx context.Context, limit int64) ([]ContractCount, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$contractAddress", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate contract counts: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var counts []ContractCount
+	err = cursor.All(ctx, &counts)
+	if err != nil {
+		log.Printf("Failed to decode contract counts: %v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+type WalletContractSummary struct {
+	ContractAddress string `bson:"_id" json:"contractAddress"`
+	Name            string `bson:"name,omitempty" json:"name,omitempty"`
+	Symbol          string `bson:"symbol,omitempty" json:"symbol,omitempty"`
+	Count           int64  `bson:"count" json:"count"`
+}
+
+// GetWalletSummary breaks a wallet's holdings down per contract, joining in
+// the contract name and symbol when the contracts collection has them.
+func (MongoStore) GetWalletSummary(ctx context.Context, walletAddress string) ([]WalletContractSummary, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": bson.A{
+			bson.M{"ownerAddress": walletAddress},
+			bson.M{"ownerAddress": bson.M{"$ne": ZeroAddress}},
+		}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$contractAddress", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         contractCollection.Name(),
+			"localField":   "_id",
+			"foreignField": "address",
+			"as":           "contract",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"count":  1,
+			"name":   bson.M{"$first": "$contract.name"},
+			"symbol": bson.M{"$first": "$contract.symbol"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate wallet summary: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var summary []WalletContractSummary
+	err = cursor.All(ctx, &summary)
+	if err != nil {
+		log.Printf("Failed to decode wallet summary: %v", err)
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// BigIntToDecimal128 converts a token ID for storage. Decimal128 holds 34
+// significant digits, so IDs beyond that (typically hash-derived ones) are
+// rejected rather than silently rounded.
+func BigIntToDecimal128(b *big.Int) (primitive.Decimal128, error) {
+	if b == nil || b.Sign() < 0 {
+		return primitive.Decimal128{}, errors.New("token ID must be a non-negative integer")
+	}
+
+	d, err := primitive.ParseDecimal128(b.String())
+	if err != nil {
+		return primitive.Decimal128{}, fmt.Errorf("token ID %s does not fit in Decimal128", b.String())
+	}
+
+	roundTrip, exp, err := d.BigInt()
+	if err != nil || roundTrip.Mul(roundTrip, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)).Cmp(b) != 0 {
+		return primitive.Decimal128{}, fmt.Errorf("token ID %s does not fit in Decimal128 exactly", b.String())
+	}
+
+	return d, nil
+}
+
+// Decimal128ToBigInt converts a stored token ID back for contract calls.
+func Decimal128ToBigInt(d primitive.Decimal128) (*big.Int, error) {
+	b, exp, err := d.BigInt()
+	if err != nil {
+		return nil, err
+	}
+	if exp > 0 {
+		b.Mul(b, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+	} else if exp < 0 {
+		return nil, fmt.Errorf("token ID %s is not an integer", d.String())
+	}
+	return b, nil
+}
+
+// TokenKey is how a token is stored within its contract. IDs that don't fit
+// Decimal128 are stored as RawTokenNftID, which all such tokens share, and
+// told apart by RawTokenID, the ID as 32-byte hex.
+type TokenKey struct {
+	NftID      primitive.Decimal128
+	RawTokenID string
+}
+
+// KeyForTokenID returns the key tokenId is stored under. Only IDs a
+// contract can emit, up to 2^256-1, have one.
+func KeyForTokenID(tokenId *big.Int) (TokenKey, error) {
+	nftId, err := BigIntToDecimal128(tokenId)
+	if err == nil {
+		return TokenKey{NftID: nftId}, nil
+	}
+	if tokenId.Sign() < 0 || tokenId.BitLen() > 256 {
+		return TokenKey{}, err
+	}
+	return TokenKey{NftID: RawTokenNftID, RawTokenID: fmt.Sprintf("0x%064x", tokenId)}, nil
+}
+
+func (k TokenKey) String() string {
+	if k.RawTokenID != "" {
+		return k.RawTokenID
+	}
+	return k.NftID.String()
+}
+
+// filter adds the key's fields to a query on the nfts or transfers
+// collection.
+func (k TokenKey) filter(filter bson.M) bson.M {
+	filter["nftId"] = k.NftID
+	if k.RawTokenID != "" {
+		filter["rawTokenId"] = k.RawTokenID
+	}
+	return filter
+}
+
+// BigIntToInt converts small integers such as counts and offsets.
+//
+// Deprecated: token IDs routinely exceed the int range; store them with
+// BigIntToDecimal128 instead.
 func BigIntToInt(b *big.Int) (int, error) {
-	if b.IsInt64() {
-		i64 := b.Int64()
-		if i64 >= int64(^int(0)) || i64 <= int64(-1<<63) {
-			return int(i64), nil
-		}
+	// int is 32 bits on some platforms, so fitting int64 isn't enough.
+	if b.IsInt64() && int64(int(b.Int64())) == b.Int64() {
+		return int(b.Int64()), nil
 	}
 	return 0, errors.New("big.Int value is out of int range")
 }
+
+// NftChange identifies an NFT record written by any instance.
+type NftChange struct {
+	ContractAddress string               `bson:"contractAddress"`
+	NftID           primitive.Decimal128 `bson:"nftId"`
+}
+
+// WatchNftChanges calls onChange for every insert, update or replace on the
+// nfts collection until ctx is done or the stream fails. Change streams
+// need MongoDB to run as a replica set.
+func (MongoStore) WatchNftChanges(ctx context.Context, onChange func(NftChange)) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace"}}}}},
+		{{Key: "$project", Value: bson.M{"fullDocument.contractAddress": 1, "fullDocument.nftId": 1}}},
+	}
+	stream, err := collection.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return fmt.Errorf("watch nfts: %w", err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			FullDocument *NftChange `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			log.Printf("Failed to decode change event: %v", err)
+			continue
+		}
+		// The document may be gone by the time an update is looked up.
+		if event.FullDocument != nil {
+			onChange(*event.FullDocument)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := stream.Err(); err != nil {
+		return fmt.Errorf("watch nfts: %w", err)
+	}
+	return errors.New("watch nfts: change stream closed")
+}
@@ -0,0 +1,206 @@
+package nftModel
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func bigInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		t.Fatalf("bad integer %s", s)
+	}
+	return b
+}
+
+const (
+	maxInt64   = "9223372036854775807"
+	twoTo63    = "9223372036854775808"
+	maxDecimal = "9999999999999999999999999999999999"
+	tenTo34    = "10000000000000000000000000000000000"
+	maxUint256 = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+)
+
+func TestBigIntToInt(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"0", true},
+		{"-1", true},
+		{"2147483647", true},
+		{maxInt64, strconv.IntSize == 64},
+		{"-" + twoTo63, strconv.IntSize == 64},
+		{twoTo63, false},
+		{"-9223372036854775809", false},
+		{maxDecimal, false},
+		{tenTo34, false},
+		{maxUint256, false},
+	}
+	for _, tt := range tests {
+		want := bigInt(t, tt.value)
+		got, err := BigIntToInt(want)
+		if (err == nil) != tt.ok {
+			t.Errorf("BigIntToInt(%s) err = %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if err == nil && big.NewInt(int64(got)).Cmp(want) != 0 {
+			t.Errorf("BigIntToInt(%s) = %d", tt.value, got)
+		}
+	}
+}
+
+func TestBigIntToDecimal128(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"0", true},
+		{maxInt64, true},
+		{twoTo63, true},
+		{maxDecimal, true},
+		// 10^34 is a single significant digit, so it is still exact.
+		{tenTo34, true},
+		{"10000000000000000000000000000000001", false},
+		{maxUint256, false},
+		{"-1", false},
+		{"-" + twoTo63, false},
+	}
+	for _, tt := range tests {
+		want := bigInt(t, tt.value)
+		d, err := BigIntToDecimal128(want)
+		if (err == nil) != tt.ok {
+			t.Errorf("BigIntToDecimal128(%s) err = %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got, err := Decimal128ToBigInt(d)
+		if err != nil || got.Cmp(want) != 0 {
+			t.Errorf("Decimal128ToBigInt(BigIntToDecimal128(%s)) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestKeyForTokenIDFallsBackToRaw(t *testing.T) {
+	key, err := KeyForTokenID(bigInt(t, maxUint256))
+	if err != nil || key.NftID != RawTokenNftID || key.RawTokenID != "0x"+maxUint256[2:] {
+		t.Errorf("KeyForTokenID(max uint256) = %+v, %v", key, err)
+	}
+	if _, err := KeyForTokenID(new(big.Int).Lsh(big.NewInt(1), 256)); err == nil {
+		t.Error("KeyForTokenID(2^256) succeeded, want an error")
+	}
+	if _, err := KeyForTokenID(big.NewInt(-1)); err == nil {
+		t.Error("KeyForTokenID(-1) succeeded, want an error")
+	}
+}
+
+// sharedIDStore holds tokens 1-4 of five contracts, all owned by owner and
+// written at the same instant, so only _id tells same-ID tokens apart.
+func sharedIDStore(t *testing.T, owner string) (*MemoryStore, int) {
+	t.Helper()
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Init(1, false)
+
+	now := time.Now()
+	var nfts []NFT
+	var transfers []Transfer
+	for c := 0; c < 5; c++ {
+		contract := "0x00000000000000000000000000000000000000C" + strconv.Itoa(c)
+		for id := int64(1); id <= 4; id++ {
+			key, err := KeyForTokenID(big.NewInt(id))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nfts = append(nfts, NFT{ChainID: 1, ContractAddress: contract, NftID: key.NftID, OwnerAddress: owner, TimeStamp: now, BlockNumber: 10, Confirmed: true})
+			transfers = append(transfers, Transfer{ChainID: 1, ContractAddress: contract, NftID: key.NftID, FromAddress: ZeroAddress, ToAddress: owner, TxHash: contract + strconv.FormatInt(id, 10), BlockNumber: 10, TimeStamp: now})
+		}
+	}
+	if _, err := store.BulkUpsertNFTs(ctx, nfts); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertTransfers(ctx, transfers); err != nil {
+		t.Fatal(err)
+	}
+	return store, len(nfts)
+}
+
+// checkPages fails if the pages don't hold every one of want records
+// exactly once.
+func checkPages(t *testing.T, name string, pages [][]primitive.ObjectID, want int) {
+	t.Helper()
+	seen := make(map[primitive.ObjectID]bool)
+	for _, page := range pages {
+		for _, id := range page {
+			if seen[id] {
+				t.Errorf("%s: record %s on more than one page", name, id.Hex())
+			}
+			seen[id] = true
+		}
+	}
+	if len(seen) != want {
+		t.Errorf("%s: paged through %d records, want %d", name, len(seen), want)
+	}
+}
+
+func TestPagingWithTiedSortKeys(t *testing.T) {
+	ctx := context.Background()
+	owner := "0x000000000000000000000000000000000000A11c"
+	store, total := sharedIDStore(t, owner)
+	const limit = 3
+
+	var byCursor [][]primitive.ObjectID
+	opts := ListOptions{Limit: limit}
+	for {
+		nfts, err := store.GetAllNfts(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nfts) == 0 {
+			break
+		}
+		var ids []primitive.ObjectID
+		for _, nft := range nfts {
+			ids = append(ids, nft.ID)
+		}
+		byCursor = append(byCursor, ids)
+		opts.After = CursorAfter(nfts[len(nfts)-1])
+	}
+	checkPages(t, "GetAllNfts by cursor", byCursor, total)
+
+	var byOffset [][]primitive.ObjectID
+	for offset := int64(0); offset < int64(total)+limit; offset += limit {
+		nfts, err := store.GetWalletNfts(ctx, owner, ListOptions{Limit: limit, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []primitive.ObjectID
+		for _, nft := range nfts {
+			ids = append(ids, nft.ID)
+		}
+		byOffset = append(byOffset, ids)
+	}
+	checkPages(t, "GetWalletNfts by offset", byOffset, total)
+
+	var transfers [][]primitive.ObjectID
+	for offset := int64(0); offset < int64(total)+limit; offset += limit {
+		page, err := store.GetWalletTransfers(ctx, owner, ListOptions{Limit: limit, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []primitive.ObjectID
+		for _, transfer := range page {
+			ids = append(ids, transfer.ID)
+		}
+		transfers = append(transfers, ids)
+	}
+	checkPages(t, "GetWalletTransfers by offset", transfers, total)
+}
@@ -0,0 +1,98 @@
+package nftModel
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var progressCollection *mongo.Collection
+
+// ScanProgress records the next block to scan for a contract, so a restarted
+// tracker resumes exactly where the previous run left off.
+type ScanProgress struct {
+	ContractAddress string    `bson:"contractAddress"`
+	NextBlock       int64     `bson:"nextBlock"`
+	UpdatedAt       time.Time `bson:"updatedAt"`
+}
+
+func GetProgressCollection() *mongo.Collection {
+	progressCollection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("PROGRESS_COLLECTION", "progress"))
+	return progressCollection
+}
+
+func (MongoStore) GetScanProgress(ctx context.Context, contractAddress string) (*ScanProgress, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	var progress ScanProgress
+	err := progressCollection.FindOne(ctx, bson.M{"contractAddress": contractAddress}).Decode(&progress)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Failed to find scan progress: %v", err)
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+func (MongoStore) SaveScanProgress(ctx context.Context, contractAddress string, nextBlock int64) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"contractAddress": contractAddress}
+	update := bson.M{
+		"$set": bson.M{
+			"nextBlock": nextBlock,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	opts := options.Update().SetUpsert(true)
+	_, err := progressCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		log.Printf("Failed to save scan progress: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetIndexedBlock returns the highest block every contract has been scanned
+// through, or -1 if nothing has been scanned yet.
+func (MongoStore) GetIndexedBlock(ctx context.Context) (int64, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": nil, "nextBlock": bson.M{"$min": "$nextBlock"}}}},
+	}
+
+	cursor, err := progressCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate scan progress: %v", err)
+		return -1, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		NextBlock int64 `bson:"nextBlock"`
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		log.Printf("Failed to decode scan progress: %v", err)
+		return -1, err
+	}
+	if len(result) == 0 {
+		return -1, nil
+	}
+
+	return result[0].NextBlock - 1, nil
+}
@@ -0,0 +1,54 @@
+package nftModel
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var rawLogCollection *mongo.Collection
+
+// RawLog is an unmodified copy of a processed log, kept so state can be
+// re-derived if a decoder changes without querying the chain again.
+type RawLog struct {
+	Address     string   `bson:"address" json:"address"`
+	Topics      []string `bson:"topics" json:"topics"`
+	Data        string   `bson:"data" json:"data"`
+	BlockNumber uint64   `bson:"blockNumber" json:"blockNumber"`
+	BlockHash   string   `bson:"blockHash" json:"blockHash"`
+	TxHash      string   `bson:"txHash" json:"txHash"`
+	TxIndex     uint     `bson:"txIndex" json:"txIndex"`
+	LogIndex    uint     `bson:"logIndex" json:"logIndex"`
+	Removed     bool     `bson:"removed" json:"removed"`
+}
+
+func GetRawLogCollection() *mongo.Collection {
+	rawLogCollection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("RAW_LOG_COLLECTION", "rawLogs"))
+	return rawLogCollection
+}
+
+func CreateRawLogIndexes() {
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "txHash", Value: 1}, {Key: "logIndex", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	buildIndexes(rawLogCollection, []mongo.IndexModel{indexModel}, nil)
+}
+
+func (MongoStore) InsertRawLog(ctx context.Context, rawLog RawLog) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	_, err := rawLogCollection.InsertOne(ctx, rawLog)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Failed to insert raw log into MongoDB: %v", err)
+		return err
+	}
+	return nil
+}
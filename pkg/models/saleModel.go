@@ -0,0 +1,157 @@
+package nftModel
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sale is the marketplace price attached to a transfer. Price is the raw
+// integer amount in the currency's smallest unit, kept as a decimal string
+// because ERC-20 amounts can exceed Decimal128. Currency is the payment
+// token, ZeroAddress for ETH, or empty when the event doesn't say.
+type Sale struct {
+	Marketplace string `bson:"marketplace" json:"marketplace"`
+	Price       string `bson:"price" json:"price"`
+	Currency    string `bson:"currency,omitempty" json:"currency,omitempty"`
+	TxHash      string `bson:"txHash" json:"txHash"`
+	BlockNumber uint64 `bson:"blockNumber" json:"blockNumber"`
+}
+
+// ApplySale attaches sale to the transfers in its transaction and, for NFTs
+// whose latest transfer is that transaction, records it as the last sale.
+// A nil nftId matches every tracked token moved in the transaction, for
+// marketplaces whose events don't name the token.
+func (MongoStore) ApplySale(ctx context.Context, contractAddress string, nftId *primitive.Decimal128, sale Sale) error {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{"txHash": sale.TxHash}
+	if nftId != nil {
+		filter["contractAddress"] = contractAddress
+		filter["nftId"] = *nftId
+	}
+
+	_, err := transferCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"sale": sale}})
+	if err != nil {
+		log.Printf("Failed to attach sale to transfers: %v", err)
+		return err
+	}
+
+	_, err = collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"lastSale": sale}})
+	if err != nil {
+		log.Printf("Failed to attach sale to NFTs: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CurrencyMarket summarises a contract's sales in one currency. Prices are
+// decimal strings in the currency's smallest unit, like Sale.Price.
+type CurrencyMarket struct {
+	Currency   string    `json:"currency"`
+	FloorPrice string    `json:"floorPrice"`
+	Volume     string    `json:"volume"`
+	SaleCount  int64     `json:"saleCount"`
+	LastSaleAt time.Time `json:"lastSaleAt"`
+}
+
+// GetContractMarket summarises the sales attached to a contract's
+// transfers since the given time, per currency, most traded first.
+func (MongoStore) GetContractMarket(ctx context.Context, contractAddress string, since time.Time) ([]CurrencyMarket, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"chainId":         chainID,
+		"contractAddress": contractAddress,
+		"sale":            bson.M{"$exists": true},
+		"timestamp":       bson.M{"$gte": since},
+	}
+	findOptions := options.Find().SetProjection(bson.M{"sale": 1, "timestamp": 1})
+
+	cursor, err := transferCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find contract sales: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transfers []Transfer
+	err = cursor.All(ctx, &transfers)
+	if err != nil {
+		log.Printf("Failed to decode contract sales: %v", err)
+		return nil, err
+	}
+	return summariseSales(transfers), nil
+}
+
+// summariseSales totals the sales on transfers. A sale attached to every
+// token of a bundle is counted once, and prices that don't parse are
+// skipped.
+func summariseSales(transfers []Transfer) []CurrencyMarket {
+	type saleKey struct {
+		txHash, marketplace, price, currency string
+	}
+	type totals struct {
+		floor, volume *big.Int
+		count         int64
+		last          time.Time
+	}
+
+	seen := make(map[saleKey]bool)
+	byCurrency := make(map[string]*totals)
+	for _, transfer := range transfers {
+		sale := transfer.Sale
+		if sale == nil {
+			continue
+		}
+		key := saleKey{sale.TxHash, sale.Marketplace, sale.Price, sale.Currency}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		price, ok := new(big.Int).SetString(sale.Price, 10)
+		if !ok {
+			continue
+		}
+		total := byCurrency[sale.Currency]
+		if total == nil {
+			total = &totals{volume: new(big.Int)}
+			byCurrency[sale.Currency] = total
+		}
+		if total.floor == nil || price.Cmp(total.floor) < 0 {
+			total.floor = price
+		}
+		total.volume.Add(total.volume, price)
+		total.count++
+		if transfer.TimeStamp.After(total.last) {
+			total.last = transfer.TimeStamp
+		}
+	}
+
+	markets := make([]CurrencyMarket, 0, len(byCurrency))
+	for currency, total := range byCurrency {
+		markets = append(markets, CurrencyMarket{
+			Currency:   currency,
+			FloorPrice: total.floor.String(),
+			Volume:     total.volume.String(),
+			SaleCount:  total.count,
+			LastSaleAt: total.last,
+		})
+	}
+	sort.Slice(markets, func(i, j int) bool {
+		if markets[i].SaleCount != markets[j].SaleCount {
+			return markets[i].SaleCount > markets[j].SaleCount
+		}
+		return markets[i].Currency < markets[j].Currency
+	})
+	return markets
+}
@@ -0,0 +1,315 @@
+package nftModel
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store is the storage behind the package-level functions. MongoStore is
+// the default; MemoryStore keeps everything in process for tests and
+// demos.
+type Store interface {
+	// Init prepares collections and indexes for indexing chain. rawLogs
+	// adds the raw log collection used by STORE_RAW_LOGS.
+	Init(chain int64, rawLogs bool)
+	Ping(ctx context.Context) error
+
+	BulkUpsertNFTs(ctx context.Context, nfts []NFT) (BulkResult, error)
+	GetAllNfts(ctx context.Context, opts ListOptions) ([]NFT, error)
+	StreamAllNfts(ctx context.Context, opts ListOptions, each func(NFT) error) error
+	GetWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletNft, error)
+	CountWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) (int64, error)
+	ConfirmNfts(ctx context.Context, confirmedBlock int64) (int64, error)
+	GetNftByToken(ctx context.Context, contractAddress string, key TokenKey) (*NFT, error)
+	GetNftsByTxHash(ctx context.Context, txHash string) ([]NFT, error)
+	UpdateNftOwner(ctx context.Context, contractAddress string, key TokenKey, ownerAddress string) error
+	UpdateNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128, tokenUri, image string, attributes []Attribute, status string) error
+	TouchNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128) error
+	MarkMetadataStale(ctx context.Context, contractAddress string, fromId primitive.Decimal128, toId *primitive.Decimal128) (int64, error)
+	GetStaleMetadata(ctx context.Context, before time.Time, limit int64) ([]NFT, error)
+	GetNftsUpdatedSince(ctx context.Context, since time.Time, opts ListOptions) ([]NFT, error)
+	SearchNftsByTraits(ctx context.Context, contractAddress string, traits []Attribute, opts ListOptions) ([]NFT, error)
+	CountContractNfts(ctx context.Context, contractAddress string) (int64, error)
+	GetContractCounts(ctx context.Context, limit int64) ([]ContractCount, error)
+	GetWalletSummary(ctx context.Context, walletAddress string) ([]WalletContractSummary, error)
+	WatchNftChanges(ctx context.Context, onChange func(NftChange)) error
+	InsertTransfers(ctx context.Context, transfers []Transfer) error
+	GetContractActivity(ctx context.Context, contractAddress, interval string, from, to time.Time) ([]ActivityBucket, error)
+	GetWalletTransfers(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletTransfer, error)
+	GetOwnerAtBlock(ctx context.Context, contractAddress string, key TokenKey, block uint64) (string, error)
+	GetContractSnapshot(ctx context.Context, contractAddress string, block uint64) ([]TokenSnapshot, error)
+	GetMints(ctx context.Context, contractAddress string, fromBlock, toBlock uint64, opts ListOptions) ([]Transfer, error)
+	ApplySale(ctx context.Context, contractAddress string, nftId *primitive.Decimal128, sale Sale) error
+	GetContractMarket(ctx context.Context, contractAddress string, since time.Time) ([]CurrencyMarket, error)
+	GetScanProgress(ctx context.Context, contractAddress string) (*ScanProgress, error)
+	SaveScanProgress(ctx context.Context, contractAddress string, nextBlock int64) error
+	GetIndexedBlock(ctx context.Context) (int64, error)
+	UpsertContractInfo(ctx context.Context, address, name, symbol string) error
+	SetContractFlags(ctx context.Context, address string, verified, spam bool) error
+	SetContractPaused(ctx context.Context, address string, paused bool) error
+	GetPausedContracts(ctx context.Context) ([]string, error)
+	InsertRawLog(ctx context.Context, rawLog RawLog) error
+	SaveDeadLetter(ctx context.Context, rawLog RawLog, cause string) error
+	GetDeadLetters(ctx context.Context, opts ListOptions) ([]DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error
+}
+
+var store Store = MongoStore{}
+
+// UseStore replaces the storage backend. Call it before Init and before
+// anything reads or writes.
+func UseStore(s Store) {
+	store = s
+}
+
+// MongoStore keeps the index in the MongoDB database named by DB_NAME.
+// Collection names can be overridden through NFT_COLLECTION,
+// TRANSFER_COLLECTION, CONTRACT_COLLECTION, PROGRESS_COLLECTION and
+// RAW_LOG_COLLECTION so several instances can share one database.
+type MongoStore struct {
+	// bulkWriteRetries is how many times BulkUpsertNFTs retries a failed
+	// upsert before giving up on it.
+	bulkWriteRetries int
+	// indexBuildTimeout bounds the index setup of each collection in Init.
+	indexBuildTimeout time.Duration
+	// queryTimeout bounds each query the store runs.
+	queryTimeout time.Duration
+}
+
+// NewMongoStore reads the store's settings: BULK_WRITE_RETRIES (3 by
+// default), INDEX_BUILD_TIMEOUT and QUERY_TIMEOUT (10s each by default).
+// The zero MongoStore doesn't retry failed upserts.
+func NewMongoStore() MongoStore {
+	retries, err := strconv.Atoi(os.Getenv("BULK_WRITE_RETRIES"))
+	if err != nil || retries < 0 {
+		retries = 3
+	}
+	timeout, err := time.ParseDuration(os.Getenv("INDEX_BUILD_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	queryTimeout, err := time.ParseDuration(os.Getenv("QUERY_TIMEOUT"))
+	if err != nil || queryTimeout <= 0 {
+		queryTimeout = 10 * time.Second
+	}
+	return MongoStore{bulkWriteRetries: retries, indexBuildTimeout: timeout, queryTimeout: queryTimeout}
+}
+
+// queryTimeout is the QUERY_TIMEOUT of the store in use, set by Open.
+var queryTimeout = 10 * time.Second
+
+// queryContext bounds a single query by QUERY_TIMEOUT. ctx is usually the
+// HTTP request's, so a client that disconnects cancels its query too.
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+func collectionName(envName, fallback string) string {
+	if name := os.Getenv(envName); name != "" {
+		return name
+	}
+	return fallback
+}
+
+// Open sets up the collection handles and the query timeout without
+// touching indexes, for read-only use.
+func (m MongoStore) Open() {
+	if m.queryTimeout > 0 {
+		queryTimeout = m.queryTimeout
+	}
+	GetNftCollection()
+	GetProgressCollection()
+	GetTransferCollection()
+	GetContractCollection()
+	GetDeadLetterCollection()
+}
+
+func (m MongoStore) Init(chain int64, rawLogs bool) {
+	chainID = chain
+	if m.indexBuildTimeout > 0 {
+		indexBuildTimeout = m.indexBuildTimeout
+	}
+	m.Open()
+	CreateIndexes()
+	CreateTransferIndexes()
+	CreateContractIndexes()
+	CreateDeadLetterIndexes()
+	if rawLogs {
+		GetRawLogCollection()
+		CreateRawLogIndexes()
+	}
+}
+
+func (MongoStore) Ping(ctx context.Context) error {
+	return config.DB.Ping(ctx, nil)
+}
+
+func Init(chain int64, rawLogs bool) {
+	store.Init(chain, rawLogs)
+}
+
+func Ping(ctx context.Context) error {
+	return store.Ping(ctx)
+}
+
+func BulkUpsertNFTs(ctx context.Context, nfts []NFT) (BulkResult, error) {
+	return store.BulkUpsertNFTs(ctx, nfts)
+}
+
+func GetAllNfts(ctx context.Context, opts ListOptions) ([]NFT, error) {
+	return store.GetAllNfts(ctx, opts)
+}
+
+func StreamAllNfts(ctx context.Context, opts ListOptions, each func(NFT) error) error {
+	return store.StreamAllNfts(ctx, opts, each)
+}
+
+func GetWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletNft, error) {
+	return store.GetWalletNfts(ctx, walletAddress, opts)
+}
+
+func CountWalletNfts(ctx context.Context, walletAddress string, opts ListOptions) (int64, error) {
+	return store.CountWalletNfts(ctx, walletAddress, opts)
+}
+
+func ConfirmNfts(ctx context.Context, confirmedBlock int64) (int64, error) {
+	return store.ConfirmNfts(ctx, confirmedBlock)
+}
+
+func GetNftByToken(ctx context.Context, contractAddress string, key TokenKey) (*NFT, error) {
+	return store.GetNftByToken(ctx, contractAddress, key)
+}
+
+func GetNftsByTxHash(ctx context.Context, txHash string) ([]NFT, error) {
+	return store.GetNftsByTxHash(ctx, txHash)
+}
+
+func UpdateNftOwner(ctx context.Context, contractAddress string, key TokenKey, ownerAddress string) error {
+	return store.UpdateNftOwner(ctx, contractAddress, key, ownerAddress)
+}
+
+func UpdateNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128, tokenUri, image string, attributes []Attribute, status string) error {
+	return store.UpdateNftMetadata(ctx, contractAddress, nftId, tokenUri, image, attributes, status)
+}
+
+func TouchNftMetadata(ctx context.Context, contractAddress string, nftId primitive.Decimal128) error {
+	return store.TouchNftMetadata(ctx, contractAddress, nftId)
+}
+
+func MarkMetadataStale(ctx context.Context, contractAddress string, fromId primitive.Decimal128, toId *primitive.Decimal128) (int64, error) {
+	return store.MarkMetadataStale(ctx, contractAddress, fromId, toId)
+}
+
+func GetStaleMetadata(ctx context.Context, before time.Time, limit int64) ([]NFT, error) {
+	return store.GetStaleMetadata(ctx, before, limit)
+}
+
+func GetNftsUpdatedSince(ctx context.Context, since time.Time, opts ListOptions) ([]NFT, error) {
+	return store.GetNftsUpdatedSince(ctx, since, opts)
+}
+
+func SearchNftsByTraits(ctx context.Context, contractAddress string, traits []Attribute, opts ListOptions) ([]NFT, error) {
+	return store.SearchNftsByTraits(ctx, contractAddress, traits, opts)
+}
+
+func CountContractNfts(ctx context.Context, contractAddress string) (int64, error) {
+	return store.CountContractNfts(ctx, contractAddress)
+}
+
+func GetContractCounts(ctx context.Context, limit int64) ([]ContractCount, error) {
+	return store.GetContractCounts(ctx, limit)
+}
+
+func GetWalletSummary(ctx context.Context, walletAddress string) ([]WalletContractSummary, error) {
+	return store.GetWalletSummary(ctx, walletAddress)
+}
+
+func WatchNftChanges(ctx context.Context, onChange func(NftChange)) error {
+	return store.WatchNftChanges(ctx, onChange)
+}
+
+func InsertTransfers(ctx context.Context, transfers []Transfer) error {
+	return store.InsertTransfers(ctx, transfers)
+}
+
+func GetContractActivity(ctx context.Context, contractAddress, interval string, from, to time.Time) ([]ActivityBucket, error) {
+	return store.GetContractActivity(ctx, contractAddress, interval, from, to)
+}
+
+func GetWalletTransfers(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletTransfer, error) {
+	return store.GetWalletTransfers(ctx, walletAddress, opts)
+}
+
+func GetOwnerAtBlock(ctx context.Context, contractAddress string, key TokenKey, block uint64) (string, error) {
+	return store.GetOwnerAtBlock(ctx, contractAddress, key, block)
+}
+
+func GetContractSnapshot(ctx context.Context, contractAddress string, block uint64) ([]TokenSnapshot, error) {
+	return store.GetContractSnapshot(ctx, contractAddress, block)
+}
+
+func GetMints(ctx context.Context, contractAddress string, fromBlock, toBlock uint64, opts ListOptions) ([]Transfer, error) {
+	return store.GetMints(ctx, contractAddress, fromBlock, toBlock, opts)
+}
+
+func ApplySale(ctx context.Context, contractAddress string, nftId *primitive.Decimal128, sale Sale) error {
+	return store.ApplySale(ctx, contractAddress, nftId, sale)
+}
+
+func GetContractMarket(ctx context.Context, contractAddress string, since time.Time) ([]CurrencyMarket, error) {
+	return store.GetContractMarket(ctx, contractAddress, since)
+}
+
+func GetScanProgress(ctx context.Context, contractAddress string) (*ScanProgress, error) {
+	return store.GetScanProgress(ctx, contractAddress)
+}
+
+func SaveScanProgress(ctx context.Context, contractAddress string, nextBlock int64) error {
+	return store.SaveScanProgress(ctx, contractAddress, nextBlock)
+}
+
+func GetIndexedBlock(ctx context.Context) (int64, error) {
+	return store.GetIndexedBlock(ctx)
+}
+
+func UpsertContractInfo(ctx context.Context, address, name, symbol string) error {
+	return store.UpsertContractInfo(ctx, address, name, symbol)
+}
+
+func SetContractFlags(ctx context.Context, address string, verified, spam bool) error {
+	return store.SetContractFlags(ctx, address, verified, spam)
+}
+
+func SetContractPaused(ctx context.Context, address string, paused bool) error {
+	return store.SetContractPaused(ctx, address, paused)
+}
+
+func GetPausedContracts(ctx context.Context) ([]string, error) {
+	return store.GetPausedContracts(ctx)
+}
+
+func InsertRawLog(ctx context.Context, rawLog RawLog) error {
+	return store.InsertRawLog(ctx, rawLog)
+}
+
+func SaveDeadLetter(ctx context.Context, rawLog RawLog, cause string) error {
+	return store.SaveDeadLetter(ctx, rawLog, cause)
+}
+
+func GetDeadLetters(ctx context.Context, opts ListOptions) ([]DeadLetter, error) {
+	return store.GetDeadLetters(ctx, opts)
+}
+
+func GetDeadLetter(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	return store.GetDeadLetter(ctx, id)
+}
+
+func DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	return store.DeleteDeadLetter(ctx, id)
+}
@@ -0,0 +1,381 @@
+package nftModel
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store := NewMemoryStore()
+		store.Init(1, false)
+		return store
+	})
+}
+
+// TestMongoStoreConformance runs the same cases against the MongoDB at
+// TEST_MONGODB_URI, each in a database of its own that is dropped
+// afterwards.
+func TestMongoStoreConformance(t *testing.T) {
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := config.DB
+	config.DB = client
+	t.Cleanup(func() {
+		config.DB = previous
+		client.Disconnect(context.Background())
+	})
+
+	testStore(t, func(t *testing.T) Store {
+		name := "nft_tracker_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		t.Setenv("DB_NAME", name)
+		t.Cleanup(func() { client.Database(name).Drop(context.Background()) })
+		store := NewMongoStore()
+		store.Init(1, false)
+		return store
+	})
+}
+
+const (
+	storeOwner = "0x000000000000000000000000000000000000A11c"
+	storeBuyer = "0x0000000000000000000000000000000000000B0b"
+)
+
+func tokenKey(t *testing.T, id int64) TokenKey {
+	t.Helper()
+	key, err := KeyForTokenID(big.NewInt(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testNFT(t *testing.T, id int64, owner string, block uint64) NFT {
+	t.Helper()
+	return NFT{
+		ChainID:         1,
+		ContractAddress: testContract,
+		NftID:           tokenKey(t, id).NftID,
+		OwnerAddress:    owner,
+		TxHash:          "0x" + strconv.FormatInt(id, 16) + strconv.FormatUint(block, 16),
+		BlockNumber:     block,
+		Confirmed:       true,
+		TimeStamp:       time.Now(),
+	}
+}
+
+func tokenIds(nfts []NFT) []string {
+	ids := make([]string, len(nfts))
+	for i, nft := range nfts {
+		ids[i] = nft.NftID.String()
+	}
+	return ids
+}
+
+func sameIds(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// testStore checks the behaviour the tracker and the API rely on, for the
+// parts of Store that both backends implement. open returns an empty
+// store for chain 1.
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("upserts keep the latest transfer", func(t *testing.T) {
+		store := open(t)
+		writes := []NFT{testNFT(t, 1, storeOwner, 10), testNFT(t, 1, storeBuyer, 9)}
+		for _, nft := range writes {
+			if _, err := store.BulkUpsertNFTs(ctx, []NFT{nft}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nft, err := store.GetNftByToken(ctx, testContract, tokenKey(t, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nft.OwnerAddress != storeOwner || nft.BlockNumber != 10 {
+			t.Errorf("owner = %s at block %d, want %s at block 10", nft.OwnerAddress, nft.BlockNumber, storeOwner)
+		}
+
+		later := testNFT(t, 1, storeBuyer, 10)
+		later.LogIndex = 2
+		if _, err := store.BulkUpsertNFTs(ctx, []NFT{later}); err != nil {
+			t.Fatal(err)
+		}
+		nft, err = store.GetNftByToken(ctx, testContract, tokenKey(t, 1))
+		if err != nil || nft.OwnerAddress != storeBuyer {
+			t.Errorf("after a later log in the same block: %+v, %v; want owner %s", nft, err, storeBuyer)
+		}
+	})
+
+	t.Run("missing records are ErrNotFound", func(t *testing.T) {
+		store := open(t)
+		if _, err := store.GetNftByToken(ctx, testContract, tokenKey(t, 1)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetNftByToken: err = %v, want ErrNotFound", err)
+		}
+		if _, err := store.GetOwnerAtBlock(ctx, testContract, tokenKey(t, 1), 10); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetOwnerAtBlock: err = %v, want ErrNotFound", err)
+		}
+		progress, err := store.GetScanProgress(ctx, testContract)
+		if progress != nil || err != nil {
+			t.Errorf("GetScanProgress = %+v, %v; want nil, nil", progress, err)
+		}
+
+		// Metadata for a token that was never written doesn't create it.
+		if err := store.UpdateNftMetadata(ctx, testContract, tokenKey(t, 1).NftID, "", "", nil, MetadataOK); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetNftByToken(ctx, testContract, tokenKey(t, 1)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetNftByToken after UpdateNftMetadata: err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("lists apply the visibility options", func(t *testing.T) {
+		store := open(t)
+		pending := testNFT(t, 2, storeOwner, 20)
+		pending.Confirmed = false
+		burned := testNFT(t, 3, ZeroAddress, 12)
+		burned.Burned = true
+		if _, err := store.BulkUpsertNFTs(ctx, []NFT{testNFT(t, 1, storeOwner, 10), pending, burned}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			name string
+			opts ListOptions
+			want []string
+		}{
+			{"default", ListOptions{}, []string{"1"}},
+			{"unconfirmed", ListOptions{IncludeUnconfirmed: true}, []string{"2", "1"}},
+			{"burned", ListOptions{IncludeBurned: true}, []string{"3", "1"}},
+			{"offset", ListOptions{IncludeUnconfirmed: true, IncludeBurned: true, Offset: 1, Limit: 1}, []string{"2"}},
+		} {
+			nfts, err := store.GetAllNfts(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tokenIds(nfts); !sameIds(got, tt.want...) {
+				t.Errorf("%s: GetAllNfts = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+
+		confirmed, err := store.ConfirmNfts(ctx, 20)
+		if err != nil || confirmed != 1 {
+			t.Errorf("ConfirmNfts = %d, %v; want 1", confirmed, err)
+		}
+		nfts, err := store.GetAllNfts(ctx, ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tokenIds(nfts); !sameIds(got, "2", "1") {
+			t.Errorf("after ConfirmNfts: GetAllNfts = %v, want [2 1]", got)
+		}
+	})
+
+	t.Run("wallet lists skip spam on request", func(t *testing.T) {
+		store := open(t)
+		spam := testNFT(t, 2, storeOwner, 11)
+		spam.ContractAddress = "0x00000000000000000000000000000000000000C1"
+		if _, err := store.BulkUpsertNFTs(ctx, []NFT{testNFT(t, 1, storeOwner, 10), spam, testNFT(t, 3, storeBuyer, 12)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetContractFlags(ctx, spam.ContractAddress, false, true); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, excludeSpam := range []bool{false, true} {
+			opts := ListOptions{ExcludeSpam: excludeSpam}
+			want := []string{"2", "1"}
+			if excludeSpam {
+				want = []string{"1"}
+			}
+			nfts, err := store.GetWalletNfts(ctx, storeOwner, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, nft := range nfts {
+				got = append(got, nft.NftID.String())
+				if nft.Spam != (nft.ContractAddress == spam.ContractAddress) {
+					t.Errorf("token %s of %s: Spam = %v", nft.NftID, nft.ContractAddress, nft.Spam)
+				}
+			}
+			if !sameIds(got, want...) {
+				t.Errorf("excludeSpam %v: GetWalletNfts = %v, want %v", excludeSpam, got, want)
+			}
+			count, err := store.CountWalletNfts(ctx, storeOwner, opts)
+			if err != nil || count != int64(len(want)) {
+				t.Errorf("excludeSpam %v: CountWalletNfts = %d, %v; want %d", excludeSpam, count, err, len(want))
+			}
+		}
+	})
+
+	t.Run("trait search pages the visible matches", func(t *testing.T) {
+		store := open(t)
+		gold := Attribute{TraitType: "Background", Value: "Gold"}
+		var nfts []NFT
+		for id := int64(1); id <= 4; id++ {
+			nfts = append(nfts, testNFT(t, id, storeOwner, uint64(10+id)))
+		}
+		nfts[1].Burned = true
+		if _, err := store.BulkUpsertNFTs(ctx, nfts); err != nil {
+			t.Fatal(err)
+		}
+		for id := int64(1); id <= 4; id++ {
+			attributes := []Attribute{gold}
+			if id == 3 {
+				attributes = []Attribute{{TraitType: "Background", Value: "Blue"}}
+			}
+			if err := store.UpdateNftMetadata(ctx, testContract, tokenKey(t, id).NftID, "", "", attributes, MetadataOK); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range []struct {
+			name string
+			opts ListOptions
+			want []string
+		}{
+			{"default", ListOptions{}, []string{"4", "1"}},
+			{"burned", ListOptions{IncludeBurned: true}, []string{"4", "2", "1"}},
+			{"offset", ListOptions{Offset: 1, Limit: 1}, []string{"1"}},
+		} {
+			found, err := store.SearchNftsByTraits(ctx, testContract, []Attribute{gold}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tokenIds(found); !sameIds(got, tt.want...) {
+				t.Errorf("%s: SearchNftsByTraits = %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("transfer history", func(t *testing.T) {
+		store := open(t)
+		key := tokenKey(t, 1)
+		transfers := []Transfer{
+			{ChainID: 1, ContractAddress: testContract, NftID: key.NftID, FromAddress: ZeroAddress, ToAddress: storeOwner, TxHash: "0x0a", BlockNumber: 10, Mint: true},
+			{ChainID: 1, ContractAddress: testContract, NftID: key.NftID, FromAddress: storeOwner, ToAddress: storeBuyer, TxHash: "0x0b", BlockNumber: 15},
+		}
+		// Writing a batch again, as after a retried flush, adds nothing.
+		for i := 0; i < 2; i++ {
+			if err := store.InsertTransfers(ctx, transfers); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for block, want := range map[uint64]string{10: storeOwner, 14: storeOwner, 15: storeBuyer, 100: storeBuyer} {
+			owner, err := store.GetOwnerAtBlock(ctx, testContract, key, block)
+			if err != nil || owner != want {
+				t.Errorf("GetOwnerAtBlock(%d) = %q, %v; want %s", block, owner, err, want)
+			}
+		}
+
+		history, err := store.GetWalletTransfers(ctx, storeOwner, ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 2 || history[0].TxHash != "0x0b" || history[0].Direction != DirectionOut || history[1].Direction != DirectionIn {
+			t.Errorf("GetWalletTransfers = %+v, want the sale out then the mint in", history)
+		}
+
+		mints, err := store.GetMints(ctx, testContract, 0, 100, ListOptions{})
+		if err != nil || len(mints) != 1 || mints[0].TxHash != "0x0a" {
+			t.Errorf("GetMints = %+v, %v; want the one mint", mints, err)
+		}
+	})
+
+	t.Run("scan progress", func(t *testing.T) {
+		store := open(t)
+		if block, err := store.GetIndexedBlock(ctx); err != nil || block != -1 {
+			t.Errorf("GetIndexedBlock = %d, %v; want -1 before any scan", block, err)
+		}
+		other := "0x00000000000000000000000000000000000000C1"
+		for contract, next := range map[string]int64{testContract: 100, other: 50} {
+			if err := store.SaveScanProgress(ctx, contract, next); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.SaveScanProgress(ctx, testContract, 120); err != nil {
+			t.Fatal(err)
+		}
+		progress, err := store.GetScanProgress(ctx, testContract)
+		if err != nil || progress == nil || progress.NextBlock != 120 {
+			t.Errorf("GetScanProgress = %+v, %v; want next block 120", progress, err)
+		}
+		if block, err := store.GetIndexedBlock(ctx); err != nil || block != 49 {
+			t.Errorf("GetIndexedBlock = %d, %v; want 49", block, err)
+		}
+	})
+
+	t.Run("paused contracts", func(t *testing.T) {
+		store := open(t)
+		other := "0x00000000000000000000000000000000000000C1"
+		for _, address := range []string{testContract, other} {
+			if err := store.SetContractPaused(ctx, address, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.SetContractPaused(ctx, other, false); err != nil {
+			t.Fatal(err)
+		}
+		paused, err := store.GetPausedContracts(ctx)
+		if err != nil || !sameIds(paused, testContract) {
+			t.Errorf("GetPausedContracts = %v, %v; want [%s]", paused, err, testContract)
+		}
+	})
+
+	t.Run("dead letters", func(t *testing.T) {
+		store := open(t)
+		rawLog := RawLog{Address: testContract, TxHash: "0x0c", LogIndex: 3, BlockNumber: 10}
+		for _, cause := range []string{"first", "second"} {
+			if err := store.SaveDeadLetter(ctx, rawLog, cause); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		letters, err := store.GetDeadLetters(ctx, ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(letters) != 1 || letters[0].Attempts != 2 || letters[0].Error != "second" {
+			t.Fatalf("GetDeadLetters = %+v, want one letter failed twice", letters)
+		}
+		letter, err := store.GetDeadLetter(ctx, letters[0].ID)
+		if err != nil || letter.Log.TxHash != rawLog.TxHash {
+			t.Errorf("GetDeadLetter = %+v, %v", letter, err)
+		}
+		if err := store.DeleteDeadLetter(ctx, letters[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetDeadLetter(ctx, letters[0].ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetDeadLetter after delete: err = %v, want ErrNotFound", err)
+		}
+	})
+}
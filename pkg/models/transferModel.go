@@ -0,0 +1,376 @@
+package nftModel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aman/nft-tracker/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var transferCollection *mongo.Collection
+
+// Transfer is a single Transfer event, identified by txHash + logIndex. The
+// unique index on that pair is what makes replaying a block range safe.
+type Transfer struct {
+	ID              primitive.ObjectID   `bson:"_id,omitempty"`
+	ContractAddress string               `bson:"contractAddress"`
+	NftID           primitive.Decimal128 `bson:"nftId"`
+	FromAddress     string               `bson:"fromAddress"`
+	ToAddress       string               `bson:"toAddress"`
+	TxHash          string               `bson:"txHash"`
+	LogIndex        uint                 `bson:"logIndex"`
+	BlockNumber     uint64               `bson:"blockNumber"`
+	BlockHash       string               `bson:"blockHash"`
+	TimeStamp       time.Time            `bson:"timestamp"`
+	Sale            *Sale                `bson:"sale,omitempty"`
+	RawTokenID      string               `bson:"rawTokenId,omitempty"`
+	ChainID         int64                `bson:"chainId"`
+	// Mint marks transfers out of the zero address.
+	Mint bool `bson:"mint,omitempty"`
+}
+
+func GetTransferCollection() *mongo.Collection {
+	transferCollection = config.GetCollection(os.Getenv("DB_NAME"), collectionName("TRANSFER_COLLECTION", "transfers"))
+	return transferCollection
+}
+
+func CreateTransferIndexes() {
+	ctx, cancel := indexContext()
+	defer cancel()
+
+	convertLegacyNftIds(ctx, transferCollection)
+	stampLegacyChainID(ctx, transferCollection)
+	flagLegacyMints(ctx)
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "chainId", Value: 1}, {Key: "txHash", Value: 1}, {Key: "logIndex", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "contractAddress", Value: 1}, {Key: "nftId", Value: 1}, {Key: "blockNumber", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "contractAddress", Value: 1}, {Key: "timestamp", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "fromAddress", Value: 1}, {Key: "blockNumber", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "toAddress", Value: 1}, {Key: "blockNumber", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "contractAddress", Value: 1}, {Key: "blockNumber", Value: 1}, {Key: "logIndex", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"mint": true}),
+		},
+	}
+
+	buildIndexes(transferCollection, indexModels, func(ctx context.Context) {
+		if _, err := transferCollection.Indexes().DropOne(ctx, "txHash_1_logIndex_1"); err == nil {
+			log.Println("Dropped unique index on txHash, logIndex")
+		}
+	})
+}
+
+// flagLegacyMints sets the mint flag on transfers recorded before it
+// existed.
+func flagLegacyMints(ctx context.Context) {
+	filter := bson.M{"fromAddress": ZeroAddress, "mint": bson.M{"$exists": false}}
+	result, err := transferCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"mint": true}})
+	if err != nil {
+		log.Fatalf("Failed to flag legacy mints: %v", err)
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Flagged %d legacy transfers as mints", result.ModifiedCount)
+	}
+}
+
+// InsertTransfers stores a batch of transfer events, skipping any that were
+// already recorded by an earlier run or backfill.
+func (MongoStore) InsertTransfers(ctx context.Context, transfers []Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	docs := make([]interface{}, 0, len(transfers))
+	for _, transfer := range transfers {
+		docs = append(docs, transfer)
+	}
+
+	opts := options.InsertMany().SetOrdered(false)
+	_, err := transferCollection.InsertMany(ctx, docs, opts)
+	if err != nil && !onlyDuplicateKeyErrors(err) {
+		log.Printf("Failed to insert transfers into MongoDB: %v", err)
+		return err
+	}
+	return nil
+}
+
+func onlyDuplicateKeyErrors(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	ActivityHour = "hour"
+	ActivityDay  = "day"
+)
+
+type ActivityBucket struct {
+	Bucket time.Time `bson:"_id" json:"bucket"`
+	Count  int64     `bson:"count" json:"count"`
+}
+
+// GetContractActivity counts a contract's transfers per hour or day (UTC)
+// in [from, to). Buckets without transfers are included with a zero count.
+func (MongoStore) GetContractActivity(ctx context.Context, contractAddress, interval string, from, to time.Time) ([]ActivityBucket, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	parts := bson.M{
+		"year":  bson.M{"$year": "$timestamp"},
+		"month": bson.M{"$month": "$timestamp"},
+		"day":   bson.M{"$dayOfMonth": "$timestamp"},
+	}
+	step := 24 * time.Hour
+	if interval == ActivityHour {
+		parts["hour"] = bson.M{"$hour": "$timestamp"}
+		step = time.Hour
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"contractAddress": contractAddress,
+			"timestamp":       bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$dateFromParts": parts},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := transferCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Failed to aggregate contract activity: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var counted []ActivityBucket
+	err = cursor.All(ctx, &counted)
+	if err != nil {
+		log.Printf("Failed to decode contract activity: %v", err)
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(counted))
+	for _, bucket := range counted {
+		counts[bucket.Bucket.Unix()] = bucket.Count
+	}
+
+	var buckets []ActivityBucket
+	for bucket := from.UTC().Truncate(step); bucket.Before(to); bucket = bucket.Add(step) {
+		buckets = append(buckets, ActivityBucket{Bucket: bucket, Count: counts[bucket.Unix()]})
+	}
+	return buckets, nil
+}
+
+const (
+	DirectionIn   = "in"
+	DirectionOut  = "out"
+	DirectionSelf = "self"
+)
+
+type WalletTransfer struct {
+	Transfer  `bson:",inline"`
+	Direction string
+}
+
+func transferDirection(transfer Transfer, walletAddress string) string {
+	switch {
+	case transfer.FromAddress == walletAddress && transfer.ToAddress == walletAddress:
+		return DirectionSelf
+	case transfer.ToAddress == walletAddress:
+		return DirectionIn
+	default:
+		return DirectionOut
+	}
+}
+
+// GetWalletTransfers returns the transfers a wallet sent or received,
+// newest first.
+func (MongoStore) GetWalletTransfers(ctx context.Context, walletAddress string, opts ListOptions) ([]WalletTransfer, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"fromAddress": walletAddress},
+		bson.M{"toAddress": walletAddress},
+	}}
+	if opts.ChainID != nil {
+		filter["chainId"] = *opts.ChainID
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "blockNumber", Value: -1}, {Key: "logIndex", Value: -1}, {Key: "_id", Value: -1}})
+	findOptions.SetLimit(limit)
+	if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
+
+	cursor, err := transferCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find wallet transfers: %v", err)
+		return nil, fmt.Errorf("list wallet transfers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var transfers []WalletTransfer
+	for cursor.Next(ctx) {
+		var transfer WalletTransfer
+		if err := cursor.Decode(&transfer.Transfer); err != nil {
+			log.Printf("Failed to decode document: %v", err)
+			return nil, fmt.Errorf("list wallet transfers: decode: %w", err)
+		}
+
+		transfer.Direction = transferDirection(transfer.Transfer, walletAddress)
+		transfers = append(transfers, transfer)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Cursor error: %v", err)
+		return nil, fmt.Errorf("list wallet transfers: cursor: %w", err)
+	}
+
+	return transfers, nil
+}
+
+// GetOwnerAtBlock returns who held a token once block had been applied,
+// from the most recent transfer at or before it. It relies on the transfer
+// history, so it finds nothing under PERSIST_MODE=state.
+func (MongoStore) GetOwnerAtBlock(ctx context.Context, contractAddress string, key TokenKey, block uint64) (string, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	filter := key.filter(bson.M{
+		"contractAddress": contractAddress,
+		"blockNumber":     bson.M{"$lte": block},
+	})
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "blockNumber", Value: -1}, {Key: "logIndex", Value: -1}})
+
+	var transfer Transfer
+	err := transferCollection.FindOne(ctx, filter, findOptions).Decode(&transfer)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", fmt.Errorf("nft %s #%s at block %d: %w", contractAddress, key, block, ErrNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to find transfer: %v", err)
+		return "", fmt.Errorf("find owner of %s #%s at block %d: %w", contractAddress, key, block, err)
+	}
+	return transfer.ToAddress, nil
+}
+
+// TokenSnapshot is one token's owner as of a snapshot block.
+type TokenSnapshot struct {
+	NftID primitive.Decimal128 `bson:"nftId" json:"tokenId"`
+	// RawTokenID tells apart tokens stored as RawTokenNftID.
+	RawTokenID   string `bson:"rawTokenId,omitempty" json:"rawTokenId,omitempty"`
+	OwnerAddress string `bson:"ownerAddress" json:"ownerAddress"`
+	// BlockNumber is the block of the transfer that gave OwnerAddress the
+	// token.
+	BlockNumber uint64 `bson:"blockNumber" json:"blockNumber"`
+}
+
+// GetContractSnapshot returns the owner of every token in a contract as of
+// block, for airdrops and similar "who held what" questions. Tokens burned
+// by then are left out.
+func (MongoStore) GetContractSnapshot(ctx context.Context, contractAddress string, block uint64) ([]TokenSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"contractAddress": contractAddress, "blockNumber": bson.M{"$lte": block}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "nftId", Value: 1}, {Key: "rawTokenId", Value: 1}, {Key: "blockNumber", Value: -1}, {Key: "logIndex", Value: -1}}}},
+		// Raw tokens all share RawTokenNftID, so they are grouped by
+		// rawTokenId as well.
+		{{Key: "$group", Value: bson.M{
+			"_id":          bson.M{"nftId": "$nftId", "rawTokenId": "$rawTokenId"},
+			"ownerAddress": bson.M{"$first": "$toAddress"},
+			"blockNumber":  bson.M{"$first": "$blockNumber"},
+		}}},
+		{{Key: "$match", Value: bson.M{"ownerAddress": bson.M{"$ne": ZeroAddress}}}},
+		{{Key: "$set", Value: bson.M{"nftId": "$_id.nftId", "rawTokenId": "$_id.rawTokenId"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "nftId", Value: 1}, {Key: "rawTokenId", Value: 1}}}},
+	}
+
+	cursor, err := transferCollection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		log.Printf("Failed to aggregate snapshot: %v", err)
+		return nil, fmt.Errorf("snapshot %s at block %d: %w", contractAddress, block, err)
+	}
+	defer cursor.Close(ctx)
+
+	var snapshot []TokenSnapshot
+	err = cursor.All(ctx, &snapshot)
+	if err != nil {
+		log.Printf("Failed to decode snapshot: %v", err)
+		return nil, fmt.Errorf("snapshot %s at block %d: decode: %w", contractAddress, block, err)
+	}
+	return snapshot, nil
+}
+
+// GetMints returns a contract's mint transfers in blocks [fromBlock,
+// toBlock], oldest first. Like the rest of the history it finds nothing
+// under PERSIST_MODE=state.
+func (MongoStore) GetMints(ctx context.Context, contractAddress string, fromBlock, toBlock uint64, opts ListOptions) ([]Transfer, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+
+	limit, _ := ClampLimit(opts.Limit)
+
+	filter := bson.M{
+		"contractAddress": contractAddress,
+		"mint":            true,
+		"blockNumber":     bson.M{"$gte": fromBlock, "$lte": toBlock},
+	}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "blockNumber", Value: 1}, {Key: "logIndex", Value: 1}})
+	findOptions.SetLimit(limit)
+	if opts.Offset > 0 {
+		findOptions.SetSkip(opts.Offset)
+	}
+
+	cursor, err := transferCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Printf("Failed to find mints: %v", err)
+		return nil, fmt.Errorf("list mints for %s: %w", contractAddress, err)
+	}
+	defer cursor.Close(ctx)
+
+	var mints []Transfer
+	err = cursor.All(ctx, &mints)
+	if err != nil {
+		log.Printf("Failed to decode mints: %v", err)
+		return nil, fmt.Errorf("list mints for %s: decode: %w", contractAddress, err)
+	}
+	return mints, nil
+}
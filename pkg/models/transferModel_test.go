@@ -0,0 +1,69 @@
+package nftModel
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+const testContract = "0x00000000000000000000000000000000000000C0"
+
+func rawTokenKey(t *testing.T, hex string) TokenKey {
+	t.Helper()
+	id, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		t.Fatalf("bad token ID %s", hex)
+	}
+	key, err := KeyForTokenID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.RawTokenID == "" {
+		t.Fatalf("token ID %s fits Decimal128, want a raw key", hex)
+	}
+	return key
+}
+
+func TestRawTokensStayApart(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	store.Init(1, false)
+
+	first := rawTokenKey(t, "ff00000000000000000000000000000000000000000000000000000000000001")
+	second := rawTokenKey(t, "ff00000000000000000000000000000000000000000000000000000000000002")
+	alice, bob := "0x000000000000000000000000000000000000A11c", "0x0000000000000000000000000000000000000B0b"
+
+	transfers := []Transfer{
+		{ChainID: 1, ContractAddress: testContract, NftID: first.NftID, RawTokenID: first.RawTokenID, FromAddress: ZeroAddress, ToAddress: alice, TxHash: "0x01", BlockNumber: 10},
+		{ChainID: 1, ContractAddress: testContract, NftID: second.NftID, RawTokenID: second.RawTokenID, FromAddress: ZeroAddress, ToAddress: bob, TxHash: "0x02", BlockNumber: 11},
+	}
+	if err := store.InsertTransfers(ctx, transfers); err != nil {
+		t.Fatal(err)
+	}
+	nfts := []NFT{
+		{ChainID: 1, ContractAddress: testContract, NftID: first.NftID, RawTokenID: first.RawTokenID, OwnerAddress: alice, BlockNumber: 10},
+		{ChainID: 1, ContractAddress: testContract, NftID: second.NftID, RawTokenID: second.RawTokenID, OwnerAddress: bob, BlockNumber: 11},
+	}
+	if _, err := store.BulkUpsertNFTs(ctx, nfts); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := store.GetContractSnapshot(ctx, testContract, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 2 || snapshot[0].RawTokenID != first.RawTokenID || snapshot[1].RawTokenID != second.RawTokenID {
+		t.Fatalf("snapshot = %+v, want both raw tokens", snapshot)
+	}
+
+	for key, owner := range map[TokenKey]string{first: alice, second: bob} {
+		got, err := store.GetOwnerAtBlock(ctx, testContract, key, 20)
+		if err != nil || got != owner {
+			t.Errorf("GetOwnerAtBlock(%s) = %q, %v; want %q", key, got, err, owner)
+		}
+		nft, err := store.GetNftByToken(ctx, testContract, key)
+		if err != nil || nft.OwnerAddress != owner {
+			t.Errorf("GetNftByToken(%s) = %+v, %v; want owner %q", key, nft, err, owner)
+		}
+	}
+}
@@ -1,11 +1,51 @@
 package nftroutes
 
 import (
+	"os"
+	"strings"
+
 	nftcontroller "github.com/aman/nft-tracker/pkg/controllers"
 	"github.com/gorilla/mux"
 )
 
-var NftDetails = func(router *mux.Router) {
-	router.HandleFunc("/nft", nftcontroller.GetAllNfts)
-	router.HandleFunc("/nft/{walletAddress}", nftcontroller.GetWalletNfts)
+// NftDetails registers the API on router, under API_BASE_PATH when set
+// (e.g. /api/v1 behind a reverse proxy).
+var NftDetails = func(router *mux.Router, controller *nftcontroller.Controller) {
+	basePath := strings.TrimSuffix(os.Getenv("API_BASE_PATH"), "/")
+	if basePath != "" {
+		if !strings.HasPrefix(basePath, "/") {
+			basePath = "/" + basePath
+		}
+		router = router.PathPrefix(basePath).Subrouter()
+	}
+
+	router.HandleFunc("/nft", controller.GetAllNfts)
+	router.HandleFunc("/nft/changes", controller.GetNftChanges).Methods("GET")
+	router.HandleFunc("/nft/{walletAddress}", controller.GetWalletNfts)
+	router.HandleFunc("/nft/{walletAddress}/summary", controller.GetWalletSummary).Methods("GET")
+	router.HandleFunc("/nft/{walletAddress}/transfers", controller.GetWalletTransfers).Methods("GET")
+	router.HandleFunc("/nft/tx/{txHash}", controller.GetNftsByTxHash).Methods("GET")
+	router.HandleFunc("/nft/token/{contract}/{tokenId}/owner", controller.GetTokenOwner).Methods("GET")
+	router.HandleFunc("/nft/token/{contract}/{tokenId}/wrapped", controller.GetWrappedTokens).Methods("GET")
+	router.HandleFunc("/nft/token/{contract}/{tokenId}/image", controller.GetTokenImage).Methods("GET")
+	router.HandleFunc("/nft/contract/{address}/search", controller.SearchContractNfts).Methods("GET")
+	router.HandleFunc("/nft/contract/{address}/activity", controller.GetContractActivity).Methods("GET")
+	router.HandleFunc("/nft/contract/{address}/market", controller.GetContractMarket).Methods("GET")
+	router.HandleFunc("/nft/contract/{address}/snapshot", controller.GetContractSnapshot).Methods("GET")
+	router.HandleFunc("/nft/contract/{address}/mints", controller.GetMints).Methods("GET")
+	router.HandleFunc("/contracts/{address}/stats", controller.GetContractStats)
+	router.HandleFunc("/stats/contracts", controller.GetContractCounts).Methods("GET")
+	router.HandleFunc("/status", controller.GetStatus).Methods("GET")
+	router.HandleFunc("/ready", controller.GetReady).Methods("GET")
+	router.HandleFunc("/openapi.json", nftcontroller.OpenAPI(router, basePath)).Methods("GET")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(nftcontroller.RequireAPIKey)
+	admin.HandleFunc("/backfill", controller.PostBackfill).Methods("POST")
+	admin.HandleFunc("/rescan", controller.PostRescan).Methods("POST")
+	admin.HandleFunc("/contracts/{address}/pause", controller.PostPauseContract).Methods("POST")
+	admin.HandleFunc("/contracts/{address}/resume", controller.PostResumeContract).Methods("POST")
+	admin.HandleFunc("/config", controller.GetConfig).Methods("GET")
+	admin.HandleFunc("/deadletters", controller.GetDeadLetters).Methods("GET")
+	admin.HandleFunc("/deadletters/{id}/replay", controller.PostReplayDeadLetter).Methods("POST")
 }
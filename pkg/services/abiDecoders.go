@@ -0,0 +1,190 @@
+package trackingService
+
+import (
+	"embed"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// builtinABIs can be referenced from CONTRACT_OPTIONS by file name without
+// the extension, e.g. "abi": "erc721".
+//
+//go:embed abis/*.json
+var builtinABIs embed.FS
+
+type abiEventSpec struct {
+	name    string
+	topic   common.Hash
+	decoder TransferDecoder
+}
+
+// loadABI reads the ABI named ref from the built-in set, or from the file
+// at ref otherwise.
+func loadABI(ref string) (abi.ABI, error) {
+	file, err := builtinABIs.Open("abis/" + ref + ".json")
+	if err != nil {
+		file, err = os.Open(ref)
+		if err != nil {
+			return abi.ABI{}, fmt.Errorf("failed to open ABI %q: %v", ref, err)
+		}
+	}
+	defer file.Close()
+
+	parsed, err := abi.JSON(file)
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("failed to parse ABI %q: %v", ref, err)
+	}
+	return parsed, nil
+}
+
+// parseABIEvents builds decoders for the named events of the ABI at ref, or
+// for every event in it that carries a transfer when names is empty. As
+// with signatures in "events", inputs named from, to and tokenId (or id)
+// carry the transfer.
+func parseABIEvents(ref string, names []string) ([]abiEventSpec, error) {
+	contractABI, err := loadABI(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		for name, event := range contractABI.Events {
+			if _, err := abiEventRoles(event); err == nil {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("ABI %q has no event with to and tokenId inputs", ref)
+		}
+		sort.Strings(names)
+	}
+
+	specs := make([]abiEventSpec, 0, len(names))
+	for _, name := range names {
+		event, ok := contractABI.Events[name]
+		if !ok {
+			return nil, fmt.Errorf("ABI %q has no event %q", ref, name)
+		}
+		decoder, err := abiEventDecoder(event)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, abiEventSpec{name: name, topic: event.ID, decoder: decoder})
+	}
+	return specs, nil
+}
+
+// abiEventRoles maps the input index of each transfer parameter to its
+// role.
+func abiEventRoles(event abi.Event) (map[int]string, error) {
+	roles := make(map[int]string)
+	seen := make(map[string]bool)
+	for i, input := range event.Inputs {
+		role := input.Name
+		switch role {
+		case "from", "to":
+			if input.Type.T != abi.AddressTy {
+				return nil, fmt.Errorf("event %s: %s must be an address, not %s", event.Name, role, input.Type.String())
+			}
+		case "tokenId", "tokenID", "id":
+			role = "tokenId"
+			if input.Type.T != abi.UintTy && input.Type.T != abi.IntTy {
+				return nil, fmt.Errorf("event %s: %s must be an integer, not %s", event.Name, input.Name, input.Type.String())
+			}
+		default:
+			continue
+		}
+		if seen[role] {
+			return nil, fmt.Errorf("event %s has more than one %s input", event.Name, role)
+		}
+		seen[role] = true
+		roles[i] = role
+	}
+
+	if !seen["to"] || !seen["tokenId"] {
+		return nil, fmt.Errorf("event %s needs inputs named to and tokenId", event.Name)
+	}
+	return roles, nil
+}
+
+// abiEventDecoder reads the transfer from an event using its ABI, so
+// unlike signature-based decoders it copes with dynamic parameters in the
+// data.
+func abiEventDecoder(event abi.Event) (TransferDecoder, error) {
+	roles, err := abiEventRoles(event)
+	if err != nil {
+		return nil, err
+	}
+	nonIndexed := event.Inputs.NonIndexed()
+
+	return func(delog types.Log) (*TransferEvent, error) {
+		values, err := nonIndexed.Unpack(delog.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack %s log %s:%d: %v", event.Name, delog.TxHash.Hex(), delog.Index, err)
+		}
+
+		result := &TransferEvent{}
+		topic, value := 1, 0
+		for i, input := range event.Inputs {
+			var address common.Address
+			var number *big.Int
+			if input.Indexed {
+				if topic >= len(delog.Topics) {
+					return nil, fmt.Errorf("log %s:%d has too few topics for %s", delog.TxHash.Hex(), delog.Index, event.Name)
+				}
+				address = common.BytesToAddress(delog.Topics[topic].Bytes())
+				number = delog.Topics[topic].Big()
+				topic++
+			} else {
+				if role, ok := roles[i]; ok {
+					address, number, err = abiValue(values[value], role)
+					if err != nil {
+						return nil, fmt.Errorf("%s log %s:%d: %v", event.Name, delog.TxHash.Hex(), delog.Index, err)
+					}
+				}
+				value++
+			}
+
+			switch roles[i] {
+			case "from":
+				result.From = address
+			case "to":
+				result.To = address
+			case "tokenId":
+				result.TokenID = number
+			}
+		}
+		return result, nil
+	}, nil
+}
+
+// abiValue converts an unpacked value, which the abi package returns as
+// common.Address, *big.Int or a sized Go integer.
+func abiValue(value interface{}, role string) (common.Address, *big.Int, error) {
+	if role != "tokenId" {
+		address, ok := value.(common.Address)
+		if !ok {
+			return common.Address{}, nil, fmt.Errorf("unexpected %s type %T", role, value)
+		}
+		return address, nil, nil
+	}
+
+	if number, ok := value.(*big.Int); ok {
+		return common.Address{}, number, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return common.Address{}, new(big.Int).SetUint64(v.Uint()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return common.Address{}, big.NewInt(v.Int()), nil
+	}
+	return common.Address{}, nil, fmt.Errorf("unexpected tokenId type %T", value)
+}
@@ -0,0 +1,27 @@
+package trackingService
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// parseConfigAddress is the strict address parser for configuration.
+// HexToAddress pads or truncates anything it's given, so entries must be
+// 40 hex digits, and mixed-case entries must carry a valid EIP-55 checksum.
+func parseConfigAddress(raw string) (common.Address, error) {
+	value := strings.TrimSpace(raw)
+	if !common.IsHexAddress(value) {
+		return common.Address{}, fmt.Errorf("%q is not a hex address", raw)
+	}
+
+	address := common.HexToAddress(value)
+	digits := strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) {
+		if "0x"+digits != address.Hex() {
+			return common.Address{}, fmt.Errorf("%q has an invalid EIP-55 checksum, expected %s", raw, address.Hex())
+		}
+	}
+	return address, nil
+}
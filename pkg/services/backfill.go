@@ -0,0 +1,97 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrInvalidBackfill = errors.New("invalid backfill request")
+	ErrBackfillBusy    = errors.New("a backfill is already queued")
+)
+
+type BackfillRequest struct {
+	FromBlock int64  `json:"fromBlock"`
+	ToBlock   int64  `json:"toBlock"`
+	Contract  string `json:"contract,omitempty"`
+}
+
+// StartBackfill queues a reprocessing of the given block range. It runs
+// alongside the live loop without touching scan progress; the transfer
+// dedupe and ordered upserts make re-running a range safe. Ranges longer
+// than MAX_BACKFILL_RANGE blocks are rejected.
+func (t *TransferEventTracker) StartBackfill(req BackfillRequest) error {
+	if req.FromBlock < 0 || req.ToBlock < req.FromBlock {
+		return fmt.Errorf("%w: fromBlock must be non-negative and not after toBlock", ErrInvalidBackfill)
+	}
+	if span := req.ToBlock - req.FromBlock + 1; t.maxBackfillRange > 0 && span > t.maxBackfillRange {
+		return fmt.Errorf("%w: %d blocks exceeds MAX_BACKFILL_RANGE of %d, split it into smaller requests", ErrInvalidBackfill, span, t.maxBackfillRange)
+	}
+
+	if req.Contract != "" {
+		if !common.IsHexAddress(req.Contract) || !t.isTracked(common.HexToAddress(req.Contract)) {
+			return fmt.Errorf("%w: %s is not a tracked contract", ErrInvalidBackfill, req.Contract)
+		}
+	}
+
+	select {
+	case t.backfills <- req:
+		return nil
+	default:
+		return ErrBackfillBusy
+	}
+}
+
+func (t *TransferEventTracker) serveBackfills(ctx context.Context) {
+	for {
+		select {
+		case req := <-t.backfills:
+			t.runBackfill(ctx, req)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *TransferEventTracker) runBackfill(ctx context.Context, req BackfillRequest) {
+	addrs := t.contractAddrs
+	if req.Contract != "" {
+		addrs = []common.Address{common.HexToAddress(req.Contract)}
+	}
+
+	log.Printf("Starting backfill of blocks %d-%d for %d contract(s)", req.FromBlock, req.ToBlock, len(addrs))
+
+	for start := req.FromBlock; start <= req.ToBlock; start += t.chunkSize {
+		end := start + t.chunkSize - 1
+		if end > req.ToBlock {
+			end = req.ToBlock
+		}
+
+		err := t.processRange(ctx, start, end, addrs, nil, true)
+		if err != nil {
+			log.Printf("Backfill of blocks %d-%d failed: %v", start, end, err)
+			return
+		}
+	}
+
+	err := t.batcher.Flush()
+	if err != nil {
+		log.Printf("Failed to flush backfill batch: %v", err)
+		return
+	}
+
+	log.Printf("Finished backfill of blocks %d-%d", req.FromBlock, req.ToBlock)
+}
+
+func (t *TransferEventTracker) isTracked(addr common.Address) bool {
+	for _, tracked := range t.contractAddrs {
+		if tracked == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package trackingService
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+)
+
+const (
+	batchRetryBackoff    = 500 * time.Millisecond
+	maxBatchRetryBackoff = 30 * time.Second
+)
+
+// batchError is a full batch that still couldn't be written when Add gave
+// up. The log being processed wasn't queued, so rather than dead-letter it
+// the range is aborted before its checkpoint and scanned again later.
+type batchError struct {
+	err error
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("failed to write NFT batch: %v", e.err)
+}
+
+func (e *batchError) Unwrap() error {
+	return e.err
+}
+
+// nftBatcher buffers NFT upserts and their transfer events and writes them
+// with BulkUpsertNFTs once the batch reaches its size or the flush interval
+// elapses, whichever comes first.
+type nftBatcher struct {
+	mu        sync.Mutex
+	pending   []nftModel.NFT
+	transfers []nftModel.Transfer
+	size      int
+	interval  time.Duration
+	stop      chan struct{}
+	stopped   chan struct{}
+	// onFlush, if set, is called with each batch once it has been written.
+	onFlush func([]nftModel.NFT)
+	// onFailed, if set, is called with the upserts BulkUpsertNFTs gave up
+	// on. They are dropped from the batch either way.
+	onFailed func([]nftModel.FailedUpsert)
+}
+
+func newNFTBatcher(size int, interval time.Duration, onFlush func([]nftModel.NFT), onFailed func([]nftModel.FailedUpsert)) *nftBatcher {
+	b := &nftBatcher{
+		pending:   make([]nftModel.NFT, 0, size),
+		transfers: make([]nftModel.Transfer, 0, size),
+		size:      size,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		onFlush:   onFlush,
+		onFailed:  onFailed,
+	}
+	go b.loop()
+	return b
+}
+
+// Add queues an upsert, a transfer record or both; either may be nil when
+// the persist mode doesn't keep that collection.
+//
+// Nothing more is queued while a full batch can't be written, so a
+// database outage can't grow the buffer without bound: Add retries the
+// flush with a backoff, blocking its caller, and gives up with a
+// *batchError once ctx is done.
+func (b *nftBatcher) Add(ctx context.Context, nft *nftModel.NFT, transfer *nftModel.Transfer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	backoff := batchRetryBackoff
+	for b.full() {
+		err := b.flushLocked()
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to flush full NFT batch, retrying in %s: %v", backoff, err)
+
+		b.mu.Unlock()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			b.mu.Lock()
+			return &batchError{err: err}
+		}
+		b.mu.Lock()
+		if backoff *= 2; backoff > maxBatchRetryBackoff {
+			backoff = maxBatchRetryBackoff
+		}
+	}
+
+	if nft != nil {
+		b.pending = append(b.pending, *nft)
+	}
+	if transfer != nil {
+		b.transfers = append(b.transfers, *transfer)
+	}
+	if b.full() {
+		// The batch stays queued on failure; the next Add or tick retries.
+		err := b.flushLocked()
+		if err != nil {
+			log.Printf("Failed to flush NFT batch: %v", err)
+		}
+	}
+	return nil
+}
+
+func (b *nftBatcher) full() bool {
+	return len(b.pending) >= b.size || len(b.transfers) >= b.size
+}
+
+// SetSize changes how many records trigger a flush, flushing straight away
+// if the new size is already reached.
+func (b *nftBatcher) SetSize(size int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size = size
+	if b.full() {
+		return b.flushLocked()
+	}
+	return nil
+}
+
+func (b *nftBatcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.flushLocked()
+}
+
+// flushLocked keeps the pending items on failure so the next flush retries
+// them instead of dropping them.
+func (b *nftBatcher) flushLocked() error {
+	if len(b.pending) == 0 && len(b.transfers) == 0 {
+		return nil
+	}
+
+	if len(b.transfers) > 0 {
+		err := nftModel.InsertTransfers(context.Background(), b.transfers)
+		if err != nil {
+			return err
+		}
+		log.Printf("Flushed %d transfers through block %d", len(b.transfers), b.transfers[len(b.transfers)-1].BlockNumber)
+		b.transfers = b.transfers[:0]
+	}
+
+	if len(b.pending) == 0 {
+		return nil
+	}
+	result, err := nftModel.BulkUpsertNFTs(context.Background(), b.pending)
+	if err != nil {
+		return err
+	}
+
+	written := b.pending
+	if len(result.Failed) > 0 {
+		log.Printf("Failed to write %d of %d NFT updates", len(result.Failed), len(b.pending))
+		if b.onFailed != nil {
+			b.onFailed(result.Failed)
+		}
+		written = withoutFailed(b.pending, result.Failed)
+	}
+
+	log.Printf("Flushed %d NFT updates through block %d", result.Succeeded, b.pending[len(b.pending)-1].BlockNumber)
+	if b.onFlush != nil && len(written) > 0 {
+		b.onFlush(written)
+	}
+	b.pending = b.pending[:0]
+	return nil
+}
+
+// withoutFailed returns the NFTs of a batch that were written.
+func withoutFailed(nfts []nftModel.NFT, failed []nftModel.FailedUpsert) []nftModel.NFT {
+	skip := make(map[int]bool, len(failed))
+	for _, f := range failed {
+		skip[f.Index] = true
+	}
+
+	written := make([]nftModel.NFT, 0, len(nfts)-len(failed))
+	for i, nft := range nfts {
+		if !skip[i] {
+			written = append(written, nft)
+		}
+	}
+	return written
+}
+
+func (b *nftBatcher) loop() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := b.Flush()
+			if err != nil {
+				log.Printf("Failed to flush NFT batch: %v", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Close stops the flush timer and writes out anything still pending.
+func (b *nftBatcher) Close() error {
+	close(b.stop)
+	<-b.stopped
+	return b.Flush()
+}
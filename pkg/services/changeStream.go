@@ -0,0 +1,37 @@
+package trackingService
+
+import (
+	"context"
+	"log"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// watchNftChanges keeps the owner and tokenURI caches in step with writes
+// from other instances, such as a separate indexer feeding several API
+// servers. It reconnects after the stream fails.
+func (t *TransferEventTracker) watchNftChanges(ctx context.Context) {
+	for {
+		err := nftModel.WatchNftChanges(ctx, func(change nftModel.NftChange) {
+			tokenId, err := nftModel.Decimal128ToBigInt(change.NftID)
+			if err != nil {
+				return
+			}
+			contract := common.HexToAddress(change.ContractAddress)
+			t.owners.invalidate(contract, tokenId)
+			t.tokenURIs.invalidate(contract, tokenId)
+		})
+		if err == nil {
+			return
+		}
+
+		log.Printf("NFT change stream stopped: %v, reconnecting in 5s", err)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
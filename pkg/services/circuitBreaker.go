@@ -0,0 +1,145 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var ErrCircuitOpen = errors.New("RPC circuit breaker is open")
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+}
+
+// circuitBreaker wraps an EthClient and stops calling it after threshold
+// consecutive failures. Once cooldown has passed a single trial call is let
+// through; success closes the breaker and failure reopens it. Reverts and
+// cancelled calls say nothing about the provider's health and don't count.
+type circuitBreaker struct {
+	client    EthClient
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(client EthClient, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{client: client, threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		log.Printf("RPC circuit breaker half-open, sending a trial call")
+		return nil
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || strings.Contains(err.Error(), "execution reverted") {
+		if b.state != BreakerClosed {
+			log.Printf("RPC circuit breaker closed")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			log.Printf("RPC circuit breaker open after %d consecutive failures: %v", b.failures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+func (b *circuitBreaker) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	header, err := b.client.HeaderByNumber(ctx, number)
+	b.record(err)
+	return header, err
+}
+
+func (b *circuitBreaker) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	logs, err := b.client.FilterLogs(ctx, query)
+	b.record(err)
+	return logs, err
+}
+
+func (b *circuitBreaker) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	sub, err := b.client.SubscribeFilterLogs(ctx, query, ch)
+	b.record(err)
+	return sub, err
+}
+
+func (b *circuitBreaker) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	output, err := b.client.CallContract(ctx, msg, blockNumber)
+	b.record(err)
+	return output, err
+}
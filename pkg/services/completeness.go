@@ -0,0 +1,80 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type ContractStats struct {
+	ContractAddress     string  `json:"contractAddress"`
+	SupportsTotalSupply bool    `json:"supportsTotalSupply"`
+	TotalSupply         string  `json:"totalSupply,omitempty"`
+	IndexedCount        int64   `json:"indexedCount"`
+	Gap                 string  `json:"gap,omitempty"`
+	DivergencePercent   float64 `json:"divergencePercent"`
+	Divergent           bool    `json:"divergent"`
+}
+
+// CheckCompleteness compares the on-chain totalSupply of a contract against
+// the number of non-burned tokens we have indexed for it.
+func (t *TransferEventTracker) CheckCompleteness(ctx context.Context, contract common.Address) (*ContractStats, error) {
+	indexed, err := nftModel.CountContractNfts(ctx, contract.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ContractStats{
+		ContractAddress: contract.Hex(),
+		IndexedCount:    indexed,
+	}
+
+	supply, err := t.TotalSupply(ctx, contract)
+	if errors.Is(err, ErrCallReverted) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gap := new(big.Int).Sub(supply, big.NewInt(indexed))
+	stats.SupportsTotalSupply = true
+	stats.TotalSupply = supply.String()
+	stats.Gap = gap.String()
+
+	switch {
+	case supply.Sign() > 0:
+		percent, _ := new(big.Float).Quo(
+			new(big.Float).SetInt(new(big.Int).Abs(gap)),
+			new(big.Float).SetInt(supply),
+		).Float64()
+		stats.DivergencePercent = percent * 100
+	case indexed > 0:
+		stats.DivergencePercent = 100
+	}
+	stats.Divergent = stats.DivergencePercent > t.divergenceThreshold
+
+	return stats, nil
+}
+
+func (t *TransferEventTracker) reportCompleteness(ctx context.Context) {
+	for _, addr := range t.contractAddrs {
+		stats, err := t.CheckCompleteness(ctx, addr)
+		if err != nil {
+			log.Printf("Failed to check completeness for %s: %v", addr.Hex(), err)
+			continue
+		}
+		if !stats.SupportsTotalSupply {
+			continue
+		}
+		if stats.Divergent {
+			log.Printf("Contract %s: indexed %d of %s tokens (%.2f%% off), consider re-scanning", stats.ContractAddress, stats.IndexedCount, stats.TotalSupply, stats.DivergencePercent)
+		} else {
+			log.Printf("Contract %s: indexed %d of %s tokens", stats.ContractAddress, stats.IndexedCount, stats.TotalSupply)
+		}
+	}
+}
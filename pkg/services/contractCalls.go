@@ -0,0 +1,300 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc721ViewABI = `[
+	{
+		"inputs": [],
+		"name": "totalSupply",
+		"outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [{"internalType": "uint256", "name": "tokenId", "type": "uint256"}],
+		"name": "ownerOf",
+		"outputs": [{"internalType": "address", "name": "", "type": "address"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "name",
+		"outputs": [{"internalType": "string", "name": "", "type": "string"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "symbol",
+		"outputs": [{"internalType": "string", "name": "", "type": "string"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [{"internalType": "uint256", "name": "tokenId", "type": "uint256"}],
+		"name": "tokenURI",
+		"outputs": [{"internalType": "string", "name": "", "type": "string"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+var erc721ABI = mustParseABI(erc721ViewABI)
+
+// ErrCallReverted is returned when a contract call reverts or returns no data,
+// which usually means the contract doesn't implement the method or the token
+// doesn't exist.
+var ErrCallReverted = errors.New("contract call reverted")
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse contract ABI: %v", err))
+	}
+	return parsed
+}
+
+func (t *TransferEventTracker) callContract(ctx context.Context, contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	return t.callWithABI(ctx, erc721ABI, contract, method, args...)
+}
+
+func (t *TransferEventTracker) callWithABI(ctx context.Context, contractABI abi.ABI, contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	return t.callAtBlock(ctx, contractABI, contract, nil, method, args...)
+}
+
+// callAtBlock calls method against the state at block, or the latest block
+// when block is nil.
+func (t *TransferEventTracker) callAtBlock(ctx context.Context, contractABI abi.ABI, contract common.Address, block *big.Int, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s call: %v", method, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.rpcTimeout)
+	defer cancel()
+
+	output, err := t.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, block)
+	if err != nil {
+		if isRevert(err) {
+			return nil, fmt.Errorf("%s on %s: %w", method, contract.Hex(), ErrCallReverted)
+		}
+		return nil, fmt.Errorf("failed to call %s on %s: %v", method, contract.Hex(), err)
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("%s on %s: %w", method, contract.Hex(), ErrCallReverted)
+	}
+
+	values, err := contractABI.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s result: %v", method, err)
+	}
+	return values, nil
+}
+
+func (t *TransferEventTracker) TotalSupply(ctx context.Context, contract common.Address) (*big.Int, error) {
+	values, err := t.callContract(ctx, contract, "totalSupply")
+	if err != nil {
+		return nil, err
+	}
+	supply, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected totalSupply result type %T", values[0])
+	}
+	return supply, nil
+}
+
+func (t *TransferEventTracker) OwnerOf(ctx context.Context, contract common.Address, tokenId *big.Int) (common.Address, error) {
+	if cached, ok := t.owners.get(contract, tokenId); ok {
+		return cached.(common.Address), nil
+	}
+	return t.liveOwnerOf(ctx, contract, tokenId)
+}
+
+// liveOwnerOf always asks the chain, for callers promising a live answer,
+// and leaves the result in the owner cache for everyone else.
+func (t *TransferEventTracker) liveOwnerOf(ctx context.Context, contract common.Address, tokenId *big.Int) (common.Address, error) {
+	owner, err := t.ownerOfAt(ctx, contract, tokenId, nil)
+	if errors.Is(err, ErrCallReverted) {
+		t.owners.invalidate(contract, tokenId)
+	}
+	if err != nil {
+		return common.Address{}, err
+	}
+	t.owners.set(contract, tokenId, owner)
+	return owner, nil
+}
+
+// ownerOfAt reads ownerOf as of block, or the latest block when block is
+// nil, without going through the owner cache.
+func (t *TransferEventTracker) ownerOfAt(ctx context.Context, contract common.Address, tokenId *big.Int, block *big.Int) (common.Address, error) {
+	values, err := t.callAtBlock(ctx, erc721ABI, contract, block, "ownerOf", tokenId)
+	if err != nil {
+		return common.Address{}, err
+	}
+	owner, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("unexpected ownerOf result type %T", values[0])
+	}
+	return owner, nil
+}
+
+func (t *TransferEventTracker) TokenURI(ctx context.Context, contract common.Address, tokenId *big.Int) (string, error) {
+	if cached, ok := t.tokenURIs.get(contract, tokenId); ok {
+		return cached.(string), nil
+	}
+
+	values, err := t.callContract(ctx, contract, "tokenURI", tokenId)
+	if err != nil {
+		return "", err
+	}
+	uri, ok := values[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected tokenURI result type %T", values[0])
+	}
+	t.tokenURIs.set(contract, tokenId, uri)
+	return uri, nil
+}
+
+func (t *TransferEventTracker) callString(ctx context.Context, contract common.Address, method string) (string, error) {
+	values, err := t.callContract(ctx, contract, method)
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected %s result type %T", method, values[0])
+	}
+	return value, nil
+}
+
+// syncContractInfo stores the name and symbol of every tracked contract.
+// Both are optional in ERC-721, so reverts just leave them empty.
+func (t *TransferEventTracker) syncContractInfo(ctx context.Context) {
+	for _, addr := range t.contractAddrs {
+		name, err := t.callString(ctx, addr, "name")
+		if err != nil && !errors.Is(err, ErrCallReverted) {
+			log.Printf("Failed to fetch name for %s: %v", addr.Hex(), err)
+			continue
+		}
+		symbol, err := t.callString(ctx, addr, "symbol")
+		if err != nil && !errors.Is(err, ErrCallReverted) {
+			log.Printf("Failed to fetch symbol for %s: %v", addr.Hex(), err)
+			continue
+		}
+
+		err = nftModel.UpsertContractInfo(ctx, addr.Hex(), name, symbol)
+		if err != nil {
+			log.Printf("Failed to store contract info for %s: %v", addr.Hex(), err)
+		}
+	}
+}
+
+// RefreshOwner reads the current owner from chain, past the owner cache,
+// and corrects the indexed record when it has drifted. A revert is reported
+// according to OWNER_OF_REVERT, as ErrCallReverted or ErrTokenBurned.
+func (t *TransferEventTracker) RefreshOwner(ctx context.Context, contract common.Address, tokenId *big.Int) (common.Address, error) {
+	owner, err := t.liveOwnerOf(ctx, contract, tokenId)
+	if errors.Is(err, ErrCallReverted) {
+		return common.Address{}, t.ownerOfReverted(ctx, contract, tokenId, err)
+	}
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	key, err := nftModel.KeyForTokenID(tokenId)
+	if err != nil {
+		return owner, nil
+	}
+
+	nft, err := nftModel.GetNftByToken(ctx, contract.Hex(), key)
+	if errors.Is(err, nftModel.ErrNotFound) {
+		return owner, nil
+	}
+	if err != nil {
+		log.Printf("Failed to load indexed NFT for owner refresh: %v", err)
+		return owner, nil
+	}
+	if nft.OwnerAddress != owner.Hex() {
+		log.Printf("Indexed owner of %s #%s is stale (%s), updating to %s", contract.Hex(), tokenId.String(), nft.OwnerAddress, owner.Hex())
+		err = nftModel.UpdateNftOwner(ctx, contract.Hex(), key, owner.Hex())
+		if err != nil {
+			log.Printf("Failed to update NFT owner: %v", err)
+		}
+	}
+
+	return owner, nil
+}
+
+// RecordMissingOwner fills in a token of a tracked contract that isn't in
+// the index, e.g. because indexing started after its mint and it hasn't
+// moved since, by reading its owner from chain. It is off unless
+// OWNER_OF_FALLBACK is set and returns nftModel.ErrNotFound then, or when
+// the contract says the token doesn't exist. A revert is read according to
+// OWNER_OF_REVERT, so with "error" it fails the lookup instead.
+//
+// The owner is read as of the current head block and the record stamped
+// with it, so any transfer the tracker indexes after it takes over while
+// older ones found by a backfill don't.
+func (t *TransferEventTracker) RecordMissingOwner(ctx context.Context, contract common.Address, tokenId *big.Int) (*nftModel.NFT, error) {
+	if !t.ownerOfFallback || !t.isTracked(contract) {
+		return nil, nftModel.ErrNotFound
+	}
+
+	key, err := nftModel.KeyForTokenID(tokenId)
+	if opts := t.contractOpts[contract]; err != nil || key.RawTokenID != "" && (opts == nil || !opts.RawTokenIDs) {
+		return nil, nftModel.ErrNotFound
+	}
+
+	head, err := t.headBlock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch head block: %v", err)
+	}
+	owner, err := t.ownerOfAt(ctx, contract, tokenId, big.NewInt(head))
+	if errors.Is(err, ErrCallReverted) {
+		err = t.ownerOfReverted(ctx, contract, tokenId, err)
+	}
+	if errors.Is(err, ErrCallReverted) {
+		return nil, nftModel.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	nft := nftModel.NFT{
+		NftID:           key.NftID,
+		RawTokenID:      key.RawTokenID,
+		OwnerAddress:    owner.Hex(),
+		ContractAddress: contract.Hex(),
+		TimeStamp:       now,
+		BlockNumber:     uint64(head),
+		Confirmed:       t.isConfirmed(uint64(head)),
+		ChainID:         t.chainID,
+		FirstSeenAt:     now,
+		WrappedOf:       t.wrapped.sourceOf(t.chainID, contract, tokenId),
+	}
+	err = nft.CreateUpdateNFT(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store NFT: %v", err)
+	}
+
+	log.Printf("Recorded %s #%s from chain, owned by %s", contract.Hex(), tokenId.String(), owner.Hex())
+	if t.metadata != nil && key.RawTokenID == "" {
+		t.metadata.Enqueue(contract, tokenId)
+	}
+	return &nft, nil
+}
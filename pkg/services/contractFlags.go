@@ -0,0 +1,72 @@
+package trackingService
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// syncContractFlags stores the VERIFIED_CONTRACTS and SPAM_CONTRACTS lists
+// on the contracts collection. Every tracked contract is written, so a
+// contract taken off a list loses its flag on the next start.
+func (t *TransferEventTracker) syncContractFlags() error {
+	verified, err := parseAddressList("VERIFIED_CONTRACTS")
+	if err != nil {
+		return err
+	}
+	spam, err := parseAddressList("SPAM_CONTRACTS")
+	if err != nil {
+		return err
+	}
+
+	addrs := make(map[common.Address]bool, len(t.contractAddrs))
+	for _, addr := range t.contractAddrs {
+		addrs[addr] = true
+	}
+	for addr := range verified {
+		addrs[addr] = true
+	}
+	for addr := range spam {
+		addrs[addr] = true
+	}
+
+	for addr := range addrs {
+		if verified[addr] && spam[addr] {
+			log.Printf("Contract %s is listed as both verified and spam, treating it as spam", addr.Hex())
+		}
+		err := nftModel.SetContractFlags(context.Background(), addr.Hex(), verified[addr] && !spam[addr], spam[addr])
+		if err != nil {
+			return fmt.Errorf("failed to store flags for %s: %v", addr.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func parseAddressList(name string) (map[common.Address]bool, error) {
+	addrs := make(map[common.Address]bool)
+	raw := os.Getenv(name)
+	if strings.TrimSpace(raw) == "" {
+		return addrs, nil
+	}
+
+	var addrStrings []string
+	err := json.Unmarshal([]byte(raw), &addrStrings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s environment variable: %v", name, err)
+	}
+
+	for _, addr := range addrStrings {
+		parsed, err := parseConfigAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in %s: %v", name, err)
+		}
+		addrs[parsed] = true
+	}
+	return addrs, nil
+}
@@ -0,0 +1,127 @@
+package trackingService
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// contractOptions holds per-contract tuning read from CONTRACT_OPTIONS, a JSON
+// object keyed by contract address.
+type contractOptions struct {
+	// TokenID restricts tracking to a single token by filtering on the
+	// indexed tokenId topic.
+	TokenID string `json:"tokenId,omitempty"`
+	// Decoder selects a built-in decoder for contracts that don't emit the
+	// standard Transfer event, e.g. "punks".
+	Decoder string `json:"decoder,omitempty"`
+	// FromBlock is where scanning starts for this contract, typically its
+	// deployment block. It overrides FROM_BLOCK and SKIP_HISTORICAL but not
+	// saved progress.
+	FromBlock *int64 `json:"fromBlock,omitempty"`
+	// Events replaces the standard Transfer event with one or more
+	// Solidity-style declarations, for collections whose event deviates
+	// from the canonical one, e.g. a non-indexed tokenId:
+	// "Transfer(address indexed from, address indexed to, uint256 tokenId)".
+	Events []string `json:"events,omitempty"`
+	// RawTokenIDs keeps tokens whose ID is too large to be a plain integer,
+	// typically a hash or bytes32 identifier, storing the raw topic hex
+	// instead of dropping the log.
+	RawTokenIDs bool `json:"rawTokenIds,omitempty"`
+	// ABI names a built-in ABI such as "erc721" or the path of an ABI JSON
+	// file. The events listed in ABIEvents, or every event in it with to
+	// and tokenId inputs, replace the standard Transfer event.
+	ABI       string   `json:"abi,omitempty"`
+	ABIEvents []string `json:"abiEvents,omitempty"`
+
+	events    []*eventSpec
+	abiEvents []abiEventSpec
+
+	tokenID *big.Int
+}
+
+func parseContractOptions(raw string, contractAddrs []common.Address) (map[common.Address]*contractOptions, error) {
+	opts := make(map[common.Address]*contractOptions)
+	if strings.TrimSpace(raw) == "" {
+		return opts, nil
+	}
+
+	var byAddress map[string]*contractOptions
+	err := json.Unmarshal([]byte(raw), &byAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CONTRACT_OPTIONS environment variable: %v", err)
+	}
+
+	tracked := make(map[common.Address]bool, len(contractAddrs))
+	for _, addr := range contractAddrs {
+		tracked[addr] = true
+	}
+
+	for addrStr, opt := range byAddress {
+		addr, err := parseConfigAddress(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in CONTRACT_OPTIONS: %v", err)
+		}
+		if !tracked[addr] {
+			log.Printf("Ignoring CONTRACT_OPTIONS for untracked contract %s", addrStr)
+			continue
+		}
+		if opt == nil {
+			continue
+		}
+
+		if opt.TokenID != "" {
+			tokenID, ok := new(big.Int).SetString(opt.TokenID, 10)
+			if !ok || tokenID.Sign() < 0 {
+				return nil, fmt.Errorf("invalid tokenId %q in CONTRACT_OPTIONS for %s", opt.TokenID, addrStr)
+			}
+			opt.tokenID = tokenID
+			log.Printf("Tracking only token %s on %s", tokenID.String(), addr.Hex())
+		}
+
+		if opt.FromBlock != nil && *opt.FromBlock < 0 {
+			return nil, fmt.Errorf("invalid fromBlock %d in CONTRACT_OPTIONS for %s", *opt.FromBlock, addrStr)
+		}
+
+		if opt.Decoder != "" && len(opt.Events) > 0 {
+			return nil, fmt.Errorf("CONTRACT_OPTIONS for %s can't set both decoder and events", addrStr)
+		}
+		if opt.ABI != "" && (opt.Decoder != "" || len(opt.Events) > 0) {
+			return nil, fmt.Errorf("CONTRACT_OPTIONS for %s can't set abi together with decoder or events", addrStr)
+		}
+		if opt.ABI == "" && len(opt.ABIEvents) > 0 {
+			return nil, fmt.Errorf("CONTRACT_OPTIONS for %s sets abiEvents without abi", addrStr)
+		}
+		if opt.ABI != "" {
+			opt.abiEvents, err = parseABIEvents(opt.ABI, opt.ABIEvents)
+			if err != nil {
+				return nil, fmt.Errorf("invalid abi in CONTRACT_OPTIONS for %s: %v", addrStr, err)
+			}
+		}
+		for _, signature := range opt.Events {
+			spec, err := parseEventSignature(signature)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event in CONTRACT_OPTIONS for %s: %v", addrStr, err)
+			}
+			opt.events = append(opt.events, spec)
+		}
+
+		if opt.Decoder != "" {
+			if _, ok := builtinDecoders[opt.Decoder]; !ok {
+				return nil, fmt.Errorf("unknown decoder %q in CONTRACT_OPTIONS for %s", opt.Decoder, addrStr)
+			}
+		}
+
+		opts[addr] = opt
+	}
+
+	return opts, nil
+}
+
+var builtinDecoders = map[string]func(t *TransferEventTracker, contract common.Address){
+	"punks": registerPunksDecoders,
+}
@@ -0,0 +1,241 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// scanContracts runs the first pass of the historical scan with one
+// goroutine per contract, at most HISTORICAL_CONCURRENCY at a time. Each
+// contract is scanned from its own checkpoint to the head read here, which
+// is much faster than the shared chunks of scanToBlock when contracts were
+// deployed far apart. catchUp then takes every contract the rest of the way
+// together, as they all start from the same block again.
+//
+// Workers share the batcher, whose flushes are serialised, and only write
+// their own contract's progress record. They leave out the marketplace
+// logs, which sweepSales fetches once for the whole range when they are
+// done and every contract's transfers are written.
+func (t *TransferEventTracker) scanContracts(ctx context.Context) error {
+	if t.scanConcurrency <= 1 || len(t.contractAddrs) < 2 {
+		return nil
+	}
+
+	head, err := t.headBlock(ctx)
+	if err != nil {
+		log.Printf("Failed to get latest block header: %v\n", err)
+		return err
+	}
+	t.scan.begin(t.fromBlock.Load(), head, t.lowestNextBlock())
+
+	var behind []common.Address
+	for _, addr := range t.contractAddrs {
+		if t.nextBlock(addr) <= head {
+			behind = append(behind, addr)
+		}
+	}
+	if len(behind) < 2 {
+		return t.sweepSales(ctx)
+	}
+	err = t.startSalesSweep(ctx, behind)
+	if err != nil {
+		return err
+	}
+	log.Printf("Scanning %d contracts to block %d, %d at a time", len(behind), head, t.scanConcurrency)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	slots := make(chan struct{}, t.scanConcurrency)
+	for _, addr := range behind {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(addr common.Address) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := t.scanContract(ctx, addr, head)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return t.sweepSales(ctx)
+}
+
+// scanContract scans a single contract up to head, checkpointing it after
+// every chunk.
+func (t *TransferEventTracker) scanContract(ctx context.Context, addr common.Address, head int64) error {
+	addrs := []common.Address{addr}
+	for {
+		start := t.nextBlock(addr)
+		if start > head {
+			log.Printf("Contract %s caught up to block %d", addr.Hex(), head)
+			return nil
+		}
+		end := start + t.chunkSize - 1
+		if end > head {
+			end = head
+		}
+
+		err := t.processRange(ctx, start, end, addrs, nil, false)
+		var interrupted *interruptedError
+		if errors.As(err, &interrupted) {
+			return t.drain(addrs, interrupted.through+1, err)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", addr.Hex(), err)
+		}
+
+		err = t.batcher.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush NFT batch: %v", err)
+		}
+		err = nftModel.SaveScanProgress(ctx, addr.Hex(), end+1)
+		if err != nil {
+			return fmt.Errorf("failed to save scan progress for %s: %v", addr.Hex(), err)
+		}
+		t.setNextBlock(addr, end+1)
+		t.scan.advance(t.lowestNextBlock())
+	}
+}
+
+// salesProgressKey is the progress record of the marketplace sweep that
+// follows the per-contract scans. salesSwept marks it as done.
+const (
+	salesProgressKey = "marketplaces"
+	salesSwept       = math.MaxInt64
+)
+
+// startSalesSweep records where the marketplace logs of the per-contract
+// scans start, before the workers move any contract past it. A sweep left
+// unfinished by an earlier run is taken over.
+func (t *TransferEventTracker) startSalesSweep(ctx context.Context, behind []common.Address) error {
+	if len(t.marketplaces) == 0 {
+		return nil
+	}
+
+	from := int64(math.MaxInt64)
+	for _, addr := range behind {
+		if next := t.nextBlock(addr); next < from {
+			from = next
+		}
+	}
+	progress, err := nftModel.GetScanProgress(ctx, salesProgressKey)
+	if err != nil {
+		return fmt.Errorf("failed to load marketplace sweep progress: %v", err)
+	}
+	if progress != nil && progress.NextBlock < from {
+		from = progress.NextBlock
+	}
+	err = nftModel.SaveScanProgress(ctx, salesProgressKey, from)
+	if err != nil {
+		return fmt.Errorf("failed to save marketplace sweep progress: %v", err)
+	}
+	return nil
+}
+
+// sweepSales applies the marketplace logs the per-contract scans left out,
+// up to where catchUp starts, checkpointing after every chunk so an
+// interrupted sweep resumes on the next historical scan.
+func (t *TransferEventTracker) sweepSales(ctx context.Context) error {
+	if len(t.marketplaces) == 0 {
+		return nil
+	}
+
+	progress, err := nftModel.GetScanProgress(ctx, salesProgressKey)
+	if err != nil {
+		return fmt.Errorf("failed to load marketplace sweep progress: %v", err)
+	}
+	through := t.lowestNextBlock() - 1
+	if progress == nil || progress.NextBlock > through {
+		return nil
+	}
+	log.Printf("Applying marketplace sales for blocks %d-%d", progress.NextBlock, through)
+
+	for start := progress.NextBlock; start <= through; start += t.chunkSize {
+		end := start + t.chunkSize - 1
+		if end > through {
+			end = through
+		}
+
+		err := t.processRange(ctx, start, end, nil, nil, true)
+		var interrupted *interruptedError
+		if errors.As(err, &interrupted) {
+			if saveErr := nftModel.SaveScanProgress(context.Background(), salesProgressKey, interrupted.through+1); saveErr != nil {
+				log.Printf("Failed to save marketplace sweep progress: %v", saveErr)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		err = nftModel.SaveScanProgress(ctx, salesProgressKey, end+1)
+		if err != nil {
+			return fmt.Errorf("failed to save marketplace sweep progress: %v", err)
+		}
+	}
+	err = nftModel.SaveScanProgress(ctx, salesProgressKey, salesSwept)
+	if err != nil {
+		return fmt.Errorf("failed to save marketplace sweep progress: %v", err)
+	}
+	return nil
+}
+
+// nextBlock returns the next block to scan for addr. nextBlocks is read and
+// written from the scan workers, the live loop and the admin endpoints, so
+// every access goes through nextBlocksMu.
+func (t *TransferEventTracker) nextBlock(addr common.Address) int64 {
+	t.nextBlocksMu.Lock()
+	defer t.nextBlocksMu.Unlock()
+
+	return t.nextBlocks[addr]
+}
+
+func (t *TransferEventTracker) setNextBlock(addr common.Address, next int64) {
+	t.nextBlocksMu.Lock()
+	defer t.nextBlocksMu.Unlock()
+
+	t.nextBlocks[addr] = next
+}
+
+// nextBlocksSnapshot copies nextBlocks, for code that reads it throughout
+// a chunk.
+func (t *TransferEventTracker) nextBlocksSnapshot() map[common.Address]int64 {
+	t.nextBlocksMu.Lock()
+	defer t.nextBlocksMu.Unlock()
+
+	snapshot := make(map[common.Address]int64, len(t.nextBlocks))
+	for addr, next := range t.nextBlocks {
+		snapshot[addr] = next
+	}
+	return snapshot
+}
@@ -0,0 +1,130 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrReplayFailed is returned when a replayed dead letter fails again. Its
+// entry is kept, with the new error.
+var ErrReplayFailed = errors.New("replay failed")
+
+// deadLetter records a log processTransferLog rejected, so it can be
+// replayed from /admin/deadletters instead of rescanning the chain.
+func (t *TransferEventTracker) deadLetter(delog types.Log, cause error) {
+	log.Printf("Failed to process Transfer event log: %v\n", cause)
+
+	err := nftModel.SaveDeadLetter(context.Background(), toRawLog(delog), cause.Error())
+	if err != nil {
+		log.Printf("Failed to save dead letter for %s:%d: %v", delog.TxHash.Hex(), delog.Index, err)
+	}
+}
+
+// deadLetterUpserts records the NFT writes the batcher gave up on. The
+// decoded log isn't kept that far, so the entry names the log by its
+// position and replaying it fetches the log from the chain again.
+func (t *TransferEventTracker) deadLetterUpserts(failed []nftModel.FailedUpsert) {
+	for _, f := range failed {
+		rawLog := nftModel.RawLog{
+			Address:     f.NFT.ContractAddress,
+			BlockNumber: f.NFT.BlockNumber,
+			TxHash:      f.NFT.TxHash,
+			LogIndex:    f.NFT.LogIndex,
+		}
+		err := nftModel.SaveDeadLetter(context.Background(), rawLog, fmt.Sprintf("failed to write NFT: %v", f.Err))
+		if err != nil {
+			log.Printf("Failed to save dead letter for %s:%d: %v", f.NFT.TxHash, f.NFT.LogIndex, err)
+		}
+	}
+}
+
+// ReplayDeadLetter processes a dead letter's log again and removes the
+// entry once it goes through.
+func (t *TransferEventTracker) ReplayDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	letter, err := nftModel.GetDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var delog types.Log
+	if len(letter.Log.Topics) == 0 {
+		delog, err = t.refetchLog(ctx, letter.Log)
+	} else {
+		delog, err = fromRawLog(letter.Log)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrReplayFailed, err)
+	}
+
+	err = t.processTransferLog(ctx, delog, t.blockTime(ctx, delog.BlockNumber, make(map[uint64]time.Time)))
+	if err != nil {
+		t.deadLetter(delog, err)
+		return fmt.Errorf("%w: %v", ErrReplayFailed, err)
+	}
+
+	// Only drop the entry once the result is written.
+	err = t.batcher.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush NFT batch: %v", err)
+	}
+
+	log.Printf("Replayed dead letter for %s:%d", letter.Log.TxHash, letter.Log.LogIndex)
+	return nftModel.DeleteDeadLetter(ctx, id)
+}
+
+// refetchLog looks up the log a dead letter only names by block, contract,
+// transaction and index.
+func (t *TransferEventTracker) refetchLog(ctx context.Context, raw nftModel.RawLog) (types.Log, error) {
+	block := new(big.Int).SetUint64(raw.BlockNumber)
+	logs, err := t.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: block,
+		ToBlock:   block,
+		Addresses: []common.Address{common.HexToAddress(raw.Address)},
+	})
+	if err != nil {
+		return types.Log{}, fmt.Errorf("failed to fetch logs for block %d: %v", raw.BlockNumber, err)
+	}
+
+	txHash := common.HexToHash(raw.TxHash)
+	for _, delog := range logs {
+		if delog.TxHash == txHash && delog.Index == raw.LogIndex {
+			return delog, nil
+		}
+	}
+	return types.Log{}, fmt.Errorf("log %s:%d not found in block %d", raw.TxHash, raw.LogIndex, raw.BlockNumber)
+}
+
+func fromRawLog(raw nftModel.RawLog) (types.Log, error) {
+	data, err := hexutil.Decode(raw.Data)
+	if err != nil {
+		return types.Log{}, fmt.Errorf("invalid log data: %v", err)
+	}
+
+	topics := make([]common.Hash, 0, len(raw.Topics))
+	for _, topic := range raw.Topics {
+		topics = append(topics, common.HexToHash(topic))
+	}
+
+	return types.Log{
+		Address:     common.HexToAddress(raw.Address),
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: raw.BlockNumber,
+		BlockHash:   common.HexToHash(raw.BlockHash),
+		TxHash:      common.HexToHash(raw.TxHash),
+		TxIndex:     raw.TxIndex,
+		Index:       raw.LogIndex,
+		Removed:     raw.Removed,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package trackingService
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TransferEvent is the ownership change a decoder extracts from a log.
+type TransferEvent struct {
+	From    common.Address
+	To      common.Address
+	TokenID *big.Int
+}
+
+// TransferDecoder turns a raw log into a TransferEvent. Decoders are
+// registered against the topic hash (Topics[0]) of the event they handle.
+type TransferDecoder func(delog types.Log) (*TransferEvent, error)
+
+// decoderRegistry resolves the decoder for a log. Contracts with their own
+// registered decoders use only those; everything else falls back to the
+// standard ERC-721 Transfer decoder.
+type decoderRegistry struct {
+	defaults   map[common.Hash]TransferDecoder
+	byContract map[common.Address]map[common.Hash]TransferDecoder
+}
+
+func newDecoderRegistry() *decoderRegistry {
+	return &decoderRegistry{
+		defaults:   map[common.Hash]TransferDecoder{transferEventHash: decodeTransferLog},
+		byContract: make(map[common.Address]map[common.Hash]TransferDecoder),
+	}
+}
+
+func (r *decoderRegistry) register(contract common.Address, topic common.Hash, decoder TransferDecoder) {
+	if r.byContract[contract] == nil {
+		r.byContract[contract] = make(map[common.Hash]TransferDecoder)
+	}
+	r.byContract[contract][topic] = decoder
+}
+
+func (r *decoderRegistry) decoders(contract common.Address) map[common.Hash]TransferDecoder {
+	if custom, ok := r.byContract[contract]; ok {
+		return custom
+	}
+	return r.defaults
+}
+
+func (r *decoderRegistry) hasCustom(contract common.Address) bool {
+	_, ok := r.byContract[contract]
+	return ok
+}
+
+func (r *decoderRegistry) topics(contract common.Address) []common.Hash {
+	decoders := r.decoders(contract)
+	topics := make([]common.Hash, 0, len(decoders))
+	for topic := range decoders {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// handles reports whether the log's event is one its contract is tracked
+// by. Queries OR every configured topic together, so a contract's logs can
+// include events only some other contract was configured for.
+func (r *decoderRegistry) handles(delog types.Log) bool {
+	if len(delog.Topics) == 0 {
+		return false
+	}
+	_, ok := r.decoders(delog.Address)[delog.Topics[0]]
+	return ok
+}
+
+func (r *decoderRegistry) decode(delog types.Log) (*TransferEvent, error) {
+	if len(delog.Topics) == 0 {
+		return nil, fmt.Errorf("log %s:%d has no topics", delog.TxHash.Hex(), delog.Index)
+	}
+	decoder, ok := r.decoders(delog.Address)[delog.Topics[0]]
+	if !ok {
+		return nil, fmt.Errorf("no decoder registered for topic %s on %s", delog.Topics[0].Hex(), delog.Address.Hex())
+	}
+	return decoder(delog)
+}
+
+// RegisterDecoder makes the tracker decode logs with the given topic on a
+// contract using decoder. Once a contract has a custom decoder, the standard
+// Transfer decoder no longer applies to it, so register every event the
+// contract should be tracked by.
+func (t *TransferEventTracker) RegisterDecoder(contract common.Address, topic common.Hash, decoder TransferDecoder) {
+	t.decoders.register(contract, topic, decoder)
+}
+
+func decodeTransferLog(delog types.Log) (*TransferEvent, error) {
+	if len(delog.Topics) != 4 {
+		return nil, fmt.Errorf("expected 4 topics for an ERC-721 Transfer, got %d", len(delog.Topics))
+	}
+
+	return &TransferEvent{
+		From:    common.BytesToAddress(delog.Topics[1].Bytes()),
+		To:      common.BytesToAddress(delog.Topics[2].Bytes()),
+		TokenID: delog.Topics[3].Big(),
+	}, nil
+}
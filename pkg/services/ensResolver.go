@@ -0,0 +1,150 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ensRegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+const ensViewABI = `[
+	{
+		"inputs": [{"internalType": "bytes32", "name": "node", "type": "bytes32"}],
+		"name": "resolver",
+		"outputs": [{"internalType": "address", "name": "", "type": "address"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [{"internalType": "bytes32", "name": "node", "type": "bytes32"}],
+		"name": "addr",
+		"outputs": [{"internalType": "address", "name": "", "type": "address"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+var ensABI = mustParseABI(ensViewABI)
+
+var ErrENSNotFound = errors.New("ENS name does not resolve")
+
+// ErrInvalidENSName is returned for names that can't be registered, before
+// any RPC call is made for them.
+var ErrInvalidENSName = errors.New("invalid ENS name")
+
+// maxENSNameLength bounds the names worth resolving; DNS caps names at 253
+// characters and ENS names are no longer in practice.
+const maxENSNameLength = 255
+
+// ensCache remembers resolutions, including misses, for ENS_CACHE_TTL so
+// wallet queries by name don't cost an RPC round trip each. It holds at most
+// ENS_CACHE_SIZE names, least recently used first out, since misses for
+// made-up names would otherwise pile up.
+type ensCache struct {
+	cache *tokenCache
+}
+
+func newENSCache(size int, ttl time.Duration) *ensCache {
+	return &ensCache{cache: newTokenCache(size, ttl)}
+}
+
+func (c *ensCache) get(name string) (common.Address, bool) {
+	value, ok := c.cache.lookup(name)
+	if !ok {
+		return common.Address{}, false
+	}
+	return value.(common.Address), true
+}
+
+func (c *ensCache) set(name string, address common.Address) {
+	c.cache.store(name, address)
+}
+
+// validENSName reports whether name, already lowercased, is a .eth name
+// made of non-empty labels without spaces, control characters or ASCII
+// punctuation other than '-' and '_'.
+func validENSName(name string) bool {
+	if len(name) > maxENSNameLength || !strings.HasSuffix(name, ".eth") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			case r > unicode.MaxASCII && unicode.IsPrint(r) && !unicode.IsSpace(r):
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ResolveENS looks up the address an ENS name points to through the
+// registry and the name's resolver.
+func (t *TransferEventTracker) ResolveENS(ctx context.Context, name string) (common.Address, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !validENSName(name) {
+		return common.Address{}, ErrInvalidENSName
+	}
+
+	if address, ok := t.ens.get(name); ok {
+		if address == (common.Address{}) {
+			return address, ErrENSNotFound
+		}
+		return address, nil
+	}
+
+	node := ensNamehash(name)
+
+	values, err := t.callWithABI(ctx, ensABI, ensRegistryAddress, "resolver", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to look up resolver for %s: %v", name, err)
+	}
+	resolver, _ := values[0].(common.Address)
+	if resolver == (common.Address{}) {
+		t.ens.set(name, common.Address{})
+		return common.Address{}, ErrENSNotFound
+	}
+
+	values, err = t.callWithABI(ctx, ensABI, resolver, "addr", node)
+	if errors.Is(err, ErrCallReverted) {
+		t.ens.set(name, common.Address{})
+		return common.Address{}, ErrENSNotFound
+	}
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %v", name, err)
+	}
+	address, _ := values[0].(common.Address)
+
+	t.ens.set(name, address)
+	if address == (common.Address{}) {
+		return address, ErrENSNotFound
+	}
+	return address, nil
+}
+
+// ensNamehash implements the EIP-137 namehash algorithm.
+func ensNamehash(name string) [32]byte {
+	var node [32]byte
+	if name == "" {
+		return node
+	}
+
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		labelHash := crypto.Keccak256([]byte(labels[i]))
+		copy(node[:], crypto.Keccak256(node[:], labelHash))
+	}
+	return node
+}
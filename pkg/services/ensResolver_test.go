@@ -0,0 +1,56 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestResolveENSRejectsInvalidNamesWithoutRPC(t *testing.T) {
+	client := newFakeEthClient(20)
+	tracker, _ := newTestTracker(t, client, nil)
+
+	for _, name := range []string{
+		".eth",
+		"vitalik..eth",
+		"vitalik.xyz",
+		"has space.eth",
+		"semi;colon.eth",
+		"nul\x00.eth",
+		strings.Repeat("a", maxENSNameLength) + ".eth",
+	} {
+		if _, err := tracker.ResolveENS(context.Background(), name); !errors.Is(err, ErrInvalidENSName) {
+			t.Errorf("ResolveENS(%q): err = %v, want ErrInvalidENSName", name, err)
+		}
+	}
+	if client.calls != 0 {
+		t.Errorf("made %d contract calls for invalid names, want none", client.calls)
+	}
+
+	for _, name := range []string{"Vitalik.eth", "sub.name-1.eth", "café.eth"} {
+		if _, err := tracker.ResolveENS(context.Background(), name); errors.Is(err, ErrInvalidENSName) {
+			t.Errorf("ResolveENS(%q) rejected a valid name", name)
+		}
+	}
+	if client.calls == 0 {
+		t.Errorf("valid names were never looked up")
+	}
+}
+
+func TestENSCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newENSCache(2, time.Minute)
+	for i := 0; i < 3; i++ {
+		cache.set("name"+strconv.Itoa(i)+".eth", common.BigToAddress(common.Big1))
+	}
+	if _, ok := cache.get("name0.eth"); ok {
+		t.Errorf("the oldest name is still cached past the size limit")
+	}
+	if _, ok := cache.get("name2.eth"); !ok {
+		t.Errorf("the newest name was evicted")
+	}
+}
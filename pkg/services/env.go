@@ -0,0 +1,52 @@
+package trackingService
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Failed to parse %s: %v, defaulting to %s\n", name, err, def)
+		return def
+	}
+	return duration
+}
+
+func envInt64(name string, def int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid %s %q, defaulting to %d\n", name, value, def)
+		return def
+	}
+	return parsed
+}
+
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Failed to parse %s: %v, defaulting to %v\n", name, err, def)
+		return def
+	}
+	return parsed
+}
+
+func envBool(name string) bool {
+	parsed, _ := strconv.ParseBool(os.Getenv(name))
+	return parsed
+}
@@ -0,0 +1,105 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EthClient is the subset of the Ethereum JSON-RPC client the tracker uses.
+// Keeping it narrow lets a canned-log fake stand in for a node.
+type EthClient interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
+	SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+var _ EthClient = (*ethclient.Client)(nil)
+
+// DialEthClient connects to the node at ETH_RPC_ENDPOINT. HTTP endpoints
+// share a tuned, HTTP/2-capable transport; websocket and IPC endpoints
+// don't use it.
+func DialEthClient() (EthClient, error) {
+	rpcEndpoint := os.Getenv("ETH_RPC_ENDPOINT")
+	if rpcEndpoint == "" {
+		return nil, errors.New("ETH_RPC_ENDPOINT environment variable is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("RPC_CALL_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	rpcClient, err := rpc.DialOptions(ctx, rpcEndpoint, rpc.WithHTTPClient(&http.Client{Transport: rpcTransport()}))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Ethereum client: %v", err)
+	}
+	return ethclient.NewClient(rpcClient), nil
+}
+
+// resolveChainID returns CHAIN_ID when set and otherwise asks the node.
+// Clients that can't report their chain, such as test doubles, need
+// CHAIN_ID.
+func resolveChainID(client EthClient) (int64, error) {
+	if value := os.Getenv("CHAIN_ID"); value != "" {
+		chainID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || chainID <= 0 {
+			return 0, fmt.Errorf("invalid CHAIN_ID %q", value)
+		}
+		return chainID, nil
+	}
+
+	reader, ok := client.(interface {
+		ChainID(ctx context.Context) (*big.Int, error)
+	})
+	if !ok {
+		return 0, errors.New("CHAIN_ID must be set when the client can't report its chain")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("RPC_CALL_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	chainID, err := reader.ChainID(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read chain ID: %v", err)
+	}
+	if !chainID.IsInt64() {
+		return 0, fmt.Errorf("chain ID %s is out of range", chainID.String())
+	}
+	return chainID.Int64(), nil
+}
+
+// rpcTransport keeps enough idle connections per host for concurrent RPC
+// calls to reuse them instead of reconnecting, and negotiates HTTP/2 with
+// providers that offer it.
+func rpcTransport() *http.Transport {
+	maxIdlePerHost := int(envInt64("RPC_MAX_IDLE_CONNS_PER_HOST", 32))
+	if maxIdlePerHost == 0 {
+		maxIdlePerHost = 32
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: envDuration("RPC_KEEPALIVE", 30*time.Second),
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        maxIdlePerHost * 2,
+		MaxIdleConnsPerHost: maxIdlePerHost,
+		MaxConnsPerHost:     int(envInt64("RPC_MAX_CONNS_PER_HOST", 0)),
+		IdleConnTimeout:     envDuration("RPC_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   envBool("RPC_DISABLE_KEEPALIVES"),
+	}
+}
@@ -0,0 +1,225 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	testContract = common.HexToAddress("0x00000000000000000000000000000000000000C0")
+	alice        = common.HexToAddress("0x000000000000000000000000000000000000A11c")
+	bob          = common.HexToAddress("0x0000000000000000000000000000000000000B0b")
+	carol        = common.HexToAddress("0x00000000000000000000000000000000000CA401")
+)
+
+// fakeEthClient is a node serving a fixed set of logs. FilterLogs applies
+// the query's block range, addresses and topics the way a node does, and
+// every block's header has a timestamp derived from its number.
+type fakeEthClient struct {
+	mu      sync.Mutex
+	head    int64
+	logs    []types.Log
+	filters int
+	calls   int
+	// forks counts how many times each block has been replaced.
+	forks map[uint64]byte
+}
+
+var _ EthClient = (*fakeEthClient)(nil)
+
+func newFakeEthClient(head int64, logs ...types.Log) *fakeEthClient {
+	return &fakeEthClient{head: head, logs: logs}
+}
+
+// add makes more logs visible, as a node does once it has indexed them.
+func (c *fakeEthClient) add(logs ...types.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logs = append(c.logs, logs...)
+}
+
+// reorg replaces block number: its logs are dropped and logs, moved into
+// the new block, take their place.
+func (c *fakeEthClient) reorg(number uint64, logs ...types.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.forks == nil {
+		c.forks = make(map[uint64]byte)
+	}
+	c.forks[number]++
+	hash := fakeHeader(number, c.forks[number]).Hash()
+
+	kept := c.logs[:0]
+	for _, delog := range c.logs {
+		if delog.BlockNumber != number {
+			kept = append(kept, delog)
+		}
+	}
+	for _, delog := range logs {
+		delog.BlockHash = hash
+		kept = append(kept, delog)
+	}
+	c.logs = kept
+}
+
+func (c *fakeEthClient) setHead(head int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.head = head
+}
+
+func (c *fakeEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if number == nil {
+		number = big.NewInt(c.head)
+	}
+	return fakeHeader(number.Uint64(), c.forks[number.Uint64()]), nil
+}
+
+// fakeHeader is the header of block number after fork replacements.
+func fakeHeader(number uint64, fork byte) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(number), Time: blockTimeOf(number), Extra: []byte{fork}}
+}
+
+func (c *fakeEthClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.filters++
+	var matched []types.Log
+	for _, delog := range c.logs {
+		if matchesQuery(query, delog) {
+			matched = append(matched, delog)
+		}
+	}
+	return matched, nil
+}
+
+func (c *fakeEthClient) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("subscriptions are not supported")
+}
+
+func (c *fakeEthClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	return nil, errors.New("contract calls are not supported")
+}
+
+func matchesQuery(query ethereum.FilterQuery, delog types.Log) bool {
+	if query.FromBlock != nil && delog.BlockNumber < query.FromBlock.Uint64() {
+		return false
+	}
+	if query.ToBlock != nil && delog.BlockNumber > query.ToBlock.Uint64() {
+		return false
+	}
+	if len(query.Addresses) > 0 && !containsAddress(query.Addresses, delog.Address) {
+		return false
+	}
+	for i, wanted := range query.Topics {
+		if len(wanted) == 0 {
+			continue
+		}
+		if i >= len(delog.Topics) || !containsHash(wanted, delog.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func containsHash(hashes []common.Hash, hash common.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func blockTimeOf(number uint64) uint64 {
+	return 1700000000 + number*12
+}
+
+// transferLog is the ERC-721 Transfer log of tokenId from one address to
+// another, the index-th log of its block.
+func transferLog(block uint64, index uint, from, to common.Address, tokenId int64) types.Log {
+	return types.Log{
+		Address: testContract,
+		Topics: []common.Hash{
+			transferEventHash,
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+			common.BigToHash(big.NewInt(tokenId)),
+		},
+		BlockNumber: block,
+		BlockHash:   fakeHeader(block, 0).Hash(),
+		TxHash:      common.BigToHash(big.NewInt(int64(block)<<16 | int64(index))),
+		Index:       index,
+	}
+}
+
+// newTestTracker builds a tracker for testContract on top of client, with
+// a fresh MemoryStore behind the nftModel functions. env is set on top of
+// the defaults.
+func newTestTracker(t *testing.T, client EthClient, env map[string]string) (*TransferEventTracker, *nftModel.MemoryStore) {
+	t.Helper()
+
+	t.Setenv("CHAIN_ID", "1")
+	t.Setenv("CONTRACT_ADDRESSES", `["`+testContract.Hex()+`"]`)
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	store := nftModel.NewMemoryStore()
+	nftModel.UseStore(store)
+	t.Cleanup(func() { nftModel.UseStore(nftModel.MongoStore{}) })
+
+	tracker, err := NewTransferEventTracker(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := tracker.batcher.Close(); err != nil {
+			t.Errorf("failed to close batcher: %v", err)
+		}
+	})
+	return tracker, store
+}
+
+// ownerOf reads a token's stored owner.
+func ownerOf(t *testing.T, store *nftModel.MemoryStore, tokenId int64) string {
+	t.Helper()
+
+	key, err := nftModel.KeyForTokenID(big.NewInt(tokenId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nft, err := store.GetNftByToken(context.Background(), testContract.Hex(), key)
+	if err != nil {
+		t.Fatalf("GetNftByToken(%d): %v", tokenId, err)
+	}
+	return nft.OwnerAddress
+}
@@ -0,0 +1,123 @@
+package trackingService
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// eventParam is one parameter of a configured transfer event. role is
+// "from", "to" or "tokenId" for the parameters the tracker reads and empty
+// for any others.
+type eventParam struct {
+	typ     string
+	indexed bool
+	role    string
+}
+
+type eventSpec struct {
+	topic  common.Hash
+	params []eventParam
+}
+
+var staticEventType = regexp.MustCompile(`^(address|bool|u?int(8|16|24|32|40|48|56|64|72|80|88|96|104|112|120|128|136|144|152|160|168|176|184|192|200|208|216|224|232|240|248|256)?|bytes([1-9]|[12][0-9]|3[0-2]))$`)
+
+// parseEventSignature reads a Solidity-style event declaration such as
+// "Transfer(address indexed from, address indexed to, uint256 tokenId)".
+// Parameters named from, to and tokenId (or id) carry the transfer; the
+// topic hash is computed from the canonical type list.
+func parseEventSignature(signature string) (*eventSpec, error) {
+	signature = strings.TrimSpace(signature)
+	open, end := strings.Index(signature, "("), strings.LastIndex(signature, ")")
+	if open <= 0 || end != len(signature)-1 {
+		return nil, fmt.Errorf("malformed event signature %q", signature)
+	}
+	name := strings.TrimSpace(signature[:open])
+
+	var params []eventParam
+	var typeList []string
+	roles := make(map[string]bool)
+	for _, raw := range strings.Split(signature[open+1:end], ",") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty parameter in event signature %q", signature)
+		}
+
+		param := eventParam{typ: fields[0]}
+		if param.typ == "uint" || param.typ == "int" {
+			param.typ += "256"
+		}
+		if !staticEventType.MatchString(param.typ) {
+			return nil, fmt.Errorf("unsupported parameter type %q in event signature %q", fields[0], signature)
+		}
+
+		for _, field := range fields[1:] {
+			switch field {
+			case "indexed":
+				param.indexed = true
+			case "from", "to", "tokenId":
+				param.role = field
+			case "id", "tokenID":
+				param.role = "tokenId"
+			}
+		}
+		if param.role != "" {
+			if roles[param.role] {
+				return nil, fmt.Errorf("duplicate %s parameter in event signature %q", param.role, signature)
+			}
+			roles[param.role] = true
+		}
+
+		params = append(params, param)
+		typeList = append(typeList, param.typ)
+	}
+
+	if !roles["to"] || !roles["tokenId"] {
+		return nil, fmt.Errorf("event signature %q needs parameters named to and tokenId", signature)
+	}
+
+	return &eventSpec{
+		topic:  crypto.Keccak256Hash([]byte(name + "(" + strings.Join(typeList, ",") + ")")),
+		params: params,
+	}, nil
+}
+
+// decoder reads indexed parameters from the topics and the rest from
+// consecutive 32-byte data words.
+func (spec *eventSpec) decoder() TransferDecoder {
+	return func(delog types.Log) (*TransferEvent, error) {
+		event := &TransferEvent{}
+		topic, word := 1, 0
+		for _, param := range spec.params {
+			var value []byte
+			if param.indexed {
+				if topic >= len(delog.Topics) {
+					return nil, fmt.Errorf("log %s:%d has too few topics for its event", delog.TxHash.Hex(), delog.Index)
+				}
+				value = delog.Topics[topic].Bytes()
+				topic++
+			} else {
+				if len(delog.Data) < (word+1)*32 {
+					return nil, fmt.Errorf("log %s:%d has too little data for its event", delog.TxHash.Hex(), delog.Index)
+				}
+				value = delog.Data[word*32 : (word+1)*32]
+				word++
+			}
+
+			switch param.role {
+			case "from":
+				event.From = common.BytesToAddress(value)
+			case "to":
+				event.To = common.BytesToAddress(value)
+			case "tokenId":
+				event.TokenID = new(big.Int).SetBytes(value)
+			}
+		}
+		return event, nil
+	}
+}
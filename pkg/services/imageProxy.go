@@ -0,0 +1,179 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrImageProxyDisabled is returned by TokenImage unless IMAGE_PROXY is
+	// set.
+	ErrImageProxyDisabled = errors.New("image proxy is disabled")
+	// ErrImageUnavailable is returned when a token's image can't be
+	// fetched, is too large or isn't an image.
+	ErrImageUnavailable = errors.New("image unavailable")
+)
+
+// TokenImage is a token's image as served by the image proxy.
+type TokenImage struct {
+	ContentType string
+	Body        []byte
+	// source is the image URI the body was fetched from, so a cached copy
+	// is dropped once a metadata refresh changes it.
+	source string
+}
+
+// imageProxy fetches token images server-side so frontends don't have to
+// deal with CORS and rate limits of arbitrary hosts. Enabled with
+// IMAGE_PROXY=true.
+type imageProxy struct {
+	httpClient  *http.Client
+	ipfsGateway string
+	maxSize     int64
+	cache       *tokenCache
+	cacheTTL    time.Duration
+}
+
+func newImageProxy() *imageProxy {
+	ttl := envDuration("IMAGE_CACHE_TTL", time.Hour)
+	size := int(envInt64("IMAGE_CACHE_SIZE", 100))
+
+	gateway := ipfsGateway()
+	return &imageProxy{
+		httpClient:  newPublicHTTPClient(envDuration("IMAGE_FETCH_TIMEOUT", 15*time.Second), gateway),
+		ipfsGateway: gateway,
+		maxSize:     envInt64("IMAGE_MAX_SIZE", 5<<20),
+		cache:       newTokenCache(size, ttl),
+		cacheTTL:    ttl,
+	}
+}
+
+// ImageCacheTTL is how long clients may cache a proxied image.
+func (t *TransferEventTracker) ImageCacheTTL() time.Duration {
+	if t.images == nil {
+		return 0
+	}
+	return t.images.cacheTTL
+}
+
+// TokenImage returns the image from a token's stored metadata. Only tokens
+// whose metadata was fetched successfully have one; others return
+// nftModel.ErrNotFound.
+func (t *TransferEventTracker) TokenImage(ctx context.Context, contract common.Address, tokenId *big.Int) (*TokenImage, error) {
+	if t.images == nil {
+		return nil, ErrImageProxyDisabled
+	}
+
+	key, err := nftModel.KeyForTokenID(tokenId)
+	if err != nil {
+		return nil, nftModel.ErrNotFound
+	}
+	nft, err := nftModel.GetNftByToken(ctx, contract.Hex(), key)
+	if errors.Is(err, nftModel.ErrNotFound) {
+		// A token recorded from chain has no metadata yet, but it is queued
+		// for it, so a later request can find the image.
+		_, recordErr := t.RecordMissingOwner(ctx, contract, tokenId)
+		if recordErr != nil && !errors.Is(recordErr, nftModel.ErrNotFound) {
+			log.Printf("Failed to record %s #%s from chain: %v", contract.Hex(), tokenId.String(), recordErr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if nft.MetadataStatus != nftModel.MetadataOK || nft.Image == "" {
+		return nil, nftModel.ErrNotFound
+	}
+
+	if cached, ok := t.images.cache.get(contract, tokenId); ok && cached.(*TokenImage).source == nft.Image {
+		return cached.(*TokenImage), nil
+	}
+
+	image, err := t.images.fetch(ctx, nft.Image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImageUnavailable, err)
+	}
+	t.images.cache.set(contract, tokenId, image)
+	return image, nil
+}
+
+func (p *imageProxy) fetch(ctx context.Context, uri string) (*TokenImage, error) {
+	if strings.HasPrefix(uri, "data:") {
+		return p.decode(uri)
+	}
+
+	resolved := resolveIPFS(p.ipfsGateway, uri)
+	parsed, err := url.Parse(resolved)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("unsupported image URI %q", uri)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resolved, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("image request returned %s", resp.Status)
+	}
+	if resp.ContentLength > p.maxSize {
+		return nil, fmt.Errorf("image is %d bytes, more than IMAGE_MAX_SIZE", resp.ContentLength)
+	}
+
+	// Read one byte past the limit to tell a full-sized image from a
+	// truncated one.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.maxSize {
+		return nil, errors.New("image is larger than IMAGE_MAX_SIZE")
+	}
+
+	return p.image(uri, resp.Header.Get("Content-Type"), body)
+}
+
+// decode serves images embedded in the metadata, such as on-chain SVGs.
+func (p *imageProxy) decode(uri string) (*TokenImage, error) {
+	body, err := decodeDataURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.maxSize {
+		return nil, errors.New("image is larger than IMAGE_MAX_SIZE")
+	}
+
+	header, _, _ := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	return p.image(uri, strings.TrimSuffix(header, ";base64"), body)
+}
+
+// image checks the body is an image, sniffing its type when the source
+// didn't give a usable one.
+func (p *imageProxy) image(source, contentType string, body []byte) (*TokenImage, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		contentType = http.DetectContentType(body)
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, fmt.Errorf("content type %q is not an image", mediaType)
+	}
+	return &TokenImage{ContentType: contentType, Body: body, source: source}, nil
+}
@@ -0,0 +1,31 @@
+package trackingService
+
+import "sync/atomic"
+
+// logSampler thins out per-log lines during bulk sync: while active only
+// every nth call to sample reports true, starting with the first. Outside
+// of bulk sync every line is kept.
+type logSampler struct {
+	every  int64
+	active atomic.Bool
+	seen   atomic.Int64
+}
+
+func newLogSampler(every int64) *logSampler {
+	if every < 1 {
+		every = 1
+	}
+	return &logSampler{every: every}
+}
+
+func (s *logSampler) sample() bool {
+	if !s.active.Load() || s.every == 1 {
+		return true
+	}
+	return (s.seen.Add(1)-1)%s.every == 0
+}
+
+func (s *logSampler) setActive(active bool) {
+	s.active.Store(active)
+	s.seen.Store(0)
+}
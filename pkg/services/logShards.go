@@ -0,0 +1,86 @@
+package trackingService
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type shardedLog struct {
+	delog     types.Log
+	blockTime time.Time
+}
+
+// logShards spreads Transfer logs over PROCESS_WORKERS goroutines. Logs are
+// routed by contract and tokenId, so every log of one token goes to the
+// same goroutine in dispatch order and its final owner is always the one
+// from its last transfer, while different tokens are processed in
+// parallel.
+type logShards struct {
+	tracker *TransferEventTracker
+	queues  []chan shardedLog
+	wg      sync.WaitGroup
+	once    sync.Once
+	err     error
+}
+
+// newLogShards starts the workers for one processRange call, or returns
+// nil when logs should be processed inline.
+func (t *TransferEventTracker) newLogShards(ctx context.Context) *logShards {
+	if t.processWorkers <= 1 {
+		return nil
+	}
+
+	s := &logShards{tracker: t, queues: make([]chan shardedLog, t.processWorkers)}
+	for i := range s.queues {
+		queue := make(chan shardedLog, 64)
+		s.queues[i] = queue
+		s.wg.Add(1)
+		go s.work(ctx, queue)
+	}
+	return s
+}
+
+func (s *logShards) work(ctx context.Context, queue chan shardedLog) {
+	defer s.wg.Done()
+	for item := range queue {
+		err := s.tracker.processTransferLog(ctx, item.delog, item.blockTime)
+		if err != nil {
+			err = s.tracker.logFailed(item.delog, err)
+		}
+		if err != nil {
+			s.once.Do(func() { s.err = err })
+		}
+	}
+}
+
+func (s *logShards) dispatch(delog types.Log, blockTime time.Time) {
+	s.queues[s.shard(delog)] <- shardedLog{delog: delog, blockTime: blockTime}
+}
+
+// shard hashes the contract and tokenId. Logs that don't decode all land
+// on the first worker, which logs the decode error.
+func (s *logShards) shard(delog types.Log) int {
+	event, err := s.tracker.decoders.decode(delog)
+	if err != nil || event.TokenID == nil {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write(delog.Address.Bytes())
+	h.Write(event.TokenID.Bytes())
+	return int(h.Sum32() % uint32(len(s.queues)))
+}
+
+// wait blocks until every dispatched log has been processed and returns
+// the first failure that aborts the range.
+func (s *logShards) wait() error {
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	s.wg.Wait()
+	return s.err
+}
@@ -0,0 +1,75 @@
+package trackingService
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestShardedWorkersKeepTokenOrder(t *testing.T) {
+	const tokens, rounds = 16, 6
+	holder := func(tokenId int64, round int) common.Address {
+		return common.BigToAddress(big.NewInt(tokenId*100 + int64(round) + 1))
+	}
+
+	var logs []types.Log
+	for round := 0; round < rounds; round++ {
+		for tokenId := int64(1); tokenId <= tokens; tokenId++ {
+			from := common.Address{}
+			if round > 0 {
+				from = holder(tokenId, round-1)
+			}
+			logs = append(logs, transferLog(uint64(10+round), uint(tokenId), from, holder(tokenId, round), tokenId))
+		}
+	}
+	// The node returns them newest first.
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+
+	ctx := context.Background()
+	client := newFakeEthClient(20, logs...)
+	tracker, store := newTestTracker(t, client, map[string]string{"PROCESS_WORKERS": "4", "BATCH_SIZE": "1"})
+	_, err := tracker.headBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.Subscribe(false)
+	defer tracker.Unsubscribe(events)
+
+	err = tracker.processRange(ctx, 10, 20, tracker.contractAddrs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tracker.batcher.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With a batch size of 1 every update is written, and announced, as
+	// soon as its worker processes it, so the events show each token's
+	// processing order.
+	written := make(map[string][]uint64)
+	for len(events) > 0 {
+		event := <-events
+		written[event.NFT.NftID.String()] = append(written[event.NFT.NftID.String()], event.NFT.BlockNumber)
+	}
+	for tokenId := int64(1); tokenId <= tokens; tokenId++ {
+		blocks := written[big.NewInt(tokenId).String()]
+		if len(blocks) != rounds {
+			t.Errorf("token %d: %d updates written, want %d", tokenId, len(blocks), rounds)
+		}
+		for i := 1; i < len(blocks); i++ {
+			if blocks[i] <= blocks[i-1] {
+				t.Errorf("token %d: updates written in block order %v", tokenId, blocks)
+				break
+			}
+		}
+		if got, want := ownerOf(t, store, tokenId), holder(tokenId, rounds-1).Hex(); got != want {
+			t.Errorf("token %d owner = %s, want %s", tokenId, got, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package trackingService
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxMetadataSize = 1 << 20
+
+type tokenRef struct {
+	contract common.Address
+	tokenId  *big.Int
+	// refresh re-fetches tokens that already have metadata and keeps the
+	// stored copy if the new fetch fails.
+	refresh bool
+}
+
+type tokenMetadata struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Image       string            `json:"image"`
+	Attributes  []json.RawMessage `json:"attributes"`
+}
+
+// metadataFetcher resolves tokenURI for newly seen tokens and stores the
+// parsed attributes. Enabled when STORE_FIELDS includes tokenUri or
+// metadata.
+type metadataFetcher struct {
+	tracker     *TransferEventTracker
+	httpClient  *http.Client
+	ipfsGateway string
+	queue       chan tokenRef
+	workers     int
+	// batchSize is how many queued tokens a worker resolves in one
+	// multicall; 1 without MULTICALL_ADDRESS.
+	batchSize int
+}
+
+func newMetadataFetcher(t *TransferEventTracker) *metadataFetcher {
+	workers := int(envInt64("METADATA_WORKERS", 2))
+	if workers == 0 {
+		workers = 2
+	}
+
+	batchSize := 1
+	if t.multicall != nil {
+		batchSize = int(envInt64("MULTICALL_BATCH_SIZE", 50))
+		if batchSize == 0 {
+			batchSize = 50
+		}
+	}
+
+	gateway := ipfsGateway()
+	return &metadataFetcher{
+		tracker:     t,
+		httpClient:  newPublicHTTPClient(envDuration("METADATA_FETCH_TIMEOUT", 15*time.Second), gateway),
+		ipfsGateway: gateway,
+		queue:       make(chan tokenRef, 1000),
+		workers:     workers,
+		batchSize:   batchSize,
+	}
+}
+
+func (f *metadataFetcher) Start(ctx context.Context) {
+	for i := 0; i < f.workers; i++ {
+		go f.work(ctx)
+	}
+}
+
+// Enqueue never blocks the processing loop; tokens dropped here are picked
+// up the next time they transfer.
+func (f *metadataFetcher) Enqueue(contract common.Address, tokenId *big.Int) {
+	select {
+	case f.queue <- tokenRef{contract: contract, tokenId: tokenId}:
+	default:
+		log.Printf("Metadata queue full, skipping %s #%s", contract.Hex(), tokenId.String())
+	}
+}
+
+// Refresh queues a re-fetch of a token that already has metadata, keeping
+// the stored copy if it fails.
+func (f *metadataFetcher) Refresh(contract common.Address, tokenId *big.Int) {
+	select {
+	case f.queue <- tokenRef{contract: contract, tokenId: tokenId, refresh: true}:
+	default:
+		log.Printf("Metadata queue full, leaving %s #%s to the refresher", contract.Hex(), tokenId.String())
+	}
+}
+
+func (f *metadataFetcher) work(ctx context.Context) {
+	for {
+		select {
+		case ref := <-f.queue:
+			f.fetchBatch(ctx, f.drain(ref))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain adds whatever else is already queued to first, up to batchSize,
+// without waiting for more.
+func (f *metadataFetcher) drain(first tokenRef) []tokenRef {
+	refs := []tokenRef{first}
+	for len(refs) < f.batchSize {
+		select {
+		case ref := <-f.queue:
+			refs = append(refs, ref)
+		default:
+			return refs
+		}
+	}
+	return refs
+}
+
+// fetchBatch resolves the token URIs of refs together, so a multicall can
+// cover them in one round trip, then fetches each document.
+func (f *metadataFetcher) fetchBatch(ctx context.Context, refs []tokenRef) {
+	var wanted []tokenRef
+	for _, ref := range refs {
+		ok, err := f.needsFetch(ref)
+		if err != nil {
+			log.Printf("Failed to fetch metadata for %s #%s: %v", ref.contract.Hex(), ref.tokenId.String(), err)
+			continue
+		}
+		if ok {
+			wanted = append(wanted, ref)
+		}
+	}
+	if len(wanted) == 0 {
+		return
+	}
+
+	uris, errs := f.tracker.TokenURIs(ctx, wanted)
+	for i, ref := range wanted {
+		err := f.fetchURI(ctx, ref, uris[i], errs[i])
+		if err != nil {
+			log.Printf("Failed to fetch metadata for %s #%s: %v", ref.contract.Hex(), ref.tokenId.String(), err)
+		}
+	}
+}
+
+// fetch records a metadataStatus for every attempt, so clients can tell a
+// missing document from one we rejected.
+func (f *metadataFetcher) fetch(ctx context.Context, ref tokenRef) error {
+	ok, err := f.needsFetch(ref)
+	if err != nil || !ok {
+		return err
+	}
+	uri, err := f.tracker.TokenURI(ctx, ref.contract, ref.tokenId)
+	return f.fetchURI(ctx, ref, uri, err)
+}
+
+// needsFetch skips tokens whose metadata is already settled, unless ref is
+// a refresh.
+func (f *metadataFetcher) needsFetch(ref tokenRef) (bool, error) {
+	key, err := nftModel.KeyForTokenID(ref.tokenId)
+	if err != nil {
+		return false, err
+	}
+	if ref.refresh {
+		return true, nil
+	}
+
+	existing, err := nftModel.GetNftByToken(context.Background(), ref.contract.Hex(), key)
+	if err != nil && !errors.Is(err, nftModel.ErrNotFound) {
+		return false, err
+	}
+	if existing != nil && (existing.MetadataStatus == nftModel.MetadataOK || existing.MetadataStatus == nftModel.MetadataInvalid || existing.MetadataStatus == nftModel.MetadataURIOnly || existing.MetadataStatus == nftModel.MetadataBlocked) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// fetchURI reads and stores the document at uri, the result of the
+// tokenURI call for ref, which failed with uriErr if set.
+func (f *metadataFetcher) fetchURI(ctx context.Context, ref tokenRef, uri string, uriErr error) error {
+	nftId, err := nftModel.BigIntToDecimal128(ref.tokenId)
+	if err != nil {
+		return err
+	}
+	contract := ref.contract.Hex()
+
+	record := f.record
+	if ref.refresh {
+		record = f.touch
+	}
+
+	if uriErr != nil {
+		record(contract, nftId, "", "", nil, nftModel.MetadataUnreachable)
+		return uriErr
+	}
+	// Blocking overrides whatever a refresh would keep, including an image
+	// stored before the host was listed.
+	if f.tracker.denylist.blocks(uri) {
+		f.record(contract, nftId, uri, "", nil, nftModel.MetadataBlocked)
+		return fmt.Errorf("token URI %s is on METADATA_DENYLIST", uri)
+	}
+	if !f.tracker.fields.metadata {
+		f.record(contract, nftId, uri, "", nil, nftModel.MetadataURIOnly)
+		return nil
+	}
+
+	body, err := f.read(ctx, uri)
+	if err != nil {
+		record(contract, nftId, uri, "", nil, nftModel.MetadataUnreachable)
+		return err
+	}
+
+	metadata, err := validateMetadata(body)
+	if err != nil {
+		record(contract, nftId, uri, "", nil, nftModel.MetadataInvalid)
+		return fmt.Errorf("invalid metadata at %s: %v", uri, err)
+	}
+	if f.tracker.denylist.blocks(metadata.Image) {
+		f.record(contract, nftId, uri, metadata.Image, nil, nftModel.MetadataBlocked)
+		return fmt.Errorf("image %s is on METADATA_DENYLIST", metadata.Image)
+	}
+
+	f.record(contract, nftId, uri, metadata.Image, parseAttributes(metadata.Attributes), nftModel.MetadataOK)
+	return nil
+}
+
+func (f *metadataFetcher) record(contract string, nftId primitive.Decimal128, uri, image string, attributes []nftModel.Attribute, status string) {
+	err := nftModel.UpdateNftMetadata(context.Background(), contract, nftId, uri, image, attributes, status)
+	if err != nil {
+		log.Printf("Failed to store metadata status for %s #%s: %v", contract, nftId.String(), err)
+	}
+}
+
+func (f *metadataFetcher) touch(contract string, nftId primitive.Decimal128, uri, image string, attributes []nftModel.Attribute, status string) {
+	err := nftModel.TouchNftMetadata(context.Background(), contract, nftId)
+	if err != nil {
+		log.Printf("Failed to store metadata fetch time for %s #%s: %v", contract, nftId.String(), err)
+	}
+}
+
+func (f *metadataFetcher) read(ctx context.Context, uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		return decodeDataURI(uri)
+	}
+
+	resolved := f.resolveURI(uri)
+	parsed, err := url.Parse(resolved)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("unsupported token URI %q", uri)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resolved, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request returned %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+}
+
+func (f *metadataFetcher) resolveURI(uri string) string {
+	return resolveIPFS(f.ipfsGateway, uri)
+}
+
+// ipfsGateway is IPFS_GATEWAY with a trailing slash.
+func ipfsGateway() string {
+	gateway := os.Getenv("IPFS_GATEWAY")
+	if gateway == "" {
+		gateway = "https://ipfs.io/ipfs/"
+	}
+	if !strings.HasSuffix(gateway, "/") {
+		gateway += "/"
+	}
+	return gateway
+}
+
+// resolveIPFS rewrites ipfs:// URIs to gateway URLs.
+func resolveIPFS(gateway, uri string) string {
+	if strings.HasPrefix(uri, "ipfs://") {
+		path := strings.TrimPrefix(uri, "ipfs://")
+		path = strings.TrimPrefix(path, "ipfs/")
+		return gateway + path
+	}
+	return uri
+}
+
+func decodeDataURI(uri string) ([]byte, error) {
+	header, payload, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found {
+		return nil, errors.New("malformed data URI")
+	}
+	if strings.HasSuffix(header, ";base64") {
+		return base64.StdEncoding.DecodeString(payload)
+	}
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(decoded), nil
+}
+
+// parseAttributes normalises trait values to strings so trait filters can
+// match numbers and strings alike.
+func parseAttributes(raw []json.RawMessage) []nftModel.Attribute {
+	attributes := make([]nftModel.Attribute, 0, len(raw))
+	for _, item := range raw {
+		var attr struct {
+			TraitType string      `json:"trait_type"`
+			Value     interface{} `json:"value"`
+		}
+		if json.Unmarshal(item, &attr) != nil || attr.TraitType == "" || attr.Value == nil {
+			continue
+		}
+		attributes = append(attributes, nftModel.Attribute{
+			TraitType: attr.TraitType,
+			Value:     fmt.Sprint(attr.Value),
+		})
+	}
+	return attributes
+}
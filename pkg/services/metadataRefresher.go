@@ -0,0 +1,134 @@
+package trackingService
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MetadataRefreshStats reports the background refresher's progress.
+type MetadataRefreshStats struct {
+	TTL        string     `json:"ttl"`
+	LastRunAt  *time.Time `json:"lastRunAt,omitempty"`
+	LastRunDue int        `json:"lastRunDue"`
+	Refreshed  int64      `json:"refreshed"`
+	Failed     int64      `json:"failed"`
+}
+
+// metadataRefresher re-fetches metadata older than METADATA_REFRESH_TTL so
+// reveals and updated art are picked up. Each pass takes the most recently
+// transferred stale tokens first and paces fetches at
+// METADATA_REFRESH_RATE per second.
+type metadataRefresher struct {
+	fetcher  *metadataFetcher
+	ttl      time.Duration
+	interval time.Duration
+	batch    int64
+	rate     float64
+	wake     chan struct{}
+
+	mu    sync.Mutex
+	stats MetadataRefreshStats
+}
+
+func newMetadataRefresher(fetcher *metadataFetcher, ttl time.Duration) *metadataRefresher {
+	batch := envInt64("METADATA_REFRESH_BATCH", 100)
+	if batch == 0 {
+		batch = 100
+	}
+	rate := envFloat("METADATA_REFRESH_RATE", 2)
+	if rate <= 0 {
+		rate = 2
+	}
+
+	return &metadataRefresher{
+		fetcher:  fetcher,
+		ttl:      ttl,
+		interval: envDuration("METADATA_REFRESH_INTERVAL", 10*time.Minute),
+		batch:    batch,
+		rate:     rate,
+		wake:     make(chan struct{}, 1),
+		stats:    MetadataRefreshStats{TTL: ttl.String()},
+	}
+}
+
+func (r *metadataRefresher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.run(ctx)
+			case <-r.wake:
+				r.run(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Wake starts a pass now instead of at the next interval. A pass already
+// waiting to start covers the request.
+func (r *metadataRefresher) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *metadataRefresher) run(ctx context.Context) {
+	stale, err := nftModel.GetStaleMetadata(ctx, time.Now().Add(-r.ttl), r.batch)
+	if err != nil {
+		log.Printf("Failed to load stale metadata: %v", err)
+		return
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	r.stats.LastRunAt = &now
+	r.stats.LastRunDue = len(stale)
+	r.mu.Unlock()
+
+	pace := time.NewTicker(time.Duration(float64(time.Second) / r.rate))
+	defer pace.Stop()
+
+	for _, nft := range stale {
+		select {
+		case <-pace.C:
+		case <-ctx.Done():
+			return
+		}
+
+		tokenId, err := nftModel.Decimal128ToBigInt(nft.NftID)
+		if err != nil {
+			continue
+		}
+
+		ref := tokenRef{contract: common.HexToAddress(nft.ContractAddress), tokenId: tokenId, refresh: true}
+		err = r.fetcher.fetch(ctx, ref)
+
+		r.mu.Lock()
+		if err != nil {
+			r.stats.Failed++
+		} else {
+			r.stats.Refreshed++
+		}
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to refresh metadata for %s #%s: %v", nft.ContractAddress, tokenId.String(), err)
+		}
+	}
+}
+
+func (r *metadataRefresher) Stats() MetadataRefreshStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
@@ -0,0 +1,59 @@
+package trackingService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// validateMetadata checks a document against the shape of the ERC-721
+// Metadata JSON schema: an object whose name, description and image are
+// strings, plus an optional attributes array of trait objects.
+func validateMetadata(body []byte) (*tokenMetadata, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return nil, errors.New("metadata is not a JSON object")
+	}
+
+	for _, name := range []string{"name", "description", "image"} {
+		raw, ok := fields[name]
+		if !ok || isJSONNull(raw) {
+			continue
+		}
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			return nil, fmt.Errorf("metadata field %q must be a string", name)
+		}
+	}
+
+	if raw, ok := fields["attributes"]; ok && !isJSONNull(raw) {
+		var attributes []map[string]interface{}
+		if json.Unmarshal(raw, &attributes) != nil {
+			return nil, errors.New("metadata attributes must be an array of objects")
+		}
+		for i, attr := range attributes {
+			if traitType, ok := attr["trait_type"]; ok {
+				if _, isString := traitType.(string); !isString {
+					return nil, fmt.Errorf("attribute %d trait_type must be a string", i)
+				}
+			}
+			switch attr["value"].(type) {
+			case string, float64, bool:
+			default:
+				return nil, fmt.Errorf("attribute %d value must be a string, number or boolean", i)
+			}
+		}
+	}
+
+	var metadata tokenMetadata
+	err = json.Unmarshal(body, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata JSON: %v", err)
+	}
+	return &metadata, nil
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return string(raw) == "null"
+}
@@ -0,0 +1,146 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	metadataUpdateHash      = crypto.Keccak256Hash([]byte("MetadataUpdate(uint256)"))
+	batchMetadataUpdateHash = crypto.Keccak256Hash([]byte("BatchMetadataUpdate(uint256,uint256)"))
+)
+
+// metadataUpdateMode is what the tracker does with EIP-4906 metadata update
+// events, set with METADATA_UPDATE_EVENTS:
+//
+//   - "" ignores them and is the default.
+//   - "stale" marks the tokens' metadata stale, so the metadata refresher
+//     takes them on its next pass.
+//   - "refetch" also re-fetches a single updated token straight away and
+//     starts a refresher pass for batch updates.
+//
+// Both need the metadata refresher, enabled with METADATA_REFRESH_TTL.
+type metadataUpdateMode string
+
+const (
+	MetadataUpdatesOff     metadataUpdateMode = ""
+	MetadataUpdatesStale   metadataUpdateMode = "stale"
+	MetadataUpdatesRefetch metadataUpdateMode = "refetch"
+)
+
+func parseMetadataUpdateMode(raw string) (metadataUpdateMode, error) {
+	switch mode := metadataUpdateMode(raw); mode {
+	case MetadataUpdatesOff, MetadataUpdatesStale, MetadataUpdatesRefetch:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid METADATA_UPDATE_EVENTS %q, want stale or refetch", raw)
+	}
+}
+
+func (t *TransferEventTracker) metadataUpdateTopics() []common.Hash {
+	if t.metadataUpdates == MetadataUpdatesOff {
+		return nil
+	}
+	return []common.Hash{metadataUpdateHash, batchMetadataUpdateHash}
+}
+
+func (t *TransferEventTracker) isMetadataUpdate(delog types.Log) bool {
+	if t.metadataUpdates == MetadataUpdatesOff || len(delog.Topics) == 0 {
+		return false
+	}
+	return delog.Topics[0] == metadataUpdateHash || delog.Topics[0] == batchMetadataUpdateHash
+}
+
+// decodeMetadataUpdate returns the token range a metadata update covers.
+// EIP-4906 doesn't index the arguments, but some contracts do, so indexed
+// topics are read before the data.
+func decodeMetadataUpdate(delog types.Log) (*big.Int, *big.Int, error) {
+	var words []*big.Int
+	for _, topic := range delog.Topics[1:] {
+		words = append(words, topic.Big())
+	}
+	for i := 0; i+32 <= len(delog.Data); i += 32 {
+		words = append(words, new(big.Int).SetBytes(delog.Data[i:i+32]))
+	}
+
+	want := 1
+	if delog.Topics[0] == batchMetadataUpdateHash {
+		want = 2
+	}
+	if len(words) < want {
+		return nil, nil, fmt.Errorf("expected %d arguments for a metadata update, got %d", want, len(words))
+	}
+	if want == 1 {
+		return words[0], words[0], nil
+	}
+	if words[0].Cmp(words[1]) > 0 {
+		return nil, nil, fmt.Errorf("metadata update range %s-%s is reversed", words[0].String(), words[1].String())
+	}
+	return words[0], words[1], nil
+}
+
+// applyMetadataUpdates handles the metadata update logs of a range. Like
+// sales, they are applied once the range's transfers have been written, so
+// tokens minted alongside the update are covered.
+func (t *TransferEventTracker) applyMetadataUpdates(updates []types.Log) {
+	wake := false
+	for _, delog := range updates {
+		from, to, err := decodeMetadataUpdate(delog)
+		if err != nil {
+			log.Printf("Failed to decode metadata update in %s: %v", delog.TxHash.Hex(), err)
+			continue
+		}
+
+		fromId, err := nftModel.BigIntToDecimal128(from)
+		if err != nil {
+			log.Printf("Skipping metadata update in %s: %v", delog.TxHash.Hex(), err)
+			continue
+		}
+		// Collections signal "every token" with a huge upper bound, which
+		// doesn't fit in Decimal128; leave the range open instead.
+		var toId *primitive.Decimal128
+		if id, err := nftModel.BigIntToDecimal128(to); err == nil {
+			toId = &id
+		}
+
+		marked, err := nftModel.MarkMetadataStale(context.Background(), delog.Address.Hex(), fromId, toId)
+		if err != nil {
+			log.Printf("Failed to mark metadata stale for %s: %v", delog.Address.Hex(), err)
+			continue
+		}
+		if marked == 0 {
+			continue
+		}
+		log.Printf("Marked metadata of %d %s tokens stale after a metadata update in block %d", marked, delog.Address.Hex(), delog.BlockNumber)
+
+		if t.metadataUpdates != MetadataUpdatesRefetch {
+			continue
+		}
+		if from.Cmp(to) == 0 {
+			t.metadata.Refresh(delog.Address, from)
+		} else {
+			wake = true
+		}
+	}
+	if wake {
+		t.refresher.Wake()
+	}
+}
+
+// checkMetadataUpdates rejects METADATA_UPDATE_EVENTS without the
+// refresher that acts on stale tokens.
+func (t *TransferEventTracker) checkMetadataUpdates() error {
+	if t.metadataUpdates != MetadataUpdatesOff && t.refresher == nil {
+		return errors.New("METADATA_UPDATE_EVENTS needs metadata fetching and METADATA_REFRESH_TTL")
+	}
+	return nil
+}
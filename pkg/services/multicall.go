@@ -0,0 +1,162 @@
+package trackingService
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const multicall3ABI = `[
+	{
+		"inputs": [
+			{
+				"components": [
+					{"internalType": "address", "name": "target", "type": "address"},
+					{"internalType": "bool", "name": "allowFailure", "type": "bool"},
+					{"internalType": "bytes", "name": "callData", "type": "bytes"}
+				],
+				"internalType": "struct Multicall3.Call3[]",
+				"name": "calls",
+				"type": "tuple[]"
+			}
+		],
+		"name": "aggregate3",
+		"outputs": [
+			{
+				"components": [
+					{"internalType": "bool", "name": "success", "type": "bool"},
+					{"internalType": "bytes", "name": "returnData", "type": "bytes"}
+				],
+				"internalType": "struct Multicall3.Result[]",
+				"name": "returnData",
+				"type": "tuple[]"
+			}
+		],
+		"stateMutability": "payable",
+		"type": "function"
+	}
+]`
+
+var multicallABI = mustParseABI(multicall3ABI)
+
+type multicallCall struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicallResult struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// parseMulticallAddress reads MULTICALL_ADDRESS. Empty disables batching.
+func parseMulticallAddress(raw string) (*common.Address, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	address, err := parseConfigAddress(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MULTICALL_ADDRESS: %v", err)
+	}
+	return &address, nil
+}
+
+// TokenURIs resolves tokenURI for every token. With MULTICALL_ADDRESS set
+// the uncached ones go out in a single Multicall3 aggregate3 call, with
+// failures allowed so one missing token doesn't sink the batch; otherwise,
+// or if the aggregate call itself fails, each token is called on its own.
+// Errors are reported per token.
+func (t *TransferEventTracker) TokenURIs(ctx context.Context, tokens []tokenRef) ([]string, []error) {
+	uris := make([]string, len(tokens))
+	errs := make([]error, len(tokens))
+
+	var pending []int
+	for i, token := range tokens {
+		if cached, ok := t.tokenURIs.get(token.contract, token.tokenId); ok {
+			uris[i] = cached.(string)
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return uris, errs
+	}
+
+	if t.multicall != nil && len(pending) > 1 {
+		err := t.aggregateTokenURIs(ctx, tokens, pending, uris, errs)
+		if err == nil {
+			return uris, errs
+		}
+		log.Printf("Multicall of %d tokenURI calls failed, falling back to single calls: %v", len(pending), err)
+	}
+
+	for _, i := range pending {
+		uris[i], errs[i] = t.TokenURI(ctx, tokens[i].contract, tokens[i].tokenId)
+	}
+	return uris, errs
+}
+
+// aggregateTokenURIs fills uris and errs for the tokens at pending. The
+// returned error means the aggregate call as a whole failed and nothing
+// was filled in.
+func (t *TransferEventTracker) aggregateTokenURIs(ctx context.Context, tokens []tokenRef, pending []int, uris []string, errs []error) error {
+	calls := make([]multicallCall, len(pending))
+	for n, i := range pending {
+		data, err := erc721ABI.Pack("tokenURI", tokens[i].tokenId)
+		if err != nil {
+			return fmt.Errorf("failed to pack tokenURI call: %v", err)
+		}
+		calls[n] = multicallCall{Target: tokens[i].contract, AllowFailure: true, CallData: data}
+	}
+
+	data, err := multicallABI.Pack("aggregate3", calls)
+	if err != nil {
+		return fmt.Errorf("failed to pack aggregate3 call: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.rpcTimeout)
+	defer cancel()
+
+	output, err := t.client.CallContract(ctx, ethereum.CallMsg{To: t.multicall, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to call aggregate3 on %s: %v", t.multicall.Hex(), err)
+	}
+
+	values, err := multicallABI.Unpack("aggregate3", output)
+	if err != nil {
+		return fmt.Errorf("failed to unpack aggregate3 result: %v", err)
+	}
+	results := *abi.ConvertType(values[0], new([]multicallResult)).(*[]multicallResult)
+	if len(results) != len(calls) {
+		return fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), len(calls))
+	}
+
+	for n, i := range pending {
+		token := tokens[i]
+		result := results[n]
+		if !result.Success || len(result.ReturnData) == 0 {
+			errs[i] = fmt.Errorf("tokenURI on %s: %w", token.contract.Hex(), ErrCallReverted)
+			continue
+		}
+
+		decoded, err := erc721ABI.Unpack("tokenURI", result.ReturnData)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to unpack tokenURI result: %v", err)
+			continue
+		}
+		uri, ok := decoded[0].(string)
+		if !ok {
+			errs[i] = fmt.Errorf("unexpected tokenURI result type %T", decoded[0])
+			continue
+		}
+		t.tokenURIs.set(token.contract, token.tokenId, uri)
+		uris[i] = uri
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrTokenBurned is returned by RefreshOwner when ownerOf reverts for a
+// token the index has seen and OWNER_OF_REVERT is "burned".
+var ErrTokenBurned = errors.New("token burned")
+
+// revertStrategy is how live owner lookups read an ownerOf revert, set with
+// OWNER_OF_REVERT:
+//
+//   - "nonexistent" reports the token as not existing and is the default.
+//   - "burned" reports tokens the index has seen as burned, since most
+//     ERC-721 contracts revert ownerOf once a token is burned, and others
+//     as not existing.
+//   - "error" treats a revert like any other failed call.
+type revertStrategy string
+
+const (
+	RevertNonexistent revertStrategy = "nonexistent"
+	RevertBurned      revertStrategy = "burned"
+	RevertError       revertStrategy = "error"
+)
+
+func parseRevertStrategy(raw string) (revertStrategy, error) {
+	switch strategy := revertStrategy(raw); strategy {
+	case "":
+		return RevertNonexistent, nil
+	case RevertNonexistent, RevertBurned, RevertError:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("invalid OWNER_OF_REVERT %q, want nonexistent, burned or error", raw)
+	}
+}
+
+// isRevert tells an execution revert from a transport or node failure,
+// which must never be taken to mean the token is gone.
+func isRevert(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// Geth answers a revert with error code 3 when it carries reason data.
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == 3 {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "execution reverted") ||
+		strings.Contains(msg, "vm exception") && strings.Contains(msg, "revert")
+}
+
+// ownerOfReverted applies OWNER_OF_REVERT to a reverted ownerOf call.
+func (t *TransferEventTracker) ownerOfReverted(ctx context.Context, contract common.Address, tokenId *big.Int, err error) error {
+	switch t.ownerOfRevert {
+	case RevertError:
+		return fmt.Errorf("ownerOf reverted: %v", err)
+	case RevertBurned:
+		key, convErr := nftModel.KeyForTokenID(tokenId)
+		if convErr != nil {
+			return err
+		}
+		_, findErr := nftModel.GetNftByToken(ctx, contract.Hex(), key)
+		if findErr == nil {
+			return fmt.Errorf("%s #%s: %w", contract.Hex(), tokenId.String(), ErrTokenBurned)
+		}
+		if !errors.Is(findErr, nftModel.ErrNotFound) {
+			log.Printf("Failed to load indexed NFT after ownerOf revert: %v", findErr)
+		}
+	}
+	return err
+}
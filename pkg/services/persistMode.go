@@ -0,0 +1,39 @@
+package trackingService
+
+import "fmt"
+
+// persistMode chooses which collections a processed transfer is written to.
+//
+//   - "state" keeps only the nfts collection: one document per token,
+//     overwritten with each transfer. Storage grows with the number of
+//     tokens, but ownership history is lost.
+//   - "history" keeps only the append-only transfers collection. Storage
+//     grows with every transfer, and the current-state endpoints (which
+//     read nfts) return nothing.
+//   - "both" keeps both and is the default.
+type persistMode string
+
+const (
+	PersistState   persistMode = "state"
+	PersistHistory persistMode = "history"
+	PersistBoth    persistMode = "both"
+)
+
+func parsePersistMode(raw string) (persistMode, error) {
+	switch mode := persistMode(raw); mode {
+	case "":
+		return PersistBoth, nil
+	case PersistState, PersistHistory, PersistBoth:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid PERSIST_MODE %q, want state, history or both", raw)
+	}
+}
+
+func (m persistMode) keepsState() bool {
+	return m != PersistHistory
+}
+
+func (m persistMode) keepsHistory() bool {
+	return m != PersistState
+}
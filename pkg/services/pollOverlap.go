@@ -0,0 +1,158 @@
+package trackingService
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pollWindow remembers the logs of the last POLL_OVERLAP_BLOCKS processed
+// blocks. Each live poll re-reads that many blocks below its checkpoint, so
+// a log the node returned late, such as one missing from a block it had
+// only partly indexed, is still picked up, and the window makes sure the
+// logs that were already processed aren't processed again.
+//
+// A bigger window covers slower nodes at the cost of re-fetching more
+// blocks every poll. Reorgs are a separate concern: a replaced block's logs
+// have a new block hash and are processed when seen, but the records of
+// the old block are only kept out of confirmed results by CONFIRMATIONS.
+type pollWindow struct {
+	mu     sync.Mutex
+	blocks int64
+	// low and high are the blocks the window covers, 0 until something
+	// has been processed.
+	low  int64
+	high int64
+	seen map[logKey]uint64
+}
+
+func newPollWindow(blocks int64) *pollWindow {
+	if blocks <= 0 {
+		return nil
+	}
+	return &pollWindow{blocks: blocks, seen: make(map[logKey]uint64)}
+}
+
+// unseen drops the logs already processed and reports how many it dropped.
+func (w *pollWindow) unseen(logs []types.Log) ([]types.Log, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fresh := logs[:0]
+	for _, delog := range logs {
+		if _, ok := w.seen[keyOf(delog)]; ok {
+			continue
+		}
+		fresh = append(fresh, delog)
+	}
+	return fresh, len(logs) - len(fresh)
+}
+
+// remember records the logs of blocks start to through as processed and
+// forgets the ones that have left the window.
+func (w *pollWindow) remember(logs []types.Log, start, through int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// A gap since the last range, as after a rescan, starts over.
+	if w.low == 0 || start > w.high+1 {
+		w.low = start
+	}
+	if through > w.high {
+		w.high = through
+	}
+	if floor := w.high - w.blocks + 1; floor > w.low {
+		w.low = floor
+	}
+
+	for _, delog := range logs {
+		if int64(delog.BlockNumber) >= w.low && int64(delog.BlockNumber) <= through {
+			w.seen[keyOf(delog)] = delog.BlockNumber
+		}
+	}
+	for key, block := range w.seen {
+		if int64(block) < w.low {
+			delete(w.seen, key)
+		}
+	}
+}
+
+// overlap returns the blocks below next that the window covers, with
+// ok false when there are none.
+func (w *pollWindow) overlap(next int64) (int64, int64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.low == 0 || w.low >= next {
+		return 0, 0, false
+	}
+	start := next - w.blocks
+	if start < w.low {
+		start = w.low
+	}
+	return start, next - 1, true
+}
+
+func (w *pollWindow) covers(block int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.low != 0 && block >= w.low
+}
+
+// reset forgets everything, for rescans that mean to process old logs
+// again.
+func (w *pollWindow) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.low, w.high = 0, 0
+	w.seen = make(map[logKey]uint64)
+}
+
+// recheckOverlap re-reads the blocks the window covers below the live
+// checkpoint and processes whatever the earlier polls missed.
+func (t *TransferEventTracker) recheckOverlap(ctx context.Context) error {
+	if t.poll == nil {
+		return nil
+	}
+	next := t.lowestNextBlock()
+	start, end, ok := t.poll.overlap(next)
+	if !ok {
+		return nil
+	}
+
+	var addrs []common.Address
+	for _, addr := range t.contractAddrs {
+		if t.nextBlock(addr) > end {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	err := t.processRange(ctx, start, end, addrs, nil, true)
+	if err != nil {
+		return err
+	}
+	err = t.batcher.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush NFT batch: %v", err)
+	}
+	return nil
+}
+
+// filterSeen is processRange's check against the window. Logs it lets
+// through for blocks below the checkpoint are ones an earlier poll missed.
+func (t *TransferEventTracker) filterSeen(logs []types.Log, start, end int64) []types.Log {
+	if t.poll == nil {
+		return logs
+	}
+	fresh, _ := t.poll.unseen(logs)
+	if len(fresh) > 0 && t.poll.covers(start) && end < t.lowestNextBlock() {
+		log.Printf("Found %d logs in blocks %d-%d that earlier polls missed", len(fresh), start, end)
+	}
+	return fresh
+}
@@ -0,0 +1,159 @@
+package trackingService
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestPollWindowSkipsSeenLogs(t *testing.T) {
+	w := newPollWindow(3)
+	seen := transferLog(11, 0, common.Address{}, alice, 1)
+	w.remember([]types.Log{seen}, 10, 12)
+
+	late := transferLog(12, 1, common.Address{}, bob, 2)
+	fresh, dropped := w.unseen([]types.Log{seen, late})
+	if dropped != 1 || len(fresh) != 1 || keyOf(fresh[0]) != keyOf(late) {
+		t.Fatalf("unseen = %v, dropped %d; want only the late log", fresh, dropped)
+	}
+
+	// The same transaction re-mined in another block is a different log.
+	reorged := seen
+	reorged.BlockHash = common.HexToHash("0xbeef")
+	if fresh, _ := w.unseen([]types.Log{reorged}); len(fresh) != 1 {
+		t.Errorf("unseen dropped the reorged log")
+	}
+}
+
+func TestPollWindowForgetsOldBlocks(t *testing.T) {
+	w := newPollWindow(3)
+	oldest := transferLog(10, 0, common.Address{}, alice, 1)
+	w.remember([]types.Log{oldest}, 10, 12)
+
+	start, end, ok := w.overlap(13)
+	if !ok || start != 10 || end != 12 {
+		t.Fatalf("overlap(13) = %d-%d, %v; want 10-12", start, end, ok)
+	}
+
+	// Block 10 leaves the window once block 13 is processed, and its logs
+	// are forgotten with it.
+	w.remember(nil, 13, 13)
+	if w.covers(10) || !w.covers(11) {
+		t.Errorf("window covers 10: %v, 11: %v; want 11-13", w.covers(10), w.covers(11))
+	}
+	if fresh, _ := w.unseen([]types.Log{oldest}); len(fresh) != 1 {
+		t.Errorf("a log below the window was still skipped")
+	}
+	start, end, ok = w.overlap(14)
+	if !ok || start != 11 || end != 13 {
+		t.Errorf("overlap(14) = %d-%d, %v; want 11-13", start, end, ok)
+	}
+}
+
+func TestPollWindowRestartsAfterGap(t *testing.T) {
+	w := newPollWindow(3)
+	before := transferLog(11, 0, common.Address{}, alice, 1)
+	w.remember([]types.Log{before}, 10, 12)
+
+	// A range that doesn't follow on from the last one, as after a
+	// rescan, starts a new window.
+	w.remember(nil, 20, 20)
+	if w.covers(19) || !w.covers(20) {
+		t.Errorf("window covers 19: %v, 20: %v; want it to start at 20", w.covers(19), w.covers(20))
+	}
+	start, end, ok := w.overlap(21)
+	if !ok || start != 20 || end != 20 {
+		t.Errorf("overlap(21) = %d-%d, %v; want 20-20", start, end, ok)
+	}
+	if fresh, _ := w.unseen([]types.Log{before}); len(fresh) != 1 {
+		t.Errorf("a log from before the gap was still skipped")
+	}
+
+	w.reset()
+	if _, _, ok := w.overlap(21); ok {
+		t.Errorf("overlap after reset: ok = true, want false")
+	}
+}
+
+// processedLogs counts the updates written per transaction.
+func processedLogs(events <-chan NFTEvent) map[string]int {
+	counts := make(map[string]int)
+	for len(events) > 0 {
+		event := <-events
+		counts[event.NFT.TxHash]++
+	}
+	return counts
+}
+
+func TestRecheckOverlapProcessesLateLogOnce(t *testing.T) {
+	ctx := context.Background()
+	early := transferLog(11, 0, common.Address{}, alice, 1)
+	late := transferLog(12, 4, common.Address{}, bob, 2)
+	client := newFakeEthClient(12, early)
+	tracker, store := newTestTracker(t, client, map[string]string{"POLL_OVERLAP_BLOCKS": "3", "BATCH_SIZE": "1"})
+	_, err := tracker.headBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.Subscribe(false)
+	defer tracker.Unsubscribe(events)
+
+	tracker.setNextBlock(testContract, 10)
+	err = tracker.scanToBlock(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node only returns the log of block 12 once the poll that covered
+	// it is done.
+	client.add(late)
+	for i := 0; i < 2; i++ {
+		err = tracker.recheckOverlap(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := processedLogs(events)
+	if counts[early.TxHash.Hex()] != 1 || counts[late.TxHash.Hex()] != 1 {
+		t.Errorf("processed early %d times and late %d times, want once each", counts[early.TxHash.Hex()], counts[late.TxHash.Hex()])
+	}
+	if got := ownerOf(t, store, 2); got != bob.Hex() {
+		t.Errorf("token 2 owner = %s, want %s", got, bob.Hex())
+	}
+}
+
+func TestRescanResetsPollWindow(t *testing.T) {
+	ctx := context.Background()
+	mint := transferLog(11, 0, common.Address{}, alice, 1)
+	client := newFakeEthClient(12, mint)
+	tracker, _ := newTestTracker(t, client, map[string]string{"POLL_OVERLAP_BLOCKS": "3", "BATCH_SIZE": "1"})
+	_, err := tracker.headBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.Subscribe(false)
+	defer tracker.Unsubscribe(events)
+
+	tracker.setNextBlock(testContract, 10)
+	err = tracker.scanToBlock(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rescan means to process the window's logs again, and only once.
+	err = tracker.rescan(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tracker.recheckOverlap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := processedLogs(events)[mint.TxHash.Hex()]; got != 2 {
+		t.Errorf("mint processed %d times, want twice: once by the scan and once by the rescan", got)
+	}
+}
@@ -0,0 +1,118 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is how many redirects a metadata or image fetch follows.
+const maxRedirects = 5
+
+var errNonPublicAddress = errors.New("destination is not a public address")
+
+// nonPublicPrefixes are ranges netip doesn't classify as private or local
+// but that still reach infrastructure rather than the internet.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 can translate to any IPv4 address, private ones included.
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// newPublicHTTPClient returns a client for URLs taken from token metadata,
+// which whoever deployed the contract controls. It only connects to public
+// unicast addresses, checked after DNS resolution so a hostname can't point
+// it at loopback, a private network or a cloud metadata endpoint, and every
+// redirect goes through the same check. gateway, the configured IPFS
+// gateway, is exempt so one on the local network keeps working.
+func newPublicHTTPClient(timeout time.Duration, gateway string) *http.Client {
+	guarded := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: dialPublicOnly}
+	plain := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	trusted := gatewayAddr(gateway)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection on our behalf, past the check.
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if trusted != "" && addr == trusted {
+			return plain.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkPublicRedirect,
+	}
+}
+
+// gatewayAddr is the host:port the transport dials for gateway.
+func gatewayAddr(gateway string) string {
+	parsed, err := url.Parse(gateway)
+	if err != nil || parsed.Hostname() == "" {
+		return ""
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(parsed.Hostname(), port)
+}
+
+// checkPublicRedirect caps redirects and keeps them to http and https. The
+// destination address is checked when the transport dials it.
+func checkPublicRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+	}
+	return nil
+}
+
+// dialPublicOnly is a net.Dialer Control function. It runs once the name
+// has been resolved, for each address the dialer tries.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(ip) {
+		return fmt.Errorf("%w: %s", errNonPublicAddress, ip)
+	}
+	return nil
+}
+
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package trackingService
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestPublicHTTPClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer server.Close()
+
+	client := newPublicHTTPClient(5*time.Second, "https://ipfs.io/ipfs/")
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Fatalf("err = %v, want errNonPublicAddress", err)
+	}
+}
+
+func TestPublicHTTPClientRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/metadata":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	// The test server stands in for the gateway, the one host exempt from
+	// the address check, so only the redirect handling is under test.
+	client := newPublicHTTPClient(5*time.Second, server.URL)
+
+	_, err := client.Get(server.URL + "/loop")
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("redirect loop: err = %v, want the redirect cap", err)
+	}
+	_, err = client.Get(server.URL + "/file")
+	if err == nil || !strings.Contains(err.Error(), "unsupported scheme") {
+		t.Errorf("file redirect: err = %v, want unsupported scheme", err)
+	}
+	_, err = client.Get(server.URL + "/metadata")
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Errorf("metadata redirect: err = %v, want errNonPublicAddress", err)
+	}
+}
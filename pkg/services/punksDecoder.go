@@ -0,0 +1,69 @@
+package trackingService
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CryptoPunks predates ERC-721 and reports ownership changes through its own
+// events instead of an indexed-tokenId Transfer.
+var (
+	punkAssignHash   = crypto.Keccak256Hash([]byte("Assign(address,uint256)"))
+	punkTransferHash = crypto.Keccak256Hash([]byte("PunkTransfer(address,address,uint256)"))
+	punkBoughtHash   = crypto.Keccak256Hash([]byte("PunkBought(uint256,uint256,address,address)"))
+)
+
+func registerPunksDecoders(t *TransferEventTracker, contract common.Address) {
+	t.RegisterDecoder(contract, punkAssignHash, decodePunkAssign)
+	t.RegisterDecoder(contract, punkTransferHash, decodePunkTransfer)
+	t.RegisterDecoder(contract, punkBoughtHash, decodePunkBought)
+}
+
+// Assign(address indexed to, uint256 punkIndex) is the initial claim.
+func decodePunkAssign(delog types.Log) (*TransferEvent, error) {
+	if len(delog.Topics) != 2 || len(delog.Data) != 32 {
+		return nil, fmt.Errorf("malformed Assign log %s:%d", delog.TxHash.Hex(), delog.Index)
+	}
+	return &TransferEvent{
+		To:      common.BytesToAddress(delog.Topics[1].Bytes()),
+		TokenID: new(big.Int).SetBytes(delog.Data),
+	}, nil
+}
+
+// PunkTransfer(address indexed from, address indexed to, uint256 punkIndex)
+func decodePunkTransfer(delog types.Log) (*TransferEvent, error) {
+	if len(delog.Topics) != 3 || len(delog.Data) != 32 {
+		return nil, fmt.Errorf("malformed PunkTransfer log %s:%d", delog.TxHash.Hex(), delog.Index)
+	}
+	return &TransferEvent{
+		From:    common.BytesToAddress(delog.Topics[1].Bytes()),
+		To:      common.BytesToAddress(delog.Topics[2].Bytes()),
+		TokenID: new(big.Int).SetBytes(delog.Data),
+	}, nil
+}
+
+// PunkBought(uint indexed punkIndex, uint value, address indexed fromAddress,
+// address indexed toAddress)
+func decodePunkBought(delog types.Log) (*TransferEvent, error) {
+	if len(delog.Topics) != 4 {
+		return nil, fmt.Errorf("malformed PunkBought log %s:%d", delog.TxHash.Hex(), delog.Index)
+	}
+
+	event := &TransferEvent{
+		TokenID: delog.Topics[1].Big(),
+		From:    common.BytesToAddress(delog.Topics[2].Bytes()),
+		To:      common.BytesToAddress(delog.Topics[3].Bytes()),
+	}
+
+	// acceptBidForPunk emits PunkBought with a zero buyer due to a bug in
+	// the contract, so the event can't tell us the new owner.
+	if event.To == (common.Address{}) {
+		return nil, errors.New("PunkBought with zero buyer, new owner unknown")
+	}
+	return event, nil
+}
@@ -0,0 +1,61 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+)
+
+var (
+	ErrInvalidRescan = errors.New("invalid rescan request")
+	ErrRescanBusy    = errors.New("a rescan is already queued")
+)
+
+// StartRescan queues a reset of every contract's checkpoint to fromBlock
+// followed by a historical scan. The scan runs on the tracking loop itself,
+// so it never overlaps with live polling over the same range. Like
+// backfills, it is limited to MAX_BACKFILL_RANGE blocks up to the head.
+func (t *TransferEventTracker) StartRescan(fromBlock int64) error {
+	if fromBlock < 0 {
+		return fmt.Errorf("%w: fromBlock must be non-negative", ErrInvalidRescan)
+	}
+	if head := t.head.Load(); head > 0 && fromBlock > head {
+		return fmt.Errorf("%w: fromBlock %d is past the chain head %d", ErrInvalidRescan, fromBlock, head)
+	}
+	if t.maxBackfillRange > 0 {
+		head := t.head.Load()
+		if head == 0 {
+			return fmt.Errorf("%w: the chain head isn't known yet, so MAX_BACKFILL_RANGE can't be checked", ErrInvalidRescan)
+		}
+		if span := head - fromBlock + 1; span > t.maxBackfillRange {
+			return fmt.Errorf("%w: rescanning %d blocks exceeds MAX_BACKFILL_RANGE of %d", ErrInvalidRescan, span, t.maxBackfillRange)
+		}
+	}
+
+	select {
+	case t.rescans <- fromBlock:
+		return nil
+	default:
+		return ErrRescanBusy
+	}
+}
+
+func (t *TransferEventTracker) rescan(ctx context.Context, fromBlock int64) error {
+	log.Printf("Rescanning all contracts from block %d", fromBlock)
+
+	for _, addr := range t.contractAddrs {
+		err := nftModel.SaveScanProgress(ctx, addr.Hex(), fromBlock)
+		if err != nil {
+			return fmt.Errorf("failed to reset scan progress for %s: %v", addr.Hex(), err)
+		}
+		t.setNextBlock(addr, fromBlock)
+	}
+	if t.poll != nil {
+		t.poll.reset()
+	}
+
+	return t.historicalScan(ctx)
+}
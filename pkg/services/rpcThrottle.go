@@ -0,0 +1,119 @@
+package trackingService
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// throttledClient caps the number of in-flight calls to an EthClient and
+// retries calls the provider rejects with 429 Too Many Requests, backing
+// off exponentially. The slot is released while waiting so a throttled
+// call doesn't hold up others.
+type throttledClient struct {
+	client  EthClient
+	slots   chan struct{}
+	retries int
+	backoff time.Duration
+}
+
+func newThrottledClient(client EthClient, concurrency int, retries int, backoff time.Duration) *throttledClient {
+	return &throttledClient{
+		client:  client,
+		slots:   make(chan struct{}, concurrency),
+		retries: retries,
+		backoff: backoff,
+	}
+}
+
+// Providers that rate limit inside a 200 response use the EIP-1474 "limit
+// exceeded" code, or borrow 429 as the JSON-RPC code.
+const (
+	rpcLimitExceeded   = -32005
+	rpcTooManyRequests = 429
+)
+
+func isRateLimited(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		code := rpcErr.ErrorCode()
+		return code == rpcLimitExceeded || code == rpcTooManyRequests
+	}
+	return false
+}
+
+func (c *throttledClient) do(ctx context.Context, call func() error) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err := call()
+		<-c.slots
+
+		if err == nil || !isRateLimited(err) || attempt >= c.retries {
+			return err
+		}
+
+		log.Printf("RPC provider rate limited the call, retrying in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (c *throttledClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := c.do(ctx, func() error {
+		var err error
+		header, err = c.client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+func (c *throttledClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := c.do(ctx, func() error {
+		var err error
+		logs, err = c.client.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+func (c *throttledClient) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var sub ethereum.Subscription
+	err := c.do(ctx, func() error {
+		var err error
+		sub, err = c.client.SubscribeFilterLogs(ctx, query, ch)
+		return err
+	})
+	return sub, err
+}
+
+func (c *throttledClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var output []byte
+	err := c.do(ctx, func() error {
+		var err error
+		output, err = c.client.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return output, err
+}
@@ -0,0 +1,39 @@
+package trackingService
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type codedError struct {
+	code int
+	msg  string
+}
+
+func (e codedError) Error() string  { return e.msg }
+func (e codedError) ErrorCode() int { return e.code }
+
+func TestIsRateLimited(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		limited bool
+	}{
+		{"http 429", rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{"http 500", rpc.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, false},
+		{"limit exceeded", codedError{-32005, "daily request count exceeded"}, true},
+		{"json-rpc 429", fmt.Errorf("call: %w", codedError{429, "rate limited"}), true},
+		{"revert", codedError{3, "execution reverted"}, false},
+		// A 429 elsewhere in the message, such as in a block number or
+		// hash, doesn't count.
+		{"429 in message", errors.New("header not found for block 14290429"), false},
+	}
+	for _, tt := range tests {
+		if got := isRateLimited(tt.err); got != tt.limited {
+			t.Errorf("%s: isRateLimited = %v, want %v", tt.name, got, tt.limited)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package trackingService
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SaleEvent is the price a sale decoder extracts from a marketplace log.
+// Contract and TokenID are nil when the event doesn't name the token, in
+// which case the sale applies to every tracked token moved in the
+// transaction.
+type SaleEvent struct {
+	Contract *common.Address
+	TokenID  *big.Int
+	Price    *big.Int
+	Currency string
+}
+
+type SaleDecoder func(delog types.Log) ([]SaleEvent, error)
+
+type saleProtocol struct {
+	topic   common.Hash
+	decoder SaleDecoder
+}
+
+var builtinSaleProtocols = map[string]saleProtocol{
+	"seaport": {topic: seaportOrderFulfilledHash, decoder: decodeSeaportOrderFulfilled},
+	"wyvern":  {topic: wyvernOrdersMatchedHash, decoder: decodeWyvernOrdersMatched},
+}
+
+// parseMarketplaces reads SALE_MARKETPLACES, a JSON object mapping
+// marketplace contract addresses to a built-in protocol name.
+func parseMarketplaces(raw string) (map[common.Address]string, error) {
+	marketplaces := make(map[common.Address]string)
+	if strings.TrimSpace(raw) == "" {
+		return marketplaces, nil
+	}
+
+	var byAddress map[string]string
+	err := json.Unmarshal([]byte(raw), &byAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SALE_MARKETPLACES environment variable: %v", err)
+	}
+
+	for addrStr, protocol := range byAddress {
+		addr, err := parseConfigAddress(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid marketplace address in SALE_MARKETPLACES: %v", err)
+		}
+		if _, ok := builtinSaleProtocols[protocol]; !ok {
+			return nil, fmt.Errorf("unknown sale protocol %q in SALE_MARKETPLACES for %s", protocol, addrStr)
+		}
+		marketplaces[addr] = protocol
+		log.Printf("Tracking %s sales on %s", protocol, addr.Hex())
+	}
+
+	return marketplaces, nil
+}
+
+var wyvernOrdersMatchedHash = crypto.Keccak256Hash([]byte("OrdersMatched(bytes32,bytes32,address,address,uint256,bytes32)"))
+
+// OrdersMatched(bytes32 buyHash, bytes32 sellHash, address indexed maker,
+// address indexed taker, uint256 price, bytes32 indexed metadata). The
+// payment token isn't part of the event, so Currency is left empty.
+func decodeWyvernOrdersMatched(delog types.Log) ([]SaleEvent, error) {
+	if len(delog.Topics) != 4 || len(delog.Data) != 96 {
+		return nil, fmt.Errorf("malformed OrdersMatched log %s:%d", delog.TxHash.Hex(), delog.Index)
+	}
+	return []SaleEvent{{Price: new(big.Int).SetBytes(delog.Data[64:96])}}, nil
+}
+
+var seaportOrderFulfilledHash = crypto.Keccak256Hash([]byte("OrderFulfilled(bytes32,address,address,address,(uint8,address,uint256,uint256)[],(uint8,address,uint256,uint256,address)[])"))
+
+const seaportEventABI = `[
+	{
+		"anonymous": false,
+		"inputs": [
+			{"indexed": false, "internalType": "bytes32", "name": "orderHash", "type": "bytes32"},
+			{"indexed": true, "internalType": "address", "name": "offerer", "type": "address"},
+			{"indexed": true, "internalType": "address", "name": "zone", "type": "address"},
+			{"indexed": false, "internalType": "address", "name": "recipient", "type": "address"},
+			{"components": [
+				{"internalType": "uint8", "name": "itemType", "type": "uint8"},
+				{"internalType": "address", "name": "token", "type": "address"},
+				{"internalType": "uint256", "name": "identifier", "type": "uint256"},
+				{"internalType": "uint256", "name": "amount", "type": "uint256"}
+			], "indexed": false, "internalType": "struct SpentItem[]", "name": "offer", "type": "tuple[]"},
+			{"components": [
+				{"internalType": "uint8", "name": "itemType", "type": "uint8"},
+				{"internalType": "address", "name": "token", "type": "address"},
+				{"internalType": "uint256", "name": "identifier", "type": "uint256"},
+				{"internalType": "uint256", "name": "amount", "type": "uint256"},
+				{"internalType": "address payable", "name": "recipient", "type": "address"}
+			], "indexed": false, "internalType": "struct ReceivedItem[]", "name": "consideration", "type": "tuple[]"}
+		],
+		"name": "OrderFulfilled",
+		"type": "event"
+	}
+]`
+
+var seaportABI = mustParseABI(seaportEventABI)
+
+// Seaport item types.
+const (
+	seaportNative             = 0
+	seaportERC20              = 1
+	seaportERC721             = 2
+	seaportERC721WithCriteria = 4
+)
+
+type seaportItem struct {
+	ItemType   uint8
+	Token      common.Address
+	Identifier *big.Int
+	Amount     *big.Int
+}
+
+type seaportOrderFulfilled struct {
+	OrderHash     [32]byte
+	Recipient     common.Address
+	Offer         []seaportItem
+	Consideration []struct {
+		ItemType   uint8
+		Token      common.Address
+		Identifier *big.Int
+		Amount     *big.Int
+		Recipient  common.Address
+	}
+}
+
+// decodeSeaportOrderFulfilled prices every ERC-721 item in an order. A
+// listing offers the NFT and is paid in consideration; an accepted bid
+// offers the payment and receives the NFT. Bundles report the order total
+// against each token.
+func decodeSeaportOrderFulfilled(delog types.Log) ([]SaleEvent, error) {
+	var order seaportOrderFulfilled
+	err := seaportABI.UnpackIntoInterface(&order, "OrderFulfilled", delog.Data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed OrderFulfilled log %s:%d: %v", delog.TxHash.Hex(), delog.Index, err)
+	}
+
+	consideration := make([]seaportItem, 0, len(order.Consideration))
+	for _, item := range order.Consideration {
+		consideration = append(consideration, seaportItem{
+			ItemType:   item.ItemType,
+			Token:      item.Token,
+			Identifier: item.Identifier,
+			Amount:     item.Amount,
+		})
+	}
+
+	nfts, payment := order.Offer, consideration
+	if len(seaportNFTs(nfts)) == 0 {
+		nfts, payment = consideration, order.Offer
+	}
+
+	price, currency, ok := seaportPayment(payment)
+	if !ok {
+		return nil, nil
+	}
+
+	var sales []SaleEvent
+	for _, item := range seaportNFTs(nfts) {
+		contract := item.Token
+		sales = append(sales, SaleEvent{
+			Contract: &contract,
+			TokenID:  item.Identifier,
+			Price:    price,
+			Currency: currency,
+		})
+	}
+	return sales, nil
+}
+
+func seaportNFTs(items []seaportItem) []seaportItem {
+	var nfts []seaportItem
+	for _, item := range items {
+		if item.ItemType == seaportERC721 || item.ItemType == seaportERC721WithCriteria {
+			nfts = append(nfts, item)
+		}
+	}
+	return nfts
+}
+
+// seaportPayment sums the payment items in the currency of the first one,
+// which covers fees and royalties paid out of the same token.
+func seaportPayment(items []seaportItem) (*big.Int, string, bool) {
+	var currency *common.Address
+	total := new(big.Int)
+	for _, item := range items {
+		if item.ItemType != seaportNative && item.ItemType != seaportERC20 {
+			continue
+		}
+		if currency == nil {
+			token := item.Token
+			currency = &token
+		}
+		if item.Token == *currency {
+			total.Add(total, item.Amount)
+		}
+	}
+	if currency == nil {
+		return nil, "", false
+	}
+	return total, currency.Hex(), true
+}
+
+type decodedSale struct {
+	event SaleEvent
+	log   types.Log
+}
+
+func (t *TransferEventTracker) decodeSale(delog types.Log) ([]decodedSale, error) {
+	protocol := builtinSaleProtocols[t.marketplaces[delog.Address]]
+	if len(delog.Topics) == 0 || delog.Topics[0] != protocol.topic {
+		return nil, nil
+	}
+
+	events, err := protocol.decoder(delog)
+	if err != nil {
+		return nil, err
+	}
+
+	sales := make([]decodedSale, 0, len(events))
+	for _, event := range events {
+		sales = append(sales, decodedSale{event: event, log: delog})
+	}
+	return sales, nil
+}
+
+// applySales attaches decoded prices to the transfers in the same
+// transaction. The transfers must already have been written.
+func (t *TransferEventTracker) applySales(sales []decodedSale) {
+	for _, sale := range sales {
+		record := nftModel.Sale{
+			Marketplace: sale.log.Address.Hex(),
+			Price:       sale.event.Price.String(),
+			Currency:    sale.event.Currency,
+			TxHash:      sale.log.TxHash.Hex(),
+			BlockNumber: sale.log.BlockNumber,
+		}
+
+		var contract string
+		var nftId *primitive.Decimal128
+		if sale.event.Contract != nil && sale.event.TokenID != nil {
+			if !t.isTracked(*sale.event.Contract) {
+				continue
+			}
+			id, err := nftModel.BigIntToDecimal128(sale.event.TokenID)
+			if err != nil {
+				continue
+			}
+			contract, nftId = sale.event.Contract.Hex(), &id
+		}
+
+		err := nftModel.ApplySale(context.Background(), contract, nftId, record)
+		if err != nil {
+			log.Printf("Failed to record sale in %s: %v", record.TxHash, err)
+		}
+	}
+}
+
+// SalesTracked reports whether sale prices are being recorded: that needs
+// SALE_MARKETPLACES and the transfer history they are attached to.
+func (t *TransferEventTracker) SalesTracked() bool {
+	return len(t.marketplaces) > 0 && t.persistMode.keepsHistory()
+}
+
+func (t *TransferEventTracker) saleTopics() []common.Hash {
+	seen := make(map[common.Hash]bool)
+	var topics []common.Hash
+	for _, protocol := range t.marketplaces {
+		topic := builtinSaleProtocols[protocol].topic
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,112 @@
+package trackingService
+
+import (
+	"sync"
+	"time"
+)
+
+// scanRateWindow is how many recent chunks the scan rate is averaged over,
+// so the estimate follows the current throughput rather than the whole
+// run's.
+const scanRateWindow = 20
+
+// ScanStatus reports how far the historical scan has got. CurrentBlock is
+// the last block every contract has been scanned through.
+type ScanStatus struct {
+	FromBlock           int64      `json:"fromBlock"`
+	TargetBlock         int64      `json:"targetBlock"`
+	CurrentBlock        int64      `json:"currentBlock"`
+	Percent             float64    `json:"percent"`
+	BlocksPerSecond     float64    `json:"blocksPerSecond,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimatedCompletion,omitempty"`
+	Done                bool       `json:"done"`
+}
+
+type scanSample struct {
+	at    time.Time
+	block int64
+}
+
+// scanProgress is what the historical scan publishes for /status.
+type scanProgress struct {
+	mu      sync.Mutex
+	started bool
+	active  bool
+	status  ScanStatus
+	samples []scanSample
+}
+
+// begin starts or continues the scan towards target, the head read for
+// this pass. next is the lowest block still to scan.
+func (p *scanProgress) begin(fromBlock, target, next int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started {
+		// Contracts with their own fromBlock option can start earlier.
+		if next < fromBlock {
+			fromBlock = next
+		}
+		p.started = true
+		p.status.FromBlock = fromBlock
+		p.samples = append(p.samples, scanSample{at: time.Now(), block: next - 1})
+	}
+	p.active = true
+	p.status.TargetBlock = target
+	p.status.CurrentBlock = next - 1
+}
+
+// advance records that every contract has been scanned up to next.
+func (p *scanProgress) advance(next int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.active {
+		return
+	}
+	p.status.CurrentBlock = next - 1
+	p.samples = append(p.samples, scanSample{at: time.Now(), block: next - 1})
+	if len(p.samples) > scanRateWindow {
+		p.samples = p.samples[len(p.samples)-scanRateWindow:]
+	}
+}
+
+// end stops publishing; done reports whether the scan reached the head
+// rather than timing out or failing.
+func (p *scanProgress) end(done bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active = false
+	p.status.Done = done
+}
+
+func (p *scanProgress) snapshot() *ScanStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started {
+		return nil
+	}
+	status := p.status
+
+	total := status.TargetBlock - status.FromBlock + 1
+	scanned := status.CurrentBlock - status.FromBlock + 1
+	switch {
+	case status.Done || total <= 0 || scanned >= total:
+		status.Percent = 100
+	case scanned > 0:
+		status.Percent = float64(scanned) * 100 / float64(total)
+	}
+
+	if p.active && len(p.samples) > 1 {
+		first, last := p.samples[0], p.samples[len(p.samples)-1]
+		if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 && last.block > first.block {
+			status.BlocksPerSecond = float64(last.block-first.block) / elapsed
+			remaining := float64(status.TargetBlock-status.CurrentBlock) / status.BlocksPerSecond
+			eta := time.Now().Add(time.Duration(remaining * float64(time.Second))).UTC()
+			status.EstimatedCompletion = &eta
+		}
+	}
+	return &status
+}
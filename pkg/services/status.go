@@ -0,0 +1,75 @@
+package trackingService
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrackerStatus is the operational snapshot served at /status.
+type TrackerStatus struct {
+	ChainID         int64                 `json:"chainId"`
+	HeadBlock       int64                 `json:"headBlock"`
+	HistoricalScan  *ScanStatus           `json:"historicalScan,omitempty"`
+	MetadataRefresh *MetadataRefreshStats `json:"metadataRefresh,omitempty"`
+	RPCBreaker      *BreakerStatus        `json:"rpcBreaker,omitempty"`
+}
+
+func (t *TransferEventTracker) Status() TrackerStatus {
+	status := TrackerStatus{ChainID: t.chainID, HeadBlock: t.head.Load(), HistoricalScan: t.scan.snapshot()}
+	if t.refresher != nil {
+		stats := t.refresher.Stats()
+		status.MetadataRefresh = &stats
+	}
+	if t.breaker != nil {
+		breaker := t.breaker.Status()
+		status.RPCBreaker = &breaker
+	}
+	return status
+}
+
+// Readiness is the body served at /ready. Lag is only set once both the
+// head and the indexed block are known.
+type Readiness struct {
+	Ready        bool   `json:"ready"`
+	Reason       string `json:"reason,omitempty"`
+	Lag          *int64 `json:"lag,omitempty"`
+	MaxLagBlocks int64  `json:"maxLagBlocks,omitempty"`
+	// LastLogAt is when a FilterLogs call last returned any logs, or when
+	// the tracker started if none have yet.
+	LastLogAt time.Time `json:"lastLogAt"`
+}
+
+// Readiness reports whether the tracker should receive traffic: not while
+// the RPC circuit breaker is open, while indexing has fallen more than
+// MAX_LAG_BLOCKS behind the head, nor when no logs have been seen for
+// MAX_LOG_SILENCE.
+func (t *TransferEventTracker) Readiness(indexedBlock int64) Readiness {
+	readiness := Readiness{
+		Ready:        true,
+		MaxLagBlocks: t.maxLagBlocks,
+		LastLogAt:    time.Unix(0, t.lastLogAt.Load()).UTC(),
+	}
+
+	if head := t.head.Load(); head > 0 && indexedBlock >= 0 {
+		lag := head - indexedBlock
+		if lag < 0 {
+			lag = 0
+		}
+		readiness.Lag = &lag
+		if t.maxLagBlocks > 0 && lag > t.maxLagBlocks {
+			readiness.Ready = false
+			readiness.Reason = fmt.Sprintf("indexing is %d blocks behind the head", lag)
+		}
+	}
+
+	if silence := t.logSilence(); t.maxLogSilence > 0 && silence > t.maxLogSilence {
+		readiness.Ready = false
+		readiness.Reason = fmt.Sprintf("no logs seen for %s", silence.Round(time.Second))
+	}
+
+	if t.breaker != nil && t.breaker.Status().State == BreakerOpen {
+		readiness.Ready = false
+		readiness.Reason = ErrCircuitOpen.Error()
+	}
+	return readiness
+}
@@ -0,0 +1,93 @@
+package trackingService
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// storeFields picks the optional data processTransferLog populates, set
+// with STORE_FIELDS as a comma-separated list of:
+//
+//   - "tokenUri" calls tokenURI for new tokens and stores the URI.
+//   - "metadata" also fetches the metadata document; implies tokenUri.
+//   - "history" keeps the transfers collection.
+//   - "rawLogs" keeps every log undecoded.
+//   - "fromAddress" stores the previous owner on each token record.
+//
+// Without STORE_FIELDS the older flags decide: FETCH_METADATA for tokenUri
+// and metadata, PERSIST_MODE for history and STORE_RAW_LOGS for rawLogs,
+// plus fromAddress.
+type storeFields struct {
+	tokenURI    bool
+	metadata    bool
+	history     bool
+	rawLogs     bool
+	fromAddress bool
+}
+
+func parseStoreFields(raw string, mode persistMode) (storeFields, error) {
+	if strings.TrimSpace(raw) == "" {
+		fetch := envBool("FETCH_METADATA")
+		return storeFields{
+			tokenURI:    fetch,
+			metadata:    fetch,
+			history:     mode.keepsHistory(),
+			rawLogs:     envBool("STORE_RAW_LOGS"),
+			fromAddress: true,
+		}, nil
+	}
+
+	var fields storeFields
+	for _, name := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(name) {
+		case "tokenUri":
+			fields.tokenURI = true
+		case "metadata":
+			fields.tokenURI = true
+			fields.metadata = true
+		case "history":
+			fields.history = true
+		case "rawLogs":
+			fields.rawLogs = true
+		case "fromAddress":
+			fields.fromAddress = true
+		case "":
+		default:
+			return storeFields{}, fmt.Errorf("invalid STORE_FIELDS entry %q, want tokenUri, metadata, history, rawLogs or fromAddress", name)
+		}
+	}
+
+	if os.Getenv("PERSIST_MODE") != "" && fields.history != mode.keepsHistory() {
+		return storeFields{}, fmt.Errorf("STORE_FIELDS %q and PERSIST_MODE %q disagree about keeping history", raw, mode)
+	}
+	return fields, nil
+}
+
+// persistMode narrows mode to what the fields keep.
+func (f storeFields) persistMode(mode persistMode) persistMode {
+	if !f.history && mode == PersistBoth {
+		return PersistState
+	}
+	return mode
+}
+
+// names lists the enabled fields for /admin/config.
+func (f storeFields) names() []string {
+	names := []string{}
+	for _, field := range []struct {
+		name string
+		on   bool
+	}{
+		{"tokenUri", f.tokenURI},
+		{"metadata", f.metadata},
+		{"history", f.history},
+		{"rawLogs", f.rawLogs},
+		{"fromAddress", f.fromAddress},
+	} {
+		if field.on {
+			names = append(names, field.name)
+		}
+	}
+	return names
+}
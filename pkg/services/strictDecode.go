@@ -0,0 +1,41 @@
+package trackingService
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// decodeError is a log that couldn't be decoded, as opposed to one that
+// failed to be stored.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// logFailed handles a log processTransferLog or a sale decoder failed on.
+// By default the log is dead-lettered and processing carries on. With
+// STRICT_DECODE=true a decode error is returned instead, aborting the range
+// before its checkpoint is saved, so a decoder bug that hits a whole
+// contract stops the tracker rather than skipping every log. A *batchError
+// always aborts the range, as the log was never queued.
+func (t *TransferEventTracker) logFailed(delog types.Log, err error) error {
+	var batchErr *batchError
+	if errors.As(err, &batchErr) {
+		return err
+	}
+	var decodeErr *decodeError
+	if t.strictDecode && errors.As(err, &decodeErr) {
+		return fmt.Errorf("STRICT_DECODE: log %s:%d in block %d: %w", delog.TxHash.Hex(), delog.Index, delog.BlockNumber, err)
+	}
+	t.deadLetter(delog, err)
+	return nil
+}
@@ -0,0 +1,185 @@
+package trackingService
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sync"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const subscriberBuffer = 256
+
+// NFTEventType says what an NFTEvent reports about an update.
+type NFTEventType string
+
+const (
+	// EventPending is an update whose block doesn't have CONFIRMATIONS
+	// blocks on top of it yet. Only subscribers that asked for pending
+	// events receive it.
+	EventPending NFTEventType = "pending"
+	// EventConfirmed is an update that has reached CONFIRMATIONS.
+	EventConfirmed NFTEventType = "confirmed"
+	// EventReverted is a pending update whose block was replaced by a
+	// reorg before it was confirmed.
+	EventReverted NFTEventType = "reverted"
+)
+
+// NFTEvent is an NFT update as delivered to subscribers.
+type NFTEvent struct {
+	Type NFTEventType `json:"type"`
+	NFT  nftModel.NFT `json:"nft"`
+}
+
+type subscriber struct {
+	ch      chan NFTEvent
+	pending bool
+}
+
+// subscribers fans written NFT updates out to in-process consumers. Sends
+// never block: a subscriber whose buffer is full misses the update.
+//
+// Updates are only announced as confirmed once their block has
+// CONFIRMATIONS blocks on top of it, so consumers never act on a transfer
+// a reorg takes back. Until then they are held here with the hash of the
+// block they were seen in.
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[<-chan NFTEvent]*subscriber
+	held []heldUpdate
+}
+
+// heldUpdate is an unconfirmed update with the hash of the block it was
+// read from. The hash is kept per update rather than per block number:
+// once a reorg replaces the block, the replacement's logs are processed
+// too, and only the update's own hash tells the two apart.
+type heldUpdate struct {
+	nft       nftModel.NFT
+	blockHash common.Hash
+}
+
+// Subscribe returns a channel that receives every NFT update once it has
+// been written to the database and confirmed. With pending set it also
+// receives each unconfirmed update as soon as it is written, followed by a
+// confirmed or reverted event for it. Call Unsubscribe when done with it.
+func (t *TransferEventTracker) Subscribe(pending bool) <-chan NFTEvent {
+	t.subscribers.mu.Lock()
+	defer t.subscribers.mu.Unlock()
+
+	if t.subscribers.subs == nil {
+		t.subscribers.subs = make(map[<-chan NFTEvent]*subscriber)
+	}
+	ch := make(chan NFTEvent, subscriberBuffer)
+	t.subscribers.subs[ch] = &subscriber{ch: ch, pending: pending}
+	return ch
+}
+
+// Unsubscribe stops delivery to ch and closes it.
+func (t *TransferEventTracker) Unsubscribe(ch <-chan NFTEvent) {
+	t.subscribers.mu.Lock()
+	defer t.subscribers.mu.Unlock()
+
+	if sub, ok := t.subscribers.subs[ch]; ok {
+		delete(t.subscribers.subs, ch)
+		close(sub.ch)
+	}
+}
+
+func (t *TransferEventTracker) publish(nfts []nftModel.NFT) {
+	t.subscribers.mu.Lock()
+	defer t.subscribers.mu.Unlock()
+
+	if len(t.subscribers.subs) == 0 {
+		return
+	}
+	for _, nft := range nfts {
+		if nft.Confirmed {
+			t.subscribers.send(EventConfirmed, nft)
+			continue
+		}
+		t.subscribers.send(EventPending, nft)
+		t.subscribers.held = append(t.subscribers.held, heldUpdate{nft: nft, blockHash: common.HexToHash(nft.BlockHash)})
+	}
+}
+
+// releaseConfirmed announces the held updates at or below confirmedBlock:
+// as confirmed if the block each was read from is still the canonical
+// one, or as reverted if a reorg replaced it. If a block can't be checked
+// everything due is kept for the next call.
+func (t *TransferEventTracker) releaseConfirmed(confirmedBlock int64) {
+	s := &t.subscribers
+	s.mu.Lock()
+	var due, kept []heldUpdate
+	for _, update := range s.held {
+		if int64(update.nft.BlockNumber) <= confirmedBlock {
+			due = append(due, update)
+		} else {
+			kept = append(kept, update)
+		}
+	}
+	s.held = kept
+	s.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	canonical := make(map[uint64]common.Hash)
+	for _, update := range due {
+		number := update.nft.BlockNumber
+		if _, checked := canonical[number]; update.blockHash == (common.Hash{}) || checked {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), t.rpcTimeout)
+		header, err := t.client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		cancel()
+		if err != nil {
+			log.Printf("Failed to check block %d before announcing updates: %v\n", number, err)
+			s.requeue(due)
+			return
+		}
+		canonical[number] = header.Hash()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, update := range due {
+		nft := update.nft
+		// Updates that didn't come from a log, such as owners recorded
+		// from ownerOf, have no block hash to check.
+		if update.blockHash != (common.Hash{}) && canonical[nft.BlockNumber] != update.blockHash {
+			log.Printf("Block %d was reorged out, reverting update for %s #%s", nft.BlockNumber, nft.ContractAddress, nft.NftID.String())
+			s.send(EventReverted, nft)
+			continue
+		}
+		nft.Confirmed = true
+		s.send(EventConfirmed, nft)
+	}
+}
+
+// requeue puts updates back in front of the ones held since they were
+// taken, keeping delivery in block order.
+func (s *subscribers) requeue(due []heldUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.held = append(due, s.held...)
+}
+
+// send delivers an event; pending and reverted events only go to
+// subscribers that asked for pending updates. s.mu must be held.
+func (s *subscribers) send(kind NFTEventType, nft nftModel.NFT) {
+	for _, sub := range s.subs {
+		if kind != EventConfirmed && !sub.pending {
+			continue
+		}
+		select {
+		case sub.ch <- NFTEvent{Type: kind, NFT: nft}:
+		default:
+			log.Printf("Subscriber buffer full, dropping update for %s #%s", nft.ContractAddress, nft.NftID.String())
+		}
+	}
+}
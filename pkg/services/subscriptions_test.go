@@ -0,0 +1,57 @@
+package trackingService
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestReorgedUpdatesAreReverted(t *testing.T) {
+	ctx := context.Background()
+	orphaned := transferLog(10, 0, common.Address{}, alice, 1)
+	client := newFakeEthClient(10, orphaned)
+	tracker, _ := newTestTracker(t, client, map[string]string{"CONFIRMATIONS": "2", "BATCH_SIZE": "1"})
+	_, err := tracker.headBlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := tracker.Subscribe(true)
+	defer tracker.Unsubscribe(events)
+
+	err = tracker.processRange(ctx, 10, 10, tracker.contractAddrs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Block 10 is replaced by one that moves the same token elsewhere, and
+	// the replacement is processed before block 10 is confirmed.
+	replacement := transferLog(10, 1, common.Address{}, bob, 1)
+	client.reorg(10, replacement)
+	err = tracker.processRange(ctx, 10, 10, tracker.contractAddrs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.setHead(12)
+	tracker.promoteConfirmed(12)
+
+	want := []struct {
+		kind  NFTEventType
+		owner common.Address
+	}{
+		{EventPending, alice},
+		{EventPending, bob},
+		{EventReverted, alice},
+		{EventConfirmed, bob},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		event := <-events
+		if event.Type != w.kind || event.NFT.OwnerAddress != w.owner.Hex() {
+			t.Errorf("event %d = %s to %s, want %s to %s", i, event.Type, event.NFT.OwnerAddress, w.kind, w.owner.Hex())
+		}
+	}
+}
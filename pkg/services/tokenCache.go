@@ -0,0 +1,99 @@
+package trackingService
+
+import (
+	"container/list"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type tokenCacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// tokenCache is a size-bounded LRU with a TTL, used to front per-token
+// contract reads such as ownerOf and tokenURI.
+type tokenCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newTokenCache(size int, ttl time.Duration) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func tokenCacheKey(contract common.Address, tokenId *big.Int) string {
+	return contract.Hex() + ":" + tokenId.String()
+}
+
+func (c *tokenCache) get(contract common.Address, tokenId *big.Int) (interface{}, bool) {
+	return c.lookup(tokenCacheKey(contract, tokenId))
+}
+
+func (c *tokenCache) set(contract common.Address, tokenId *big.Int, value interface{}) {
+	c.store(tokenCacheKey(contract, tokenId), value)
+}
+
+// lookup and store work on raw keys, for caches keyed by something other
+// than a token.
+func (c *tokenCache) lookup(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*tokenCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, entry.key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *tokenCache) store(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*tokenCacheEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&tokenCacheEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+}
+
+func (c *tokenCache) invalidate(contract common.Address, tokenId *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := tokenCacheKey(contract, tokenId)
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
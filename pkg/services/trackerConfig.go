@@ -0,0 +1,132 @@
+package trackingService
+
+import (
+	"context"
+	"net/url"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+)
+
+// TrackerConfig is what the running tracker was configured with, served at
+// /admin/config. It is built from the tracker's own state rather than the
+// environment, so it shows what is actually in effect.
+type TrackerConfig struct {
+	ChainID     int64  `json:"chainId"`
+	RPCEndpoint string `json:"rpcEndpoint,omitempty"`
+	// FromBlock is where contracts without saved progress started; 0 until
+	// tracking has begun.
+	FromBlock     int64             `json:"fromBlock"`
+	FetchInterval string            `json:"fetchInterval"`
+	Confirmations int64             `json:"confirmations"`
+	MaxLagBlocks  int64             `json:"maxLagBlocks"`
+	ChunkSize     int64             `json:"chunkSize"`
+	BatchSize     int               `json:"batchSize"`
+	PersistMode   string            `json:"persistMode"`
+	Contracts     []ContractConfig  `json:"contracts"`
+	Marketplaces  map[string]string `json:"marketplaces,omitempty"`
+	Features      TrackerFeatures   `json:"features"`
+}
+
+type ContractConfig struct {
+	Address string `json:"address"`
+	Paused  bool   `json:"paused"`
+	// NextBlock is the saved checkpoint, omitted when there is none yet.
+	NextBlock *int64           `json:"nextBlock,omitempty"`
+	Options   *contractOptions `json:"options,omitempty"`
+}
+
+type TrackerFeatures struct {
+	FetchMetadata    bool     `json:"fetchMetadata"`
+	MetadataRefresh  bool     `json:"metadataRefresh"`
+	ImageProxy       bool     `json:"imageProxy"`
+	StoreRawLogs     bool     `json:"storeRawLogs"`
+	StoreFields      []string `json:"storeFields"`
+	ChangeStreams    bool     `json:"changeStreams"`
+	OwnerOfFallback  bool     `json:"ownerOfFallback"`
+	OwnerOfRevert    string   `json:"ownerOfRevert"`
+	StrictDecode     bool     `json:"strictDecode"`
+	MetadataUpdates  string   `json:"metadataUpdates,omitempty"`
+	MetadataDenylist []string `json:"metadataDenylist,omitempty"`
+	ScrubBlockedURIs bool     `json:"scrubBlockedUris"`
+	MulticallAddress string   `json:"multicallAddress,omitempty"`
+	ProcessWorkers   int      `json:"processWorkers"`
+	ScanConcurrency  int      `json:"scanConcurrency"`
+}
+
+// Config reports the tracker's configuration along with each contract's
+// checkpoint.
+func (t *TransferEventTracker) Config(ctx context.Context) (TrackerConfig, error) {
+	config := TrackerConfig{
+		ChainID:       t.chainID,
+		RPCEndpoint:   redactURL(t.rpcEndpoint),
+		FromBlock:     t.fromBlock.Load(),
+		FetchInterval: t.fetchInterval.String(),
+		Confirmations: t.confirmations,
+		MaxLagBlocks:  t.maxLagBlocks,
+		ChunkSize:     t.chunkSize,
+		BatchSize:     t.batchSize,
+		PersistMode:   string(t.persistMode),
+		Contracts:     make([]ContractConfig, 0, len(t.contractAddrs)),
+		Features: TrackerFeatures{
+			FetchMetadata:    t.metadata != nil,
+			MetadataRefresh:  t.refresher != nil,
+			ImageProxy:       t.images != nil,
+			StoreRawLogs:     t.fields.rawLogs,
+			StoreFields:      t.fields.names(),
+			ChangeStreams:    t.useChangeStreams,
+			OwnerOfFallback:  t.ownerOfFallback,
+			OwnerOfRevert:    string(t.ownerOfRevert),
+			StrictDecode:     t.strictDecode,
+			MetadataUpdates:  string(t.metadataUpdates),
+			MetadataDenylist: t.denylist,
+			ScrubBlockedURIs: t.scrubBlockedURIs,
+			ProcessWorkers:   t.processWorkers,
+			ScanConcurrency:  t.scanConcurrency,
+		},
+	}
+	if t.multicall != nil {
+		config.Features.MulticallAddress = t.multicall.Hex()
+	}
+
+	for _, addr := range t.contractAddrs {
+		contract := ContractConfig{
+			Address: addr.Hex(),
+			Paused:  t.isPaused(addr),
+			Options: t.contractOpts[addr],
+		}
+		progress, err := nftModel.GetScanProgress(ctx, addr.Hex())
+		if err != nil {
+			return TrackerConfig{}, err
+		}
+		if progress != nil {
+			contract.NextBlock = &progress.NextBlock
+		}
+		config.Contracts = append(config.Contracts, contract)
+	}
+
+	if len(t.marketplaces) > 0 {
+		config.Marketplaces = make(map[string]string, len(t.marketplaces))
+		for addr, protocol := range t.marketplaces {
+			config.Marketplaces[addr.Hex()] = protocol
+		}
+	}
+	return config, nil
+}
+
+// redactURL drops everything but the scheme and host, as providers put API
+// keys in the userinfo, path or query. Endpoints that don't parse as URLs,
+// such as IPC paths, are hidden entirely.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "[redacted]"
+	}
+	redacted := parsed.Scheme + "://" + parsed.Host
+	if parsed.User != nil || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		redacted += "/[redacted]"
+	}
+	return redacted
+}
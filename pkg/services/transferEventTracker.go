@@ -6,44 +6,129 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"math/big"
 	"os"
+	"sort"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	nftModel "github.com/aman/nft-tracker/pkg/models"
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var transferEventHash = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
 type TransferEventTracker struct {
-	client        *ethclient.Client
-	collection    *mongo.Collection
-	contractAddrs []common.Address
+	client              EthClient
+	rpcEndpoint         string
+	breaker             *circuitBreaker
+	contractAddrs       []common.Address
+	contractOpts        map[common.Address]*contractOptions
+	marketplaces        map[common.Address]string
+	decoders            *decoderRegistry
+	batcher             *nftBatcher
+	metadata            *metadataFetcher
+	refresher           *metadataRefresher
+	images              *imageProxy
+	nextBlocks          map[common.Address]int64
+	nextBlocksMu        sync.Mutex
+	backfills           chan BackfillRequest
+	rescans             chan int64
+	chunkSize           int64
+	batchSize           int
+	historicalBatchSize int
+	chainID             int64
+	wrapped             *wrappedTokens
+	multicall           *common.Address
+	logSampler          *logSampler
+	scanTimeout         time.Duration
+	drainTimeout        time.Duration
+	rpcTimeout          time.Duration
+	divergenceThreshold float64
+	fields              storeFields
+	persistMode         persistMode
+	confirmations       int64
+	maxLagBlocks        int64
+	maxLogSilence       time.Duration
+	maxBackfillRange    int64
+	processWorkers      int
+	scanConcurrency     int
+	fetchInterval       time.Duration
+	useChangeStreams    bool
+	ownerOfFallback     bool
+	ownerOfRevert       revertStrategy
+	strictDecode        bool
+	metadataUpdates     metadataUpdateMode
+	denylist            uriDenylist
+	scrubBlockedURIs    bool
+	poll                *pollWindow
+	ens                 *ensCache
+	owners              *tokenCache
+	tokenURIs           *tokenCache
+	subscribers         subscribers
+	paused              pausedContracts
+	scan                scanProgress
+	head                atomic.Int64
+	lastLogAt           atomic.Int64
+	fromBlock           atomic.Int64
 }
 
-func NewTransferEventTracker() (*TransferEventTracker, error) {
-	collection := nftModel.GetNftCollection()
+// NewTransferEventTracker builds a tracker on top of client. A nil client
+// dials ETH_RPC_ENDPOINT.
+func NewTransferEventTracker(client EthClient) (*TransferEventTracker, error) {
+	var rpcEndpoint string
+	if client == nil {
+		dialed, err := DialEthClient()
+		if err != nil {
+			return nil, err
+		}
+		client = dialed
+		rpcEndpoint = os.Getenv("ETH_RPC_ENDPOINT")
+	}
 
-	if collection == nil {
-		log.Fatal("Failed to get MongoDB collection")
+	// Read before the client is wrapped, as the wrappers only pass on the
+	// EthClient methods.
+	chainID, err := resolveChainID(client)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("Indexing chain %d", chainID)
 
-	nftModel.CreateIndexes()
+	mode, err := parsePersistMode(os.Getenv("PERSIST_MODE"))
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseStoreFields(os.Getenv("STORE_FIELDS"), mode)
+	if err != nil {
+		return nil, err
+	}
+	mode = fields.persistMode(mode)
 
-	rpcEndpoint := os.Getenv("ETH_RPC_ENDPOINT")
-	if rpcEndpoint == "" {
-		return nil, errors.New("ETH_RPC_ENDPOINT environment variable is not set")
+	nftModel.Init(chainID, fields.rawLogs)
+	revertStrategy, err := parseRevertStrategy(os.Getenv("OWNER_OF_REVERT"))
+	if err != nil {
+		return nil, err
 	}
-	client, err := ethclient.Dial(rpcEndpoint)
+	metadataUpdates, err := parseMetadataUpdateMode(os.Getenv("METADATA_UPDATE_EVENTS"))
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to Ethereum client: %v", err)
+		return nil, err
+	}
+
+	if concurrency := envInt64("RPC_MAX_CONCURRENCY", 16); concurrency > 0 {
+		client = newThrottledClient(client, int(concurrency), int(envInt64("RPC_RATE_LIMIT_RETRIES", 3)), envDuration("RPC_RATE_LIMIT_BACKOFF", 500*time.Millisecond))
+	}
+
+	var breaker *circuitBreaker
+	if threshold := envInt64("RPC_BREAKER_THRESHOLD", 5); threshold > 0 {
+		breaker = newCircuitBreaker(client, int(threshold), envDuration("RPC_BREAKER_COOLDOWN", 30*time.Second))
+		client = breaker
 	}
 
 	contractAddrsEnv := os.Getenv("CONTRACT_ADDRESSES")
@@ -58,12 +143,20 @@ func NewTransferEventTracker() (*TransferEventTracker, error) {
 	}
 
 	contractAddrs := make([]common.Address, 0, len(addrStrings))
+	seen := make(map[common.Address]bool, len(addrStrings))
 	for _, addr := range addrStrings {
-		parsedAddr := common.HexToAddress(addr)
+		parsedAddr, err := parseConfigAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid contract address in CONTRACT_ADDRESSES: %v", err)
+		}
 		if parsedAddr == (common.Address{}) {
-			log.Printf("Invalid contract address: %s", addr)
+			return nil, errors.New("invalid contract address in CONTRACT_ADDRESSES: the zero address can't be tracked")
+		}
+		if seen[parsedAddr] {
+			log.Printf("Warning: duplicate contract address %s in CONTRACT_ADDRESSES", parsedAddr.Hex())
 			continue
 		}
+		seen[parsedAddr] = true
 		contractAddrs = append(contractAddrs, parsedAddr)
 	}
 
@@ -71,211 +164,882 @@ func NewTransferEventTracker() (*TransferEventTracker, error) {
 		return nil, errors.New("no valid contract addresses found in CONTRACT_ADDRESSES environment variable")
 	}
 
-	return &TransferEventTracker{
-		client:        client,
-		collection:    collection,
-		contractAddrs: contractAddrs,
-	}, nil
-}
+	contractOpts, err := parseContractOptions(os.Getenv("CONTRACT_OPTIONS"), contractAddrs)
+	if err != nil {
+		return nil, err
+	}
 
-func (t *TransferEventTracker) TrackTransferEvents(ctx context.Context) error {
-	transferEventSignature := []byte("Transfer(address,address,uint256)")
-	transferEventHash := crypto.Keccak256Hash(transferEventSignature)
+	marketplaces, err := parseMarketplaces(os.Getenv("SALE_MARKETPLACES"))
+	if err != nil {
+		return nil, err
+	}
 
-	fromBlockStr := os.Getenv("FROM_BLOCK")
-	if fromBlockStr == "" {
-		return errors.New("FROM_BLOCK environment variable is not set")
+	wrapped, err := parseWrappedTokens(os.Getenv("WRAPPED_TOKENS"), chainID)
+	if err != nil {
+		return nil, err
 	}
-	fromBlockInt, err := strconv.ParseInt(fromBlockStr, 10, 64)
+
+	multicall, err := parseMulticallAddress(os.Getenv("MULTICALL_ADDRESS"))
 	if err != nil {
-		return fmt.Errorf("failed to parse FROM_BLOCK environment variable: %v", err)
+		return nil, err
 	}
-	startBlock := big.NewInt(fromBlockInt)
 
-	header, err := t.client.HeaderByNumber(ctx, nil)
+	processWorkers := int(envInt64("PROCESS_WORKERS", 1))
+	if processWorkers == 0 {
+		processWorkers = 1
+	}
+
+	scanConcurrency := int(envInt64("HISTORICAL_CONCURRENCY", 1))
+	if scanConcurrency == 0 {
+		scanConcurrency = 1
+	}
+
+	chunkSize := envInt64("HISTORICAL_CHUNK_SIZE", 2000)
+	if chunkSize == 0 {
+		chunkSize = 2000
+	}
+
+	batchSize := int(envInt64("BATCH_SIZE", 100))
+	if batchSize == 0 {
+		batchSize = 100
+	}
+
+	historicalBatchSize := int(envInt64("HISTORICAL_BATCH_SIZE", 5000))
+	if historicalBatchSize == 0 {
+		historicalBatchSize = 5000
+	}
+
+	tokenCacheSize := int(envInt64("TOKEN_CACHE_SIZE", 10000))
+	if tokenCacheSize == 0 {
+		tokenCacheSize = 10000
+	}
+	tokenCacheTTL := envDuration("TOKEN_CACHE_TTL", 5*time.Minute)
+	ensCacheSize := int(envInt64("ENS_CACHE_SIZE", 10000))
+	if ensCacheSize == 0 {
+		ensCacheSize = 10000
+	}
+
+	tracker := &TransferEventTracker{
+		client:              client,
+		rpcEndpoint:         rpcEndpoint,
+		breaker:             breaker,
+		contractAddrs:       contractAddrs,
+		contractOpts:        contractOpts,
+		marketplaces:        marketplaces,
+		decoders:            newDecoderRegistry(),
+		nextBlocks:          make(map[common.Address]int64, len(contractAddrs)),
+		backfills:           make(chan BackfillRequest, 1),
+		rescans:             make(chan int64, 1),
+		chunkSize:           chunkSize,
+		batchSize:           batchSize,
+		historicalBatchSize: historicalBatchSize,
+		chainID:             chainID,
+		wrapped:             wrapped,
+		multicall:           multicall,
+		logSampler:          newLogSampler(envInt64("LOG_SAMPLE_EVERY", 1)),
+		scanTimeout:         envDuration("HISTORICAL_SCAN_TIMEOUT", 6*time.Hour),
+		drainTimeout:        envDuration("SHUTDOWN_DRAIN_TIMEOUT", 30*time.Second),
+		rpcTimeout:          envDuration("RPC_CALL_TIMEOUT", 30*time.Second),
+		divergenceThreshold: envFloat("SUPPLY_DIVERGENCE_THRESHOLD", 1),
+		fields:              fields,
+		persistMode:         mode,
+		confirmations:       envInt64("CONFIRMATIONS", 0),
+		maxLagBlocks:        envInt64("MAX_LAG_BLOCKS", 0),
+		maxLogSilence:       envDuration("MAX_LOG_SILENCE", 0),
+		maxBackfillRange:    envInt64("MAX_BACKFILL_RANGE", 0),
+		processWorkers:      processWorkers,
+		scanConcurrency:     scanConcurrency,
+		fetchInterval:       envDuration("FETCH_INTERVAL", 10*time.Minute),
+		useChangeStreams:    envBool("USE_CHANGE_STREAMS"),
+		ownerOfFallback:     envBool("OWNER_OF_FALLBACK"),
+		ownerOfRevert:       revertStrategy,
+		strictDecode:        envBool("STRICT_DECODE"),
+		metadataUpdates:     metadataUpdates,
+		denylist:            parseURIDenylist(os.Getenv("METADATA_DENYLIST")),
+		scrubBlockedURIs:    envBool("SCRUB_BLOCKED_URIS"),
+		poll:                newPollWindow(envInt64("POLL_OVERLAP_BLOCKS", 3)),
+		ens:                 newENSCache(ensCacheSize, envDuration("ENS_CACHE_TTL", 5*time.Minute)),
+		owners:              newTokenCache(tokenCacheSize, tokenCacheTTL),
+		tokenURIs:           newTokenCache(tokenCacheSize, tokenCacheTTL),
+	}
+
+	for addr, opts := range contractOpts {
+		if opts.Decoder != "" {
+			builtinDecoders[opts.Decoder](tracker, addr)
+			log.Printf("Using %s decoder for %s", opts.Decoder, addr.Hex())
+		}
+		for i, spec := range opts.events {
+			tracker.RegisterDecoder(addr, spec.topic, spec.decoder())
+			log.Printf("Using event %q for %s", opts.Events[i], addr.Hex())
+		}
+		for _, spec := range opts.abiEvents {
+			tracker.RegisterDecoder(addr, spec.topic, spec.decoder)
+			log.Printf("Using %s event %s for %s", opts.ABI, spec.name, addr.Hex())
+		}
+	}
+
+	// Silence is measured from startup until the first log arrives.
+	tracker.lastLogAt.Store(time.Now().UnixNano())
+
+	tracker.batcher = newNFTBatcher(batchSize, envDuration("BATCH_FLUSH_INTERVAL", 5*time.Second), tracker.flushed, tracker.deadLetterUpserts)
+
+	if fields.tokenURI {
+		tracker.metadata = newMetadataFetcher(tracker)
+		if ttl := envDuration("METADATA_REFRESH_TTL", 0); ttl > 0 {
+			tracker.refresher = newMetadataRefresher(tracker.metadata, ttl)
+		}
+	}
+	if envBool("IMAGE_PROXY") {
+		tracker.images = newImageProxy()
+	}
+	err = tracker.checkMetadataUpdates()
+	if err != nil {
+		return nil, err
+	}
+
+	return tracker, nil
+}
+
+func (t *TransferEventTracker) TrackTransferEvents(ctx context.Context) error {
+	defer func() {
+		err := t.withDrainTimeout(t.batcher.Close)
+		if err != nil {
+			log.Printf("Failed to flush pending NFT updates on shutdown: %v", err)
+		}
+	}()
+
+	fromBlock, err := t.startBlock(ctx)
 	if err != nil {
-		log.Printf("Failed to get latest block header: %v\n", err)
 		return err
 	}
-	latestBlock := header.Number
+	t.fromBlock.Store(fromBlock)
 
-	query := ethereum.FilterQuery{
-		FromBlock: startBlock,
-		ToBlock:   latestBlock,
-		Addresses: t.contractAddrs,
-		Topics:    [][]common.Hash{{transferEventHash}},
+	if t.metadata != nil {
+		t.metadata.Start(ctx)
+	}
+	if t.refresher != nil {
+		t.refresher.Start(ctx)
+	}
+	go t.serveBackfills(ctx)
+	if t.useChangeStreams {
+		go t.watchNftChanges(ctx)
 	}
 
-	historicalLogs, err := t.client.FilterLogs(ctx, query)
+	t.syncContractInfo(ctx)
+
+	err = t.syncContractFlags()
 	if err != nil {
-		log.Printf("Failed to fetch historical Transfer events: %v\n", err)
 		return err
 	}
 
-	for _, delog := range historicalLogs {
-		err = t.processTransferLog(ctx, delog)
-		if err != nil {
-			log.Printf("Failed to process historical Transfer event log: %v\n", err)
-		}
+	err = t.loadPaused()
+	if err != nil {
+		return err
 	}
 
-	interval := os.Getenv("FETCH_INTERVAL")
-	if interval == "" {
-		interval = "10m"
+	err = t.loadProgress(fromBlock)
+	if err != nil {
+		return err
 	}
-	duration, err := time.ParseDuration(interval)
+
+	err = t.historicalScan(ctx)
 	if err != nil {
-		log.Printf("Failed to parse FETCH_INTERVAL: %v, defaulting to 10 minutes\n", err)
-		duration = 10 * time.Minute
+		return err
 	}
 
-	ticker := time.NewTicker(duration)
+	ticker := time.NewTicker(t.fetchInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			t.fetchNewLogs(ctx, transferEventHash, latestBlock)
+			t.fetchNewLogs(ctx)
+		case fromBlock := <-t.rescans:
+			err := t.rescan(ctx, fromBlock)
+			if err != nil {
+				log.Printf("Rescan from block %d failed: %v\n", fromBlock, err)
+			}
 		case <-ctx.Done():
 			log.Printf("Context done, stopping event tracking")
 			return ctx.Err()
 		}
 	}
+}
+
+// historicalScan catches every contract up to the chain head. The scan gets
+// its own deadline so a hung provider can't block the tracker forever;
+// whatever is left is picked up by the live loop, which resumes from the
+// saved progress.
+func (t *TransferEventTracker) historicalScan(ctx context.Context) error {
+	// Catching up writes in bigger batches than live polling, bounded so a
+	// large sync keeps memory flat.
+	t.setBatchSize(t.historicalBatchSize)
+	defer t.setBatchSize(t.batchSize)
+	t.logSampler.setActive(true)
+	defer t.logSampler.setActive(false)
+
+	scanCtx, cancel := context.WithTimeout(ctx, t.scanTimeout)
+	err := t.scanContracts(scanCtx)
+	if err == nil {
+		err = t.catchUp(scanCtx)
+	}
+	// Errors from the RPC client and the database don't always wrap the
+	// context's, so the context itself says whether time ran out.
+	timedOut := errors.Is(scanCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	cancel()
+	t.scan.end(err == nil)
+	switch {
+	case err != nil && timedOut:
+		log.Printf("Historical scan timed out after %s, continuing with live polling\n", t.scanTimeout)
+	case err != nil:
+		log.Printf("Failed to complete historical scan: %v\n", err)
+		return err
+	default:
+		t.reportCompleteness(ctx)
+	}
 	return nil
 }
 
-func (t *TransferEventTracker) fetchNewLogs(ctx context.Context, transferEventHash common.Hash, fromBlock *big.Int) {
-	header, err := t.client.HeaderByNumber(ctx, nil)
+func (t *TransferEventTracker) setBatchSize(size int) {
+	err := t.batcher.SetSize(size)
+	if err != nil {
+		log.Printf("Failed to flush NFT batch: %v\n", err)
+	}
+}
+
+// startBlock is where contracts without saved progress begin. With
+// SKIP_HISTORICAL=true that is the current head and FROM_BLOCK is ignored;
+// contracts with saved progress still resume from it either way.
+func (t *TransferEventTracker) startBlock(ctx context.Context) (int64, error) {
+	if envBool("SKIP_HISTORICAL") {
+		head, err := t.headBlock(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get latest block header: %v", err)
+		}
+		log.Printf("SKIP_HISTORICAL is set, new contracts start at block %d", head)
+		return head, nil
+	}
+
+	fromBlockStr := os.Getenv("FROM_BLOCK")
+	if fromBlockStr == "" {
+		return 0, errors.New("FROM_BLOCK environment variable is not set")
+	}
+	fromBlock, err := strconv.ParseInt(fromBlockStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse FROM_BLOCK environment variable: %v", err)
+	}
+	return fromBlock, nil
+}
+
+// loadProgress seeds the next block to scan for every contract from its
+// stored progress record, falling back to the contract's own fromBlock
+// option and then the global start block for new contracts.
+func (t *TransferEventTracker) loadProgress(fromBlock int64) error {
+	for _, addr := range t.contractAddrs {
+		progress, err := nftModel.GetScanProgress(context.Background(), addr.Hex())
+		if err != nil {
+			return fmt.Errorf("failed to load scan progress for %s: %v", addr.Hex(), err)
+		}
+
+		next := fromBlock
+		if opts := t.contractOpts[addr]; opts != nil && opts.FromBlock != nil {
+			next = *opts.FromBlock
+		}
+		if progress != nil {
+			next = progress.NextBlock
+			log.Printf("Resuming %s from block %d", addr.Hex(), next)
+		}
+		t.setNextBlock(addr, next)
+	}
+	return nil
+}
+
+// catchUp scans history until every contract has reached the chain head,
+// re-reading the head after each pass since it moves during long backfills.
+func (t *TransferEventTracker) catchUp(ctx context.Context) error {
+	for {
+		head, err := t.headBlock(ctx)
+		if err != nil {
+			log.Printf("Failed to get latest block header: %v\n", err)
+			return err
+		}
+		t.scan.begin(t.fromBlock.Load(), head, t.lowestNextBlock())
+
+		if t.lowestNextBlock() > head {
+			log.Printf("Historical scan caught up to block %d", head)
+			return nil
+		}
+
+		err = t.scanToBlock(ctx, head)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *TransferEventTracker) fetchNewLogs(ctx context.Context) {
+	head, err := t.headBlock(ctx)
 	if err != nil {
 		log.Printf("Failed to get latest block header: %v\n", err)
 		return
 	}
-	latestBlock := header.Number
 
-	query := ethereum.FilterQuery{
-		FromBlock: fromBlock,
-		ToBlock:   latestBlock,
-		Addresses: t.contractAddrs,
-		Topics:    [][]common.Hash{{transferEventHash}},
+	err = t.recheckOverlap(ctx)
+	if err != nil {
+		log.Printf("Failed to recheck overlapping blocks: %v\n", err)
 	}
 
-	logs, err := t.client.FilterLogs(ctx, query)
+	err = t.scanToBlock(ctx, head)
 	if err != nil {
 		log.Printf("Failed to fetch new Transfer events: %v\n", err)
+	}
+
+	if silence := t.logSilence(); t.maxLogSilence > 0 && silence > t.maxLogSilence {
+		log.Printf("Warning: no logs seen for %s, the RPC node may be stale", silence.Round(time.Second))
+	}
+
+	t.promoteConfirmed(head)
+}
+
+// logSilence is how long it has been since any FilterLogs call returned a
+// log. On a busy chain a long silence usually means a node stuck on an old
+// head that still answers every call successfully.
+func (t *TransferEventTracker) logSilence() time.Duration {
+	return time.Since(time.Unix(0, t.lastLogAt.Load()))
+}
+
+// promoteConfirmed marks records confirmed once their block has
+// CONFIRMATIONS blocks on top of it, then announces them to subscribers.
+func (t *TransferEventTracker) promoteConfirmed(head int64) {
+	if t.confirmations == 0 {
 		return
 	}
 
-	for _, delog := range logs {
-		err = t.processTransferLog(ctx, delog)
+	confirmed, err := nftModel.ConfirmNfts(context.Background(), head-t.confirmations)
+	if err != nil {
+		log.Printf("Failed to promote confirmed NFTs: %v\n", err)
+		return
+	}
+	if confirmed > 0 {
+		log.Printf("Confirmed %d NFT records up to block %d", confirmed, head-t.confirmations)
+	}
+	t.releaseConfirmed(head - t.confirmations)
+}
+
+func (t *TransferEventTracker) isConfirmed(blockNumber uint64) bool {
+	return int64(blockNumber) <= t.head.Load()-t.confirmations
+}
+
+// scanToBlock fetches and processes Transfer logs in chunks up to head,
+// saving each contract's progress after every chunk.
+func (t *TransferEventTracker) scanToBlock(ctx context.Context, head int64) error {
+	for {
+		start := t.lowestNextBlock()
+		if start > head {
+			return nil
+		}
+		end := start + t.chunkSize - 1
+		if end > head {
+			end = head
+		}
+
+		skipBefore := t.nextBlocksSnapshot()
+		var addrs []common.Address
+		for _, addr := range t.contractAddrs {
+			if skipBefore[addr] <= end {
+				addrs = append(addrs, addr)
+			}
+		}
+
+		// The chunk can start before a contract's own progress when
+		// contracts are at different heights.
+		err := t.processRange(ctx, start, end, addrs, skipBefore, true)
+		var interrupted *interruptedError
+		if errors.As(err, &interrupted) {
+			return t.drain(addrs, interrupted.through+1, err)
+		}
 		if err != nil {
-			log.Printf("Failed to process new Transfer event log: %v\n", err)
+			return err
 		}
+
+		// Progress must never run ahead of what has been written.
+		err = t.batcher.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush NFT batch: %v", err)
+		}
+
+		for _, addr := range addrs {
+			t.setNextBlock(addr, end+1)
+			err = nftModel.SaveScanProgress(ctx, addr.Hex(), end+1)
+			if err != nil {
+				return fmt.Errorf("failed to save scan progress for %s: %v", addr.Hex(), err)
+			}
+		}
+		t.scan.advance(t.lowestNextBlock())
 	}
 }
 
-func (t *TransferEventTracker) processTransferLog(ctx context.Context, delog types.Log) error {
-	to, tokenId, err := decodeTransferLog(delog)
+// drain saves what an interrupted chunk got through: the batch is flushed
+// and addrs are checkpointed at next, so a restart resumes mid-chunk. It is
+// bounded by SHUTDOWN_DRAIN_TIMEOUT and returns cause once done.
+func (t *TransferEventTracker) drain(addrs []common.Address, next int64, cause error) error {
+	err := t.withDrainTimeout(func() error {
+		err := t.batcher.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush NFT batch: %v", err)
+		}
+		for _, addr := range addrs {
+			if next <= t.nextBlock(addr) {
+				continue
+			}
+			err = nftModel.SaveScanProgress(context.Background(), addr.Hex(), next)
+			if err != nil {
+				return fmt.Errorf("failed to save scan progress for %s: %v", addr.Hex(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%v (while draining after: %w)", err, cause)
+	}
+
+	for _, addr := range addrs {
+		if next > t.nextBlock(addr) {
+			t.setNextBlock(addr, next)
+		}
+	}
+	log.Printf("Scan interrupted, saved progress through block %d", next-1)
+	return cause
+}
+
+// withDrainTimeout runs fn but gives up waiting after SHUTDOWN_DRAIN_TIMEOUT,
+// so a stuck database can't hold up shutdown. fn keeps running in the
+// background if it is abandoned.
+func (t *TransferEventTracker) withDrainTimeout(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(t.drainTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("gave up after SHUTDOWN_DRAIN_TIMEOUT of %s", t.drainTimeout)
+	}
+}
+
+// interruptedError is returned by processRange when ctx is cancelled part
+// way through a chunk. Every log up to and including block through was
+// processed, so that much can still be checkpointed.
+type interruptedError struct {
+	through int64
+	err     error
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("interrupted after block %d: %v", e.through, e.err)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+// processRange fetches and processes Transfer logs for addrs in a single
+// block window, and with sales set the marketplace logs too. Logs below a
+// contract's entry in skipBefore are ignored. Once ctx is cancelled it
+// stops at the next block boundary and returns an *interruptedError.
+func (t *TransferEventTracker) processRange(ctx context.Context, start, end int64, addrs []common.Address, skipBefore map[common.Address]int64, sales bool) error {
+	var logs []types.Log
+	for _, query := range t.buildQueries(start, end, addrs, sales) {
+		queryLogs, err := t.filterLogs(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to fetch Transfer events for blocks %d-%d: %w", start, end, err)
+		}
+		logs = append(logs, queryLogs...)
+	}
+	if len(logs) > 0 {
+		t.lastLogAt.Store(time.Now().UnixNano())
+	}
+	logs, duplicates := dedupeLogs(logs)
+	if duplicates > 0 {
+		log.Printf("Warning: RPC node returned %d duplicate logs for blocks %d-%d, dropped them", duplicates, start, end)
+	}
+	logs = t.filterSeen(logs, start, end)
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	var decodedSales []decodedSale
+	var updates []types.Log
+	var strictErr error
+	var interrupted *interruptedError
+	blockTimes := make(map[uint64]time.Time)
+	shards := t.newLogShards(ctx)
+	for i, delog := range logs {
+		// Only stop between blocks, so everything before delog can be
+		// checkpointed as complete.
+		if (i == 0 || delog.BlockNumber != logs[i-1].BlockNumber) && ctx.Err() != nil {
+			interrupted = &interruptedError{through: int64(delog.BlockNumber) - 1, err: ctx.Err()}
+			break
+		}
+		if _, ok := t.marketplaces[delog.Address]; ok {
+			decoded, err := t.decodeSale(delog)
+			if err != nil {
+				log.Printf("Failed to decode sale log: %v\n", err)
+				if t.strictDecode {
+					strictErr = t.logFailed(delog, &decodeError{err: err})
+					break
+				}
+			}
+			decodedSales = append(decodedSales, decoded...)
+			continue
+		}
+		if t.isMetadataUpdate(delog) {
+			if int64(delog.BlockNumber) >= skipBefore[delog.Address] {
+				updates = append(updates, delog)
+			}
+			continue
+		}
+		if !t.decoders.handles(delog) || int64(delog.BlockNumber) < skipBefore[delog.Address] {
+			continue
+		}
+		blockTime := t.blockTime(ctx, delog.BlockNumber, blockTimes)
+		if shards != nil {
+			shards.dispatch(delog, blockTime)
+			continue
+		}
+		err := t.processTransferLog(ctx, delog, blockTime)
+		if err != nil {
+			strictErr = t.logFailed(delog, err)
+			if strictErr != nil {
+				break
+			}
+		}
+	}
+	if shards != nil {
+		err := shards.wait()
+		if strictErr == nil {
+			strictErr = err
+		}
+	}
+	if strictErr != nil {
+		return strictErr
+	}
+
+	if len(decodedSales) > 0 || len(updates) > 0 {
+		// Sales and metadata updates are matched to stored transfers, so
+		// write those first.
+		err := t.batcher.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush NFT batch: %v", err)
+		}
+		t.applySales(decodedSales)
+		t.applyMetadataUpdates(updates)
+	}
+	if t.poll != nil {
+		through := end
+		if interrupted != nil {
+			through = interrupted.through
+		}
+		t.poll.remember(logs, start, through)
+	}
+	if interrupted != nil {
+		return interrupted
+	}
+	return nil
+}
+
+// buildQueries groups contracts into as few FilterLogs calls as possible.
+// Every tracked contract and, with sales set, marketplace shares one query
+// whose Topics[0] is the OR of all configured event hashes; processRange
+// drops the logs an address wasn't configured for. Contracts filtered to a
+// single token need the tokenId topic, so each of them gets its own query.
+func (t *TransferEventTracker) buildQueries(start, end int64, addrs []common.Address, sales bool) []ethereum.FilterQuery {
+	var queries []ethereum.FilterQuery
+	var merged []common.Address
+	var topics []common.Hash
+	seen := make(map[common.Hash]bool)
+	addTopics := func(hashes []common.Hash) {
+		for _, hash := range hashes {
+			if !seen[hash] {
+				seen[hash] = true
+				topics = append(topics, hash)
+			}
+		}
+	}
+
+	for _, addr := range addrs {
+		if t.isPaused(addr) {
+			continue
+		}
+		opts := t.contractOpts[addr]
+		if !t.decoders.hasCustom(addr) && opts != nil && opts.tokenID != nil {
+			queries = append(queries, ethereum.FilterQuery{
+				FromBlock: big.NewInt(start),
+				ToBlock:   big.NewInt(end),
+				Addresses: []common.Address{addr},
+				Topics:    [][]common.Hash{{transferEventHash}, nil, nil, {common.BigToHash(opts.tokenID)}},
+			})
+			continue
+		}
+		merged = append(merged, addr)
+		addTopics(t.decoders.topics(addr))
+		addTopics(t.metadataUpdateTopics())
+	}
+
+	if sales {
+		for addr := range t.marketplaces {
+			merged = append(merged, addr)
+		}
+		addTopics(t.saleTopics())
+	}
+
+	if len(merged) > 0 {
+		queries = append(queries, ethereum.FilterQuery{
+			FromBlock: big.NewInt(start),
+			ToBlock:   big.NewInt(end),
+			Addresses: merged,
+			Topics:    [][]common.Hash{topics},
+		})
+	}
+
+	return queries
+}
+
+func (t *TransferEventTracker) headBlock(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.rpcTimeout)
+	defer cancel()
+
+	header, err := t.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	t.head.Store(header.Number.Int64())
+	return header.Number.Int64(), nil
+}
+
+// blockTime returns when a block was mined, caching headers in cache for
+// the rest of the range. It falls back to the current time if the header
+// can't be read, which only skews time-bucketed stats.
+func (t *TransferEventTracker) blockTime(ctx context.Context, number uint64, cache map[uint64]time.Time) time.Time {
+	if blockTime, ok := cache[number]; ok {
+		return blockTime
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.rpcTimeout)
+	defer cancel()
+
+	header, err := t.client.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		log.Printf("Failed to get header for block %d: %v\n", number, err)
+		return time.Now()
+	}
+
+	blockTime := time.Unix(int64(header.Time), 0).UTC()
+	cache[number] = blockTime
+	return blockTime
+}
+
+func (t *TransferEventTracker) filterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.rpcTimeout)
+	defer cancel()
+
+	return t.client.FilterLogs(ctx, query)
+}
+
+func (t *TransferEventTracker) lowestNextBlock() int64 {
+	t.nextBlocksMu.Lock()
+	defer t.nextBlocksMu.Unlock()
+
+	lowest := int64(math.MaxInt64)
+	for _, addr := range t.contractAddrs {
+		if t.nextBlocks[addr] < lowest {
+			lowest = t.nextBlocks[addr]
+		}
+	}
+	return lowest
+}
+
+func (t *TransferEventTracker) processTransferLog(ctx context.Context, delog types.Log, blockTime time.Time) error {
+	// A contract can be paused while its logs are already in flight.
+	if t.isPaused(delog.Address) {
+		return nil
+	}
+
+	// Raw logs are kept before decoding so logs a decoder rejects can be
+	// re-derived later too.
+	if t.fields.rawLogs {
+		err := nftModel.InsertRawLog(ctx, toRawLog(delog))
+		if err != nil {
+			return fmt.Errorf("failed to store raw log: %v", err)
+		}
+	}
+
+	event, err := t.decoders.decode(delog)
 	if err != nil {
 		log.Printf("Failed to decode Transfer event log: %v", err)
-		return fmt.Errorf("failed to decode Transfer event log: %v", err)
+		return &decodeError{err: fmt.Errorf("failed to decode Transfer event log: %v", err)}
 	}
 
-	tokenIDInt, err := nftModel.BigIntToInt(tokenId)
+	from, to, tokenId := event.From, event.To, event.TokenID
+
+	// Only contracts with the rawTokenIds option keep IDs too large to
+	// store as numbers.
+	key, err := nftModel.KeyForTokenID(tokenId)
+	if opts := t.contractOpts[delog.Address]; err == nil && key.RawTokenID != "" && (opts == nil || !opts.RawTokenIDs) {
+		err = fmt.Errorf("token ID %s does not fit in Decimal128", tokenId.String())
+	}
 	if err != nil {
-		log.Printf("Failed to convert tokenId to int: %v", err)
-		return fmt.Errorf("failed to convert tokenId to int: %v", err)
+		log.Printf("Failed to convert tokenId to Decimal128: %v", err)
+		return &decodeError{err: fmt.Errorf("failed to convert tokenId to Decimal128: %v", err)}
+	}
+	nftId, rawTokenId := key.NftID, key.RawTokenID
+
+	// Bulk sync only prints every LOG_SAMPLE_EVERY-th log's details.
+	verbose := t.logSampler.sample()
+	if verbose {
+		log.Printf("Processing log for token ID: %s, to address: %s", tokenId.String(), to.Hex())
 	}
 
-	log.Printf("Processing log for token ID: %s, to address: %s", tokenId.String(), to.Hex())
+	t.owners.invalidate(delog.Address, tokenId)
 
+	now := time.Now()
 	nft := nftModel.NFT{
-		NftID:           tokenIDInt,
+		NftID:           nftId,
 		OwnerAddress:    to.Hex(),
 		ContractAddress: delog.Address.Hex(),
 		TxHash:          delog.TxHash.Hex(),
-		TimeStamp:       time.Now(),
+		TimeStamp:       now,
+		BlockNumber:     delog.BlockNumber,
+		LogIndex:        delog.Index,
+		BlockHash:       delog.BlockHash.Hex(),
+		Confirmed:       t.isConfirmed(delog.BlockNumber),
+		RawTokenID:      rawTokenId,
+		ChainID:         t.chainID,
+		FirstSeenAt:     now,
+		LastTransferAt:  blockTime,
+		WrappedOf:       t.wrapped.sourceOf(t.chainID, delog.Address, tokenId),
+	}
+	if t.fields.fromAddress {
+		nft.FromAddress = from.Hex()
+	}
+	if to == (common.Address{}) {
+		nft.Burned = true
+		nft.BurnedAt = &blockTime
+	}
+
+	transfer := nftModel.Transfer{
+		ContractAddress: delog.Address.Hex(),
+		NftID:           nftId,
+		FromAddress:     from.Hex(),
+		ToAddress:       to.Hex(),
+		TxHash:          delog.TxHash.Hex(),
+		LogIndex:        delog.Index,
+		BlockNumber:     delog.BlockNumber,
+		BlockHash:       delog.BlockHash.Hex(),
+		TimeStamp:       blockTime,
+		RawTokenID:      rawTokenId,
+		ChainID:         t.chainID,
+		Mint:            from == (common.Address{}),
+	}
+
+	if verbose {
+		log.Printf("NFT object to insert: %+v", nft)
 	}
 
-	log.Printf("NFT object to insert: %+v", nft)
+	var state *nftModel.NFT
+	var history *nftModel.Transfer
+	if t.persistMode.keepsState() {
+		state = &nft
+	}
+	if t.persistMode.keepsHistory() {
+		history = &transfer
+	}
 
-	err = nft.CreateUpdateNFT()
+	err = t.batcher.Add(ctx, state, history)
 	if err != nil {
-		log.Printf("Failed to create/update NFT: %v", err)
-	}
-
-	// filter := bson.M{"nftId": nft.NftID}
-	// update := bson.M{
-	// 	"$set": bson.M{
-	// 		"ownerAddress":    nft.OwnerAddress,
-	// 		"contractAddress": nft.ContractAddress,
-	// 		"txHash":          nft.TxHash,
-	// 		"timeStamp":       nft.TimeStamp,
-	// 	},
-	// 	"$setOnInsert": bson.M{
-	// 		"nftId": nft.NftID,
-	// 	},
-	// }
-
-	// opts := options.Update().SetUpsert(true)
-	// _, err = t.collection.UpdateOne(ctx, filter, update, opts)
-	// if err != nil {
-	// 	log.Printf("Failed to insert NFT data into MongoDB: %v", err)
-	// 	return fmt.Errorf("failed to insert NFT data into MongoDB: %v", err)
-	// }
-
-	log.Printf("Successfully inserted NFT data: %+v", nft)
+		return err
+	}
+
+	if verbose {
+		log.Printf("Queued NFT data: %+v", nft)
+	}
 	return nil
 }
 
-func decodeTransferLog(delog types.Log) (common.Address, *big.Int, error) {
-	transferEventABI := `[
-		{
-			"anonymous": false,
-			"inputs": [
-				{
-					"indexed": true,
-					"internalType": "address",
-					"name": "from",
-					"type": "address"
-				},
-				{
-					"indexed": true,
-					"internalType": "address",
-					"name": "to",
-					"type": "address"
-				},
-				{
-					"indexed": true,
-					"internalType": "uint256",
-					"name": "tokenId",
-					"type": "uint256"
-				}
-			],
-			"name": "Transfer",
-			"type": "event"
+// flushed runs once a batch of NFT updates is written: it announces them
+// and, now that the records exist, queues their tokens' metadata. Only
+// state updates are batched, so history-only mode, which has nowhere to
+// put metadata, never gets here.
+func (t *TransferEventTracker) flushed(nfts []nftModel.NFT) {
+	t.publish(nfts)
+
+	if t.metadata == nil {
+		return
+	}
+	for _, nft := range nfts {
+		// Metadata is keyed on nftId, which raw token IDs all share.
+		if nft.RawTokenID != "" {
+			continue
 		}
-	]`
-	contractABI, err := abi.JSON(strings.NewReader(transferEventABI))
-	if err != nil {
-		return common.Address{}, nil, fmt.Errorf("failed to parse contract ABI: %v", err)
+		tokenId, err := nftModel.Decimal128ToBigInt(nft.NftID)
+		if err != nil {
+			log.Printf("Failed to queue metadata for %s #%s: %v", nft.ContractAddress, nft.NftID.String(), err)
+			continue
+		}
+		t.metadata.Enqueue(common.HexToAddress(nft.ContractAddress), tokenId)
 	}
+}
 
-	type LogTransfer struct {
-		From    common.Address
-		To      common.Address
-		TokenId *big.Int
-	}
+// logKey identifies a log. The block hash is part of it, so the same
+// transaction re-mined in another block after a reorg is a different log.
+type logKey struct {
+	blockHash common.Hash
+	txHash    common.Hash
+	index     uint
+}
 
-	var transferEvent LogTransfer
+func keyOf(delog types.Log) logKey {
+	return logKey{blockHash: delog.BlockHash, txHash: delog.TxHash, index: delog.Index}
+}
 
-	err = contractABI.UnpackIntoInterface(&transferEvent, "Transfer", delog.Data)
-	if err != nil {
-		return common.Address{}, nil, fmt.Errorf("failed to unpack Transfer event log: %v", err)
+// dedupeLogs drops repeats of the same log, which some load-balanced RPC
+// providers return within one response, and reports how many it dropped.
+func dedupeLogs(logs []types.Log) ([]types.Log, int) {
+	seen := make(map[logKey]bool, len(logs))
+	unique := logs[:0]
+	for _, delog := range logs {
+		key := keyOf(delog)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, delog)
 	}
+	return unique, len(logs) - len(unique)
+}
 
-	transferEvent.From = common.HexToAddress(delog.Topics[1].Hex())
-	transferEvent.To = common.HexToAddress(delog.Topics[2].Hex())
-	transferEvent.TokenId = delog.Topics[3].Big()
+func toRawLog(delog types.Log) nftModel.RawLog {
+	topics := make([]string, 0, len(delog.Topics))
+	for _, topic := range delog.Topics {
+		topics = append(topics, topic.Hex())
+	}
 
-	return transferEvent.To, transferEvent.TokenId, nil
+	return nftModel.RawLog{
+		Address:     delog.Address.Hex(),
+		Topics:      topics,
+		Data:        hexutil.Encode(delog.Data),
+		BlockNumber: delog.BlockNumber,
+		BlockHash:   delog.BlockHash.Hex(),
+		TxHash:      delog.TxHash.Hex(),
+		TxIndex:     delog.TxIndex,
+		LogIndex:    delog.Index,
+		Removed:     delog.Removed,
+	}
 }
@@ -0,0 +1,95 @@
+package trackingService
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestProcessRangeIndexesTransfers(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeEthClient(20,
+		transferLog(10, 0, common.Address{}, alice, 1),
+		transferLog(11, 0, common.Address{}, carol, 2),
+		transferLog(12, 3, alice, bob, 1),
+		// Outside the range, so not indexed yet.
+		transferLog(21, 0, bob, carol, 1),
+	)
+	tracker, store := newTestTracker(t, client, nil)
+
+	err := tracker.processRange(ctx, 10, 20, tracker.contractAddrs, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tracker.batcher.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ownerOf(t, store, 1); got != bob.Hex() {
+		t.Errorf("token 1 owner = %s, want %s", got, bob.Hex())
+	}
+	if got := ownerOf(t, store, 2); got != carol.Hex() {
+		t.Errorf("token 2 owner = %s, want %s", got, carol.Hex())
+	}
+
+	key, err := nftModel.KeyForTokenID(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := store.GetOwnerAtBlock(ctx, testContract.Hex(), key, 11)
+	if err != nil || owner != alice.Hex() {
+		t.Errorf("token 1 owner at block 11 = %q, %v; want %s", owner, err, alice.Hex())
+	}
+
+	mints, err := store.GetMints(ctx, testContract.Hex(), 0, 100, nftModel.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mints) != 2 {
+		t.Fatalf("got %d mints, want 2", len(mints))
+	}
+	for _, mint := range mints {
+		if want := time.Unix(int64(blockTimeOf(mint.BlockNumber)), 0).UTC(); !mint.TimeStamp.Equal(want) {
+			t.Errorf("mint in block %d has timestamp %s, want the block's %s", mint.BlockNumber, mint.TimeStamp, want)
+		}
+	}
+}
+
+func TestScanToBlockCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeEthClient(20,
+		transferLog(10, 0, common.Address{}, alice, 1),
+		transferLog(15, 0, alice, bob, 1),
+		transferLog(19, 1, bob, carol, 1),
+	)
+	tracker, store := newTestTracker(t, client, map[string]string{"HISTORICAL_CHUNK_SIZE": "4"})
+	tracker.setNextBlock(testContract, 10)
+
+	err := tracker.scanToBlock(ctx, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ownerOf(t, store, 1); got != carol.Hex() {
+		t.Errorf("token 1 owner = %s, want %s", got, carol.Hex())
+	}
+	if next := tracker.nextBlock(testContract); next != 21 {
+		t.Errorf("next block = %d, want 21", next)
+	}
+	progress, err := store.GetScanProgress(ctx, testContract.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.NextBlock != 21 {
+		t.Errorf("saved progress = %d, want 21", progress.NextBlock)
+	}
+	// Blocks 10-20 in chunks of 4.
+	if client.filters != 3 {
+		t.Errorf("made %d FilterLogs calls, want 3", client.filters)
+	}
+}
@@ -0,0 +1,59 @@
+package trackingService
+
+import (
+	"net/url"
+	"strings"
+)
+
+// uriDenylist holds the hosts METADATA_DENYLIST names, comma-separated.
+// An entry matches the host itself and all of its subdomains, so
+// "spam.example" also covers "nft.spam.example". Tokens whose tokenURI or
+// metadata image is on a listed host are stored as MetadataBlocked without
+// fetching anything from it, and SCRUB_BLOCKED_URIS drops their URLs from
+// API responses. The URIs themselves are still stored, so operators can
+// see what was blocked.
+type uriDenylist []string
+
+func parseURIDenylist(raw string) uriDenylist {
+	var hosts uriDenylist
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		// Accept full URLs too, as that's what gets copied out of a report.
+		if parsed, err := url.Parse(entry); err == nil && parsed.Host != "" {
+			entry = parsed.Hostname()
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if entry != "" {
+			hosts = append(hosts, entry)
+		}
+	}
+	return hosts
+}
+
+// blocks reports whether uri points at a listed host. URIs without one,
+// such as data: URIs, never match.
+func (d uriDenylist) blocks(uri string) bool {
+	if len(d) == 0 {
+		return false
+	}
+	parsed, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	for _, listed := range d {
+		if host == listed || strings.HasSuffix(host, "."+listed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubBlockedURIs reports whether API responses leave out the token and
+// image URIs of tokens blocked by METADATA_DENYLIST.
+func (t *TransferEventTracker) ScrubBlockedURIs() bool {
+	return t.scrubBlockedURIs
+}
@@ -0,0 +1,135 @@
+package trackingService
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	RelationWrapped = "wrapped"
+	RelationSource  = "source"
+)
+
+// WrappedCounterpart is a token linked to another through WRAPPED_TOKENS.
+// Relation says which side of the mapping it is on: RelationWrapped for a
+// wrapped or bridged copy, RelationSource for the original.
+type WrappedCounterpart struct {
+	nftModel.TokenRef
+	Relation string `json:"relation"`
+}
+
+type wrappedMapping struct {
+	Source  nftModel.TokenRef `json:"source"`
+	Wrapped nftModel.TokenRef `json:"wrapped"`
+}
+
+// wrappedTokens indexes WRAPPED_TOKENS both ways. It is read-only once
+// parsed.
+type wrappedTokens struct {
+	bySource  map[string][]nftModel.TokenRef
+	byWrapped map[string]nftModel.TokenRef
+}
+
+func tokenRefKey(ref nftModel.TokenRef) string {
+	return fmt.Sprintf("%d:%s:%s", ref.ChainID, ref.ContractAddress, ref.TokenID)
+}
+
+// normalizeTokenRef checksums the address, canonicalizes the token ID and
+// fills in chainID when the entry doesn't name a chain.
+func normalizeTokenRef(ref nftModel.TokenRef, chainID int64) (nftModel.TokenRef, error) {
+	addr, err := parseConfigAddress(ref.ContractAddress)
+	if err != nil {
+		return ref, err
+	}
+	tokenId, ok := new(big.Int).SetString(strings.TrimSpace(ref.TokenID), 10)
+	if !ok || tokenId.Sign() < 0 {
+		return ref, fmt.Errorf("invalid token ID %q", ref.TokenID)
+	}
+	if ref.ChainID == 0 {
+		ref.ChainID = chainID
+	}
+	ref.ContractAddress = addr.Hex()
+	ref.TokenID = tokenId.String()
+	return ref, nil
+}
+
+// parseWrappedTokens reads WRAPPED_TOKENS, a JSON array of
+// {"source": ref, "wrapped": ref} entries where each ref is
+// {"contractAddress", "tokenId", "chainId"}. chainId defaults to the
+// tracked chain. A source can have several wrapped copies, but a wrapped
+// token has one source.
+func parseWrappedTokens(raw string, chainID int64) (*wrappedTokens, error) {
+	wrapped := &wrappedTokens{
+		bySource:  make(map[string][]nftModel.TokenRef),
+		byWrapped: make(map[string]nftModel.TokenRef),
+	}
+	if strings.TrimSpace(raw) == "" {
+		return wrapped, nil
+	}
+
+	var mappings []wrappedMapping
+	err := json.Unmarshal([]byte(raw), &mappings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse WRAPPED_TOKENS environment variable: %v", err)
+	}
+
+	for i, mapping := range mappings {
+		source, err := normalizeTokenRef(mapping.Source, chainID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source in WRAPPED_TOKENS entry %d: %v", i, err)
+		}
+		target, err := normalizeTokenRef(mapping.Wrapped, chainID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wrapped token in WRAPPED_TOKENS entry %d: %v", i, err)
+		}
+		if tokenRefKey(source) == tokenRefKey(target) {
+			return nil, fmt.Errorf("WRAPPED_TOKENS entry %d maps a token to itself", i)
+		}
+		if existing, ok := wrapped.byWrapped[tokenRefKey(target)]; ok {
+			return nil, fmt.Errorf("WRAPPED_TOKENS entry %d gives %s #%s a second source, it already wraps %s #%s",
+				i, target.ContractAddress, target.TokenID, existing.ContractAddress, existing.TokenID)
+		}
+
+		wrapped.byWrapped[tokenRefKey(target)] = source
+		wrapped.bySource[tokenRefKey(source)] = append(wrapped.bySource[tokenRefKey(source)], target)
+	}
+	if len(mappings) > 0 {
+		log.Printf("Loaded %d wrapped token mappings", len(mappings))
+	}
+
+	return wrapped, nil
+}
+
+// sourceOf returns the token a tracked token wraps, or nil.
+func (w *wrappedTokens) sourceOf(chainID int64, contract common.Address, tokenId *big.Int) *nftModel.TokenRef {
+	source, ok := w.byWrapped[tokenRefKey(nftModel.TokenRef{ChainID: chainID, ContractAddress: contract.Hex(), TokenID: tokenId.String()})]
+	if !ok {
+		return nil
+	}
+	return &source
+}
+
+// WrappedCounterparts lists the tokens WRAPPED_TOKENS links to a token: its
+// source if it is a wrapped copy, and any wrapped copies of it. A chainID
+// of 0 means the tracked chain.
+func (t *TransferEventTracker) WrappedCounterparts(chainID int64, contract common.Address, tokenId *big.Int) []WrappedCounterpart {
+	if chainID == 0 {
+		chainID = t.chainID
+	}
+	counterparts := []WrappedCounterpart{}
+
+	if source := t.wrapped.sourceOf(chainID, contract, tokenId); source != nil {
+		counterparts = append(counterparts, WrappedCounterpart{TokenRef: *source, Relation: RelationSource})
+	}
+	key := tokenRefKey(nftModel.TokenRef{ChainID: chainID, ContractAddress: contract.Hex(), TokenID: tokenId.String()})
+	for _, ref := range t.wrapped.bySource[key] {
+		counterparts = append(counterparts, WrappedCounterpart{TokenRef: ref, Relation: RelationWrapped})
+	}
+	return counterparts
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	nftModel "github.com/aman/nft-tracker/pkg/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runQuery implements `nft-tracker query`, which answers a single lookup
+// from the index and prints it as JSON, without the tracker or HTTP server.
+// It returns the process exit code.
+func runQuery(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	wallet := flags.String("wallet", "", "list the NFTs owned by this address")
+	token := flags.String("token", "", "look up one token, given as contract:tokenId")
+	limit := flags.Int64("limit", 0, "most NFTs to list for --wallet (default MAX_PAGE_SIZE)")
+	includeBurned := flags.Bool("include-burned", false, "include burned tokens in --wallet results")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*wallet == "") == (*token == "") {
+		fmt.Fprintln(os.Stderr, "query: exactly one of --wallet or --token is required")
+		flags.Usage()
+		return 2
+	}
+
+	var result interface{}
+	var err error
+	if *wallet != "" {
+		result, err = queryWallet(*wallet, *limit, *includeBurned)
+	} else {
+		result, err = queryToken(*token)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func queryWallet(wallet string, limit int64, includeBurned bool) ([]nftModel.WalletNft, error) {
+	if !common.IsHexAddress(wallet) {
+		return nil, fmt.Errorf("invalid wallet address %q", wallet)
+	}
+	limit, _ = nftModel.ClampLimit(limit)
+
+	nfts, err := nftModel.GetWalletNfts(context.Background(), common.HexToAddress(wallet).Hex(), nftModel.ListOptions{
+		Limit:         limit,
+		IncludeBurned: includeBurned,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if nfts == nil {
+		nfts = []nftModel.WalletNft{}
+	}
+	return nfts, nil
+}
+
+func queryToken(token string) (*nftModel.NFT, error) {
+	contract, id, found := strings.Cut(token, ":")
+	if !found || !common.IsHexAddress(contract) {
+		return nil, fmt.Errorf("invalid token %q, expected contract:tokenId", token)
+	}
+	tokenId, ok := new(big.Int).SetString(id, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid token ID %q", id)
+	}
+	key, err := nftModel.KeyForTokenID(tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	nft, err := nftModel.GetNftByToken(context.Background(), common.HexToAddress(contract).Hex(), key)
+	if errors.Is(err, nftModel.ErrNotFound) {
+		return nil, fmt.Errorf("token %s #%s is not indexed", common.HexToAddress(contract).Hex(), tokenId.String())
+	}
+	return nft, err
+}